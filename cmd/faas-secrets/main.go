@@ -0,0 +1,165 @@
+// Command faas-secrets manages the encrypted secrets file read by
+// helpers.DefaultSecretProvider.
+//
+// The file is named by -file or FAAS_SECRETS_FILE. The master key is read
+// from the file named by -key-file or FAAS_MASTER_KEY_FILE, or else from
+// FAAS_MASTER_PASSPHRASE.
+//
+// Secret values are only read from stdin, never from arguments, which would
+// leak them into the shell history and the process list.
+//
+//	faas-secrets set SLACK_API_TOKEN < token.txt
+//	faas-secrets set SLACK_API_TOKEN       # prompts on a terminal
+//	faas-secrets get SLACK_API_TOKEN
+//	faas-secrets list
+//	faas-secrets delete SLACK_API_TOKEN
+//	faas-secrets import .env
+//	faas-secrets -new-key-file new.key rotate
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/gsarmaonline/faas/faas/helpers"
+)
+
+const (
+	// envNewMasterPassphrase is the new master key of rotate without
+	// -new-key-file
+	envNewMasterPassphrase = "FAAS_NEW_MASTER_PASSPHRASE"
+
+	usage = `usage: faas-secrets [-file path] [-key-file path] <command> [arguments]
+
+commands:
+  set KEY           store a secret read from stdin, prompting on a terminal
+  get KEY           print a secret
+  list              print the stored keys
+  delete KEY        remove a secret
+  import FILE       store every variable of a .env file
+  rotate            encrypt with a new master key from -new-key-file or
+                    ` + envNewMasterPassphrase + `
+`
+)
+
+// keyDerivationIterations is the work factor of written files
+var keyDerivationIterations = helpers.DefaultKeyDerivationIterations
+
+func main() {
+	if err := run(os.Args[1:], os.Stdin, os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, "faas-secrets:", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string, stdin io.Reader, stdout io.Writer) (err error) {
+	var (
+		masterKey []byte
+		flags     = flag.NewFlagSet("faas-secrets", flag.ContinueOnError)
+		path      = flags.String("file", os.Getenv(helpers.EnvSecretsFile), "encrypted secrets file")
+		keyFile   = flags.String("key-file", os.Getenv(helpers.EnvMasterKeyFile), "master key file")
+		newKey    = flags.String("new-key-file", "", "new master key file for rotate")
+	)
+	flags.SetOutput(io.Discard)
+	if err = flags.Parse(args); err != nil {
+		return fmt.Errorf("%w\n%s", err, usage)
+	}
+	if flags.NArg() == 0 {
+		return errors.New(usage)
+	}
+	if *path == "" {
+		return fmt.Errorf("no secrets file: use -file or set %s", helpers.EnvSecretsFile)
+	}
+	if masterKey, err = loadMasterKey(*keyFile); err != nil {
+		return
+	}
+	store := helpers.NewEncryptedSecretStore(*path, masterKey)
+	store.Iterations = keyDerivationIterations
+
+	command, operands := flags.Arg(0), flags.Args()[1:]
+	switch {
+	case command == "set" && len(operands) == 2:
+		return errors.New("set takes no value argument, which would leak into the shell history and the process list; pass the value on stdin")
+
+	case command == "set" && len(operands) == 1:
+		var value string
+		if value, err = readValue(stdin, operands[0]); err != nil {
+			return
+		}
+		return store.Set(operands[0], value)
+
+	case command == "get" && len(operands) == 1:
+		var value string
+		if value, err = store.Get(operands[0]); err != nil {
+			return
+		}
+		fmt.Fprintln(stdout, value)
+		return
+
+	case command == "list" && len(operands) == 0:
+		var keys []string
+		if keys, err = store.List(); err != nil {
+			return
+		}
+		for _, key := range keys {
+			fmt.Fprintln(stdout, key)
+		}
+		return
+
+	case command == "delete" && len(operands) == 1:
+		return store.Delete(operands[0])
+
+	case command == "import" && len(operands) == 1:
+		var values map[string]string
+		if values, err = helpers.ParseEnvFile(operands[0]); err != nil {
+			return
+		}
+		if err = store.Import(values); err != nil {
+			return
+		}
+		fmt.Fprintf(stdout, "imported %d secrets\n", len(values))
+		return
+
+	case command == "rotate" && len(operands) == 0:
+		var newMasterKey []byte
+		if *newKey != "" {
+			if newMasterKey, err = helpers.MasterKeyFromFile(*newKey); err != nil {
+				return
+			}
+		} else if passphrase := os.Getenv(envNewMasterPassphrase); passphrase != "" {
+			newMasterKey = []byte(passphrase)
+		} else {
+			return fmt.Errorf("no new master key: use -new-key-file or set %s", envNewMasterPassphrase)
+		}
+		return store.Rotate(newMasterKey)
+	}
+	return fmt.Errorf("invalid command %q\n%s", strings.Join(flags.Args(), " "), usage)
+}
+
+func loadMasterKey(keyFile string) ([]byte, error) {
+	if keyFile != "" {
+		return helpers.MasterKeyFromFile(keyFile)
+	}
+	return helpers.MasterKeyFromEnv()
+}
+
+// readValue reads the secret of key from the first line of stdin, so that
+// it does not end up in the shell history. It prompts for the value when
+// stdin is a terminal.
+func readValue(stdin io.Reader, key string) (string, error) {
+	if file, ok := stdin.(*os.File); ok {
+		if info, err := file.Stat(); err == nil && info.Mode()&os.ModeCharDevice != 0 {
+			fmt.Fprintf(os.Stderr, "Value of %s: ", key)
+		}
+	}
+	line, err := bufio.NewReader(stdin).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
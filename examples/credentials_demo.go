@@ -33,7 +33,10 @@ func main() {
 
 	// Demonstrate credential manager usage
 	fmt.Println("\n2. Testing credential manager...")
-	credManager := helpers.NewCredentialManager()
+	// Functions get a scoped resolver from Faas; the demo binds the
+	// default secret providers directly
+	credManager := helpers.NewCredentialManagerWithResolver(
+		helpers.BindSecretProvider(context.Background(), helpers.DefaultSecretProvider()))
 
 	// Test with environment variable
 	if apiKey := credManager.GetCredential(nil, helpers.EnvSendGridAPIKey); apiKey != "" {
@@ -0,0 +1,87 @@
+package faas
+
+import (
+	"time"
+
+	"github.com/gsarmaonline/faas/faas/helpers"
+	"github.com/gsarmaonline/faas/faas/intf"
+)
+
+// InvokeAsync queues an invocation of the named function in the worker pool
+// and returns its invocation ID right away. It fails with ErrQueueFull when
+// the queue is full. The invocation runs with the Faas context; use
+// GetInvocation to poll for its status and result.
+func (faas *Faas) InvokeAsync(name string, payload intf.Payload) (id string, err error) {
+	var function intf.Function
+
+	// Unknown functions are rejected before anything is queued
+	if function, err = faas.newFunction(name); err != nil {
+		return
+	}
+	// The result is redacted with the config of the function at the start
+	// of the invocation, even if it is replaced or unregistered meanwhile.
+	// redactor is used if the function is gone before the invocation starts.
+	config := function.GetConfig()
+	redactor := faas.invocationRedactor(config, payload)
+
+	invocation := Invocation{
+		ID:           newInvocationID(),
+		FunctionName: name,
+		Status:       QueuedInvocationStatus,
+		QueuedAt:     time.Now(),
+	}
+	if err = faas.resultStore.Save(invocation); err != nil {
+		return
+	}
+
+	if err = faas.pool.Submit(name, func() {
+		faas.runAsync(invocation, payload, config, redactor)
+	}); err != nil {
+		faas.metrics.recordRejection(name, err)
+		invocation.Status = FailedInvocationStatus
+		invocation.Error = err.Error()
+		invocation.FinishedAt = time.Now()
+		faas.saveInvocation(invocation)
+		return
+	}
+
+	id = invocation.ID
+	return
+}
+
+// GetInvocation returns the current state of an asynchronous invocation
+func (faas *Faas) GetInvocation(id string) (Invocation, error) {
+	return faas.resultStore.Get(id)
+}
+
+func (faas *Faas) runAsync(invocation Invocation, payload intf.Payload, config intf.FunctionConfig, redactor *helpers.Redactor) {
+	invocation.Status = RunningInvocationStatus
+	invocation.StartedAt = time.Now()
+	faas.saveInvocation(invocation)
+
+	output, invocationRedactor, err := faas.invoke(withInvocationID(faas.ctx, invocation.ID), invocation.FunctionName, payload)
+	// The redactor of the invocation also masks the secrets it resolved
+	if invocationRedactor != nil {
+		redactor = invocationRedactor
+	}
+	if err == nil && output != nil {
+		invocation.Output, err = output.GetPayload()
+	}
+	invocation.Output = redactor.Payload(config.OutputSchema, invocation.Output)
+	err = redactor.Error(err)
+
+	invocation.FinishedAt = time.Now()
+	if err != nil {
+		invocation.Status = FailedInvocationStatus
+		invocation.Error = err.Error()
+	} else {
+		invocation.Status = SucceededInvocationStatus
+	}
+	faas.saveInvocation(invocation)
+}
+
+func (faas *Faas) saveInvocation(invocation Invocation) {
+	if err := faas.resultStore.Save(invocation); err != nil {
+		faas.logger.Error("Failed to save invocation", InvocationIDLogKey, invocation.ID, "error", err)
+	}
+}
@@ -0,0 +1,224 @@
+package faas
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gsarmaonline/faas/faas/helpers"
+	"github.com/gsarmaonline/faas/faas/intf"
+)
+
+// watchedResultStore is a MemoryResultStore that lets tests wait for the
+// state of an invocation
+type watchedResultStore struct {
+	*MemoryResultStore
+	mu      sync.Mutex
+	changed chan struct{}
+}
+
+func newWatchedResultStore() *watchedResultStore {
+	return &watchedResultStore{
+		MemoryResultStore: NewMemoryResultStore(DefaultResultTTL),
+		changed:           make(chan struct{}),
+	}
+}
+
+func (store *watchedResultStore) Save(invocation Invocation) (err error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	err = store.MemoryResultStore.Save(invocation)
+	close(store.changed)
+	store.changed = make(chan struct{})
+	return
+}
+
+// waitFor waits until the invocation is in a state that satisfies cond
+func (store *watchedResultStore) waitFor(t *testing.T, id string, cond func(Invocation) bool) Invocation {
+	t.Helper()
+
+	timeout := time.After(5 * time.Second)
+	for {
+		store.mu.Lock()
+		invocation, err := store.Get(id)
+		changed := store.changed
+		store.mu.Unlock()
+		if err != nil {
+			t.Fatalf("Get() error = %v", err)
+		}
+		if cond(invocation) {
+			return invocation
+		}
+		select {
+		case <-changed:
+		case <-timeout:
+			t.Fatalf("invocation %s did not reach the expected state: %+v", id, invocation)
+		}
+	}
+}
+
+// waitForInvocation waits until the invocation finishes
+func (store *watchedResultStore) waitForInvocation(t *testing.T, id string) Invocation {
+	t.Helper()
+	return store.waitFor(t, id, func(invocation Invocation) bool { return invocation.Status.IsTerminal() })
+}
+
+func TestFaas_InvokeAsync(t *testing.T) {
+	store := newWatchedResultStore()
+	faas, err := NewFaas(context.Background(), WithResultStore(store))
+	if err != nil {
+		t.Fatalf("NewFaas() error = %v", err)
+	}
+	if err = faas.RegisterFunctions([]intf.FunctionFactory{intf.FactoryOf(newEchoFunction)}); err != nil {
+		t.Fatalf("RegisterFunctions() error = %v", err)
+	}
+
+	t.Run("successful invocation", func(t *testing.T) {
+		id, err := faas.InvokeAsync("echo", intf.Payload{"message": "hello"})
+		if err != nil {
+			t.Fatalf("InvokeAsync() error = %v", err)
+		}
+		if id == "" {
+			t.Fatal("InvokeAsync() returned an empty invocation ID")
+		}
+
+		invocation := store.waitForInvocation(t, id)
+		if invocation.Status != SucceededInvocationStatus {
+			t.Errorf("Status = %v, want %v", invocation.Status, SucceededInvocationStatus)
+		}
+		if invocation.FunctionName != "echo" {
+			t.Errorf("FunctionName = %v, want echo", invocation.FunctionName)
+		}
+		if invocation.Output["message"] != "hello" {
+			t.Errorf("Output = %v, want message hello", invocation.Output)
+		}
+		if invocation.QueuedAt.IsZero() || invocation.StartedAt.IsZero() || invocation.FinishedAt.IsZero() {
+			t.Errorf("timings not recorded: %+v", invocation)
+		}
+	})
+
+	t.Run("failed invocation", func(t *testing.T) {
+		id, err := faas.InvokeAsync("slack", intf.Payload{})
+		if err != nil {
+			t.Fatalf("InvokeAsync() error = %v", err)
+		}
+
+		invocation := store.waitForInvocation(t, id)
+		if invocation.Status != FailedInvocationStatus {
+			t.Errorf("Status = %v, want %v", invocation.Status, FailedInvocationStatus)
+		}
+		if invocation.Error == "" {
+			t.Error("Error should describe why the invocation failed")
+		}
+	})
+
+	t.Run("unknown function", func(t *testing.T) {
+		if _, err := faas.InvokeAsync("non_existing", intf.Payload{}); err == nil {
+			t.Error("InvokeAsync() error = nil, want error for unknown function")
+		}
+	})
+
+	t.Run("unknown invocation", func(t *testing.T) {
+		if _, err := faas.GetInvocation("non_existing"); !errors.Is(err, ErrInvocationNotFound) {
+			t.Errorf("GetInvocation() error = %v, want %v", err, ErrInvocationNotFound)
+		}
+	})
+}
+
+// ReleasedEchoFunction closes started and echoes its payload once release
+// is closed
+type ReleasedEchoFunction struct {
+	EchoFunction
+	started chan struct{}
+	release chan struct{}
+}
+
+func (r *ReleasedEchoFunction) Execute(ctx context.Context) (intf.FunctionOutput, error) {
+	close(r.started)
+	<-r.release
+	return r.EchoFunction.Execute(ctx)
+}
+
+func TestFaas_InvokeAsync_RedactsUnregisteredFunction(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	store := newWatchedResultStore()
+	faas := newFaas(context.Background(), WithResultStore(store))
+	if err := faas.RegisterFunctions([]intf.FunctionFactory{func() intf.Function {
+		return &ReleasedEchoFunction{started: started, release: release}
+	}}); err != nil {
+		t.Fatalf("RegisterFunctions() error = %v", err)
+	}
+
+	id, err := faas.InvokeAsync("echo", intf.Payload{"api_key": "SG.secret", "message": "key SG.secret"})
+	if err != nil {
+		t.Fatalf("InvokeAsync() error = %v", err)
+	}
+	<-started
+	if err = faas.UnregisterFunction("echo"); err != nil {
+		t.Fatalf("UnregisterFunction() error = %v", err)
+	}
+	close(release)
+
+	invocation := store.waitForInvocation(t, id)
+	if invocation.Output["api_key"] != helpers.RedactedValue || invocation.Output["message"] != "key "+helpers.RedactedValue {
+		t.Errorf("Output = %v (%s), want the credential redacted", invocation.Output, invocation.Error)
+	}
+}
+
+func TestFaas_InvokeAsync_ReportsRunningStatus(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	store := newWatchedResultStore()
+	faas, err := NewFaas(ctx, WithResultStore(store))
+	if err != nil {
+		t.Fatalf("NewFaas() error = %v", err)
+	}
+	if err = faas.RegisterFunctions([]intf.FunctionFactory{intf.FactoryOf(newBlockingFunction)}); err != nil {
+		t.Fatalf("RegisterFunctions() error = %v", err)
+	}
+
+	id, err := faas.InvokeAsync("blocking", intf.Payload{})
+	if err != nil {
+		t.Fatalf("InvokeAsync() error = %v", err)
+	}
+
+	store.waitFor(t, id, func(invocation Invocation) bool { return invocation.Status == RunningInvocationStatus })
+
+	// Cancelling the Faas context finishes the blocked invocation
+	cancel()
+	if invocation := store.waitForInvocation(t, id); invocation.Status != FailedInvocationStatus {
+		t.Errorf("Status = %v, want %v", invocation.Status, FailedInvocationStatus)
+	}
+}
+
+func TestFaas_InvokeAsync_NestedInvocationID(t *testing.T) {
+	store := newWatchedResultStore()
+	faas := newFaas(context.Background(), WithResultStore(store))
+	if err := faas.RegisterFunctions([]intf.FunctionFactory{
+		intf.FactoryOf(newEchoFunction),
+		func() intf.Function { return &NestedFunction{faas: faas, target: "echo"} },
+	}); err != nil {
+		t.Fatalf("RegisterFunctions() error = %v", err)
+	}
+
+	id, err := faas.InvokeAsync("nested", intf.Payload{})
+	if err != nil {
+		t.Fatalf("InvokeAsync() error = %v", err)
+	}
+	if invocation := store.waitForInvocation(t, id); invocation.Status != SucceededInvocationStatus {
+		t.Fatalf("Status = %v (%s), want %v", invocation.Status, invocation.Error, SucceededInvocationStatus)
+	}
+
+	records, _ := faas.QueryHistory(HistoryQuery{})
+	ids := make(map[string]string)
+	for _, record := range records {
+		ids[record.FunctionName] = record.ID
+	}
+	if ids["nested"] != id || ids["echo"] == "" || ids["echo"] == id {
+		t.Errorf("history IDs = %v, want %s for nested only", ids, id)
+	}
+}
@@ -0,0 +1,273 @@
+package faas
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gsarmaonline/faas/faas/intf"
+)
+
+const (
+	// DefaultMaxCircuitBreakers is how many endpoints keep a breaker before
+	// the least relevant one is dropped
+	DefaultMaxCircuitBreakers = 1000
+)
+
+const (
+	// Circuit states
+	ClosedCircuitState   = CircuitStateT("closed")
+	OpenCircuitState     = CircuitStateT("open")
+	HalfOpenCircuitState = CircuitStateT("half_open")
+)
+
+var (
+	ErrCircuitOpen = errors.New("circuit open")
+)
+
+type (
+	CircuitStateT string
+
+	// CircuitBreakerConfig controls when the circuit of an endpoint opens.
+	// It opens after FailureThreshold consecutive failures and lets a
+	// single probe through once OpenTimeout has passed. A FailureThreshold
+	// of zero disables the breaker.
+	CircuitBreakerConfig struct {
+		FailureThreshold int
+		OpenTimeout      time.Duration
+	}
+
+	// CircuitOpenError is returned without calling the function while the
+	// circuit of its endpoint is open
+	CircuitOpenError struct {
+		Endpoint string
+		RetryAt  time.Time
+	}
+
+	// CircuitBreakerStats is the state of the circuit of an endpoint
+	CircuitBreakerStats struct {
+		Endpoint            string        `json:"endpoint"`
+		State               CircuitStateT `json:"state"`
+		ConsecutiveFailures int           `json:"consecutive_failures"`
+		StateChangedAt      time.Time     `json:"state_changed_at"`
+	}
+
+	// circuitBreakers holds a breaker per endpoint reported by functions
+	// implementing intf.Endpointer, up to maxBreakers
+	circuitBreakers struct {
+		mu            sync.Mutex
+		defaultConfig CircuitBreakerConfig
+		configs       map[string]CircuitBreakerConfig
+		breakers      map[string]*circuitBreaker
+		maxBreakers   int
+		now           func() time.Time
+		logger        *slog.Logger
+	}
+
+	circuitBreaker struct {
+		config              CircuitBreakerConfig
+		state               CircuitStateT
+		consecutiveFailures int
+		stateChangedAt      time.Time
+		probing             bool
+	}
+)
+
+// DefaultCircuitBreakerConfig is used for endpoints without a configured
+// breaker
+func DefaultCircuitBreakerConfig() CircuitBreakerConfig {
+	return CircuitBreakerConfig{
+		FailureThreshold: 5,
+		OpenTimeout:      30 * time.Second,
+	}
+}
+
+func (circuitErr *CircuitOpenError) Error() string {
+	return fmt.Sprintf("circuit of %s is open until %s", circuitErr.Endpoint, circuitErr.RetryAt.Format(time.RFC3339))
+}
+
+func (circuitErr *CircuitOpenError) Is(target error) bool {
+	return target == ErrCircuitOpen
+}
+
+func newCircuitBreakers() *circuitBreakers {
+	return &circuitBreakers{
+		defaultConfig: DefaultCircuitBreakerConfig(),
+		configs:       make(map[string]CircuitBreakerConfig),
+		breakers:      make(map[string]*circuitBreaker),
+		maxBreakers:   DefaultMaxCircuitBreakers,
+		now:           time.Now,
+		logger:        slog.Default(),
+	}
+}
+
+// allow fails with a *CircuitOpenError while the circuit of the endpoint of
+// function is open, or half-open with a probe in flight
+func (breakers *circuitBreakers) allow(function intf.Function) error {
+	breakers.mu.Lock()
+	defer breakers.mu.Unlock()
+
+	endpoint, breaker := breakers.breakerFor(function)
+	if breaker == nil {
+		return nil
+	}
+
+	now := breakers.now()
+	retryAt := breaker.stateChangedAt.Add(breaker.config.OpenTimeout)
+	switch breaker.state {
+	case OpenCircuitState:
+		if now.Before(retryAt) {
+			return &CircuitOpenError{Endpoint: endpoint, RetryAt: retryAt}
+		}
+		breaker.transition(breakers.logger, endpoint, HalfOpenCircuitState, now)
+		breaker.probing = true
+	case HalfOpenCircuitState:
+		if breaker.probing {
+			return &CircuitOpenError{Endpoint: endpoint, RetryAt: now}
+		}
+		breaker.probing = true
+	}
+	return nil
+}
+
+// record feeds the outcome of an execution into the breaker of the endpoint
+// of function
+func (breakers *circuitBreakers) record(function intf.Function, err error) {
+	breakers.mu.Lock()
+	defer breakers.mu.Unlock()
+
+	endpoint, breaker := breakers.breakerFor(function)
+	if breaker == nil {
+		return
+	}
+
+	now := breakers.now()
+	breaker.probing = false
+	if errors.Is(err, context.Canceled) {
+		// Cancelled calls say nothing about the endpoint
+		return
+	}
+	if !isEndpointFailure(err) {
+		breaker.consecutiveFailures = 0
+		if breaker.state != ClosedCircuitState {
+			breaker.transition(breakers.logger, endpoint, ClosedCircuitState, now)
+		}
+		return
+	}
+
+	breaker.consecutiveFailures++
+	if breaker.state == HalfOpenCircuitState || breaker.consecutiveFailures >= breaker.config.FailureThreshold {
+		breaker.transition(breakers.logger, endpoint, OpenCircuitState, now)
+	}
+}
+
+// stats returns the state of every endpoint seen so far, sorted by endpoint
+func (breakers *circuitBreakers) stats() (stats []CircuitBreakerStats) {
+	breakers.mu.Lock()
+	defer breakers.mu.Unlock()
+
+	for endpoint, breaker := range breakers.breakers {
+		stats = append(stats, CircuitBreakerStats{
+			Endpoint:            endpoint,
+			State:               breaker.state,
+			ConsecutiveFailures: breaker.consecutiveFailures,
+			StateChangedAt:      breaker.stateChangedAt,
+		})
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].Endpoint < stats[j].Endpoint
+	})
+	return
+}
+
+// breakerFor returns the breaker of the endpoint of function, creating it on
+// first use. It returns nil if function has no endpoint or its breaker is
+// disabled. The caller must hold mu.
+func (breakers *circuitBreakers) breakerFor(function intf.Function) (endpoint string, breaker *circuitBreaker) {
+	endpointer, ok := function.(intf.Endpointer)
+	if !ok {
+		return
+	}
+	endpoint = endpointer.Endpoint()
+
+	breaker, exists := breakers.breakers[endpoint]
+	if !exists {
+		config, configured := breakers.configs[endpoint]
+		if !configured {
+			config = breakers.defaultConfig
+		}
+		if config.FailureThreshold <= 0 {
+			return endpoint, nil
+		}
+		if breakers.maxBreakers > 0 && len(breakers.breakers) >= breakers.maxBreakers {
+			breakers.evict()
+		}
+		breaker = &circuitBreaker{
+			config:         config,
+			state:          ClosedCircuitState,
+			stateChangedAt: breakers.now(),
+		}
+		breakers.breakers[endpoint] = breaker
+	}
+	return
+}
+
+// evict drops the breaker that holds the least information: the oldest
+// healthy breaker, which behaves like a new one, or else the breaker whose
+// state changed longest ago. The caller must hold mu.
+func (breakers *circuitBreakers) evict() {
+	var (
+		victim  string
+		oldest  *circuitBreaker
+		healthy bool
+	)
+	for endpoint, breaker := range breakers.breakers {
+		isHealthy := breaker.state == ClosedCircuitState && breaker.consecutiveFailures == 0
+		if oldest == nil || (isHealthy && !healthy) ||
+			(isHealthy == healthy && breaker.stateChangedAt.Before(oldest.stateChangedAt)) {
+			victim, oldest, healthy = endpoint, breaker, isHealthy
+		}
+	}
+	delete(breakers.breakers, victim)
+}
+
+func (breaker *circuitBreaker) transition(logger *slog.Logger, endpoint string, state CircuitStateT, now time.Time) {
+	logger.Warn("Circuit state changed", "endpoint", endpoint, "from", breaker.state, "to", state)
+	breaker.state = state
+	breaker.stateChangedAt = now
+}
+
+// isEndpointFailure reports whether err indicates an unhealthy endpoint:
+// timeouts, failed connections and server errors. Rejected requests and
+// rate limits mean the endpoint is up.
+func isEndpointFailure(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+
+	var (
+		providerErr  *intf.ProviderError
+		retryableErr *intf.RetryableError
+	)
+	switch {
+	case errors.As(err, &providerErr):
+		return providerErr.StatusCode == 0 || providerErr.StatusCode >= http.StatusInternalServerError
+	case errors.As(err, &retryableErr):
+		return true
+	}
+	return false
+}
+
+// CircuitBreakerStats returns the circuit state of every endpoint that has
+// been called
+func (faas *Faas) CircuitBreakerStats() []CircuitBreakerStats {
+	return faas.breakers.stats()
+}
@@ -0,0 +1,217 @@
+package faas
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gsarmaonline/faas/faas/intf"
+)
+
+// EndpointFunction calls the endpoint named in its payload and fails with
+// the error stored in failWith, if any
+type EndpointFunction struct {
+	endpoint string
+	failWith *atomic.Value
+	calls    *atomic.Int32
+}
+
+func (e *EndpointFunction) GetConfig() intf.FunctionConfig {
+	return intf.FunctionConfig{Name: "endpoint"}
+}
+
+func (e *EndpointFunction) ParsePayload(payload intf.Payload) error {
+	e.endpoint, _ = payload["endpoint"].(string)
+	return nil
+}
+
+func (e *EndpointFunction) Validate() error {
+	return nil
+}
+
+func (e *EndpointFunction) Endpoint() string {
+	return e.endpoint
+}
+
+func (e *EndpointFunction) Execute(ctx context.Context) (intf.FunctionOutput, error) {
+	e.calls.Add(1)
+	if failure, _ := e.failWith.Load().(endpointFailure); failure.err != nil {
+		return nil, failure.err
+	}
+	return nil, nil
+}
+
+type endpointFailure struct {
+	err error
+}
+
+type endpointFaas struct {
+	*Faas
+	failWith *atomic.Value
+	calls    *atomic.Int32
+	now      time.Time
+}
+
+func newEndpointFaas(t *testing.T, opts ...Option) *endpointFaas {
+	opts = append([]Option{WithDefaultRetryPolicy(NoRetryPolicy)}, opts...)
+	f := &endpointFaas{
+		Faas:     newFaas(context.Background(), opts...),
+		failWith: &atomic.Value{},
+		calls:    &atomic.Int32{},
+		now:      time.Now(),
+	}
+	f.breakers.now = func() time.Time { return f.now }
+	if err := f.RegisterFunctions([]intf.FunctionFactory{func() intf.Function {
+		return &EndpointFunction{failWith: f.failWith, calls: f.calls}
+	}}); err != nil {
+		t.Fatalf("RegisterFunctions() error = %v", err)
+	}
+	return f
+}
+
+func (f *endpointFaas) fail(err error) {
+	f.failWith.Store(endpointFailure{err: err})
+}
+
+func (f *endpointFaas) invoke(endpoint string) error {
+	_, err := f.InvokeFunction(context.Background(), "endpoint", intf.Payload{"endpoint": endpoint})
+	return err
+}
+
+func (f *endpointFaas) state(t *testing.T, endpoint string) CircuitStateT {
+	t.Helper()
+	for _, stats := range f.CircuitBreakerStats() {
+		if stats.Endpoint == endpoint {
+			return stats.State
+		}
+	}
+	t.Fatalf("CircuitBreakerStats() has no entry for %s", endpoint)
+	return ""
+}
+
+func TestFaas_CircuitBreaker(t *testing.T) {
+	f := newEndpointFaas(t, WithCircuitBreaker("sendgrid", CircuitBreakerConfig{FailureThreshold: 3, OpenTimeout: time.Minute}))
+	outage := intf.NewProviderError("sendgrid", 503, errors.New("unavailable"))
+	f.fail(outage)
+
+	for i := 0; i < 3; i++ {
+		if err := f.invoke("sendgrid"); !errors.Is(err, outage) {
+			t.Fatalf("invoke() #%d error = %v, want %v", i+1, err, outage)
+		}
+	}
+	if state := f.state(t, "sendgrid"); state != OpenCircuitState {
+		t.Fatalf("state after 3 failures = %s, want %s", state, OpenCircuitState)
+	}
+
+	// Open circuits fail fast with a typed error
+	err := f.invoke("sendgrid")
+	var circuitErr *CircuitOpenError
+	if !errors.As(err, &circuitErr) || !errors.Is(err, ErrCircuitOpen) || circuitErr.Endpoint != "sendgrid" {
+		t.Fatalf("invoke() on open circuit error = %v, want a *CircuitOpenError", err)
+	}
+	if got := f.calls.Load(); got != 3 {
+		t.Errorf("Execute called %d times, want 3", got)
+	}
+}
+
+func TestFaas_CircuitBreaker_HalfOpen(t *testing.T) {
+	f := newEndpointFaas(t, WithDefaultCircuitBreaker(CircuitBreakerConfig{FailureThreshold: 1, OpenTimeout: time.Minute}))
+	f.fail(intf.NewProviderError("twilio", 0, errors.New("connection refused")))
+
+	f.invoke("twilio")
+	if state := f.state(t, "twilio"); state != OpenCircuitState {
+		t.Fatalf("state = %s, want %s", state, OpenCircuitState)
+	}
+
+	// A failed probe opens the circuit again
+	f.now = f.now.Add(time.Minute)
+	f.invoke("twilio")
+	if state := f.state(t, "twilio"); state != OpenCircuitState {
+		t.Fatalf("state after failed probe = %s, want %s", state, OpenCircuitState)
+	}
+	if err := f.invoke("twilio"); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("invoke() after failed probe error = %v, want %v", err, ErrCircuitOpen)
+	}
+
+	// A successful probe closes it
+	f.now = f.now.Add(time.Minute)
+	f.fail(nil)
+	if err := f.invoke("twilio"); err != nil {
+		t.Fatalf("probe error = %v", err)
+	}
+	if state := f.state(t, "twilio"); state != ClosedCircuitState {
+		t.Errorf("state after successful probe = %s, want %s", state, ClosedCircuitState)
+	}
+	if got := f.calls.Load(); got != 3 {
+		t.Errorf("Execute called %d times, want 3", got)
+	}
+}
+
+func TestFaas_CircuitBreaker_PerEndpoint(t *testing.T) {
+	f := newEndpointFaas(t, WithDefaultCircuitBreaker(CircuitBreakerConfig{FailureThreshold: 1, OpenTimeout: time.Minute}))
+	f.fail(intf.NewProviderError("http", 0, errors.New("no such host")))
+	f.invoke("http:down.example.com")
+
+	f.fail(nil)
+	if err := f.invoke("http:up.example.com"); err != nil {
+		t.Errorf("invoke() on another host error = %v", err)
+	}
+	if state := f.state(t, "http:down.example.com"); state != OpenCircuitState {
+		t.Errorf("state of failing host = %s, want %s", state, OpenCircuitState)
+	}
+	if state := f.state(t, "http:up.example.com"); state != ClosedCircuitState {
+		t.Errorf("state of healthy host = %s, want %s", state, ClosedCircuitState)
+	}
+}
+
+func TestFaas_CircuitBreaker_MaxBreakers(t *testing.T) {
+	f := newEndpointFaas(t,
+		WithDefaultCircuitBreaker(CircuitBreakerConfig{FailureThreshold: 1, OpenTimeout: time.Minute}),
+		WithMaxCircuitBreakers(2),
+	)
+	f.fail(intf.NewProviderError("http", 0, errors.New("no such host")))
+	f.invoke("http:down.example.com")
+	f.fail(nil)
+	for _, endpoint := range []string{"http:a.example.com", "http:b.example.com", "http:c.example.com"} {
+		f.now = f.now.Add(time.Second)
+		f.invoke(endpoint)
+	}
+
+	var endpoints []string
+	for _, stats := range f.CircuitBreakerStats() {
+		endpoints = append(endpoints, stats.Endpoint)
+	}
+	if want := []string{"http:c.example.com", "http:down.example.com"}; !reflect.DeepEqual(endpoints, want) {
+		t.Errorf("endpoints = %v, want %v", endpoints, want)
+	}
+	if err := f.invoke("http:down.example.com"); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("invoke() on the failing host error = %v, want %v", err, ErrCircuitOpen)
+	}
+}
+
+func TestIsEndpointFailure(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "success", err: nil, want: false},
+		{name: "timeout", err: context.DeadlineExceeded, want: true},
+		{name: "connection failure", err: intf.NewProviderError("twilio", 0, errors.New("refused")), want: true},
+		{name: "server error", err: intf.NewProviderError("slack", 502, errors.New("bad gateway")), want: true},
+		{name: "rate limited", err: intf.NewProviderError("slack", 429, errors.New("slow down")), want: false},
+		{name: "rejected request", err: intf.NewProviderError("sendgrid", 400, errors.New("bad request")), want: false},
+		{name: "invalid input", err: errors.New("channel_not_found"), want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isEndpointFailure(tt.err); got != tt.want {
+				t.Errorf("isEndpointFailure(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
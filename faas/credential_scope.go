@@ -0,0 +1,180 @@
+package faas
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/gsarmaonline/faas/faas/intf"
+)
+
+const (
+	// Outcomes of a credential access
+	ResolvedCredentialAccess = CredentialAccessT("resolved")
+	MissingCredentialAccess  = CredentialAccessT("missing")
+	DeniedCredentialAccess   = CredentialAccessT("denied")
+	FailedCredentialAccess   = CredentialAccessT("failed")
+)
+
+var (
+	ErrCredentialDenied = errors.New("credential outside the scope of the function")
+)
+
+type (
+	CredentialAccessT string
+
+	// CredentialAuditRecord is the audit record of a credential lookup made
+	// by a function. It never holds the credential value.
+	CredentialAuditRecord struct {
+		InvocationID string            `json:"invocation_id"`
+		FunctionName string            `json:"function_name"`
+		Caller       string            `json:"caller,omitempty"`
+		Key          string            `json:"key"`
+		Access       CredentialAccessT `json:"access"`
+		Time         time.Time         `json:"time"`
+	}
+
+	// CredentialAuditLog records every credential lookup. A lookup fails if
+	// its record cannot be written.
+	CredentialAuditLog interface {
+		Record(record CredentialAuditRecord) error
+	}
+
+	// LogCredentialAuditLog writes audit records to a logger, denied
+	// lookups at warning level
+	LogCredentialAuditLog struct {
+		logger *slog.Logger
+	}
+
+	// MemoryCredentialAuditLog is a CredentialAuditLog that keeps up to
+	// maxSize records in memory
+	MemoryCredentialAuditLog struct {
+		mu      sync.Mutex
+		maxSize int
+		records []CredentialAuditRecord
+	}
+
+	// scopedCredentialResolver restricts the resolver of an invocation to
+	// the credential scope of the function and audits every lookup
+	scopedCredentialResolver struct {
+		resolver intf.CredentialResolver
+		scope    map[string]bool
+		auditLog CredentialAuditLog
+		// record is the template of the audit records
+		record CredentialAuditRecord
+	}
+)
+
+func NewLogCredentialAuditLog(logger *slog.Logger) *LogCredentialAuditLog {
+	return &LogCredentialAuditLog{logger: logger}
+}
+
+func (auditLog *LogCredentialAuditLog) Record(record CredentialAuditRecord) error {
+	level := slog.LevelInfo
+	if record.Access == DeniedCredentialAccess {
+		level = slog.LevelWarn
+	}
+	attrs := []any{
+		FunctionLogKey, record.FunctionName,
+		InvocationIDLogKey, record.InvocationID,
+		"key", record.Key,
+		"access", string(record.Access),
+	}
+	if record.Caller != "" {
+		attrs = append(attrs, "caller", record.Caller)
+	}
+	auditLog.logger.Log(context.Background(), level, "Credential access", attrs...)
+	return nil
+}
+
+func NewMemoryCredentialAuditLog(maxSize int) *MemoryCredentialAuditLog {
+	return &MemoryCredentialAuditLog{maxSize: maxSize}
+}
+
+func (auditLog *MemoryCredentialAuditLog) Record(record CredentialAuditRecord) error {
+	auditLog.mu.Lock()
+	defer auditLog.mu.Unlock()
+
+	auditLog.records = append(auditLog.records, record)
+	if auditLog.maxSize > 0 && len(auditLog.records) > auditLog.maxSize {
+		auditLog.records = append([]CredentialAuditRecord(nil), auditLog.records[len(auditLog.records)-auditLog.maxSize:]...)
+	}
+	return nil
+}
+
+// Records returns the kept records, oldest first
+func (auditLog *MemoryCredentialAuditLog) Records() []CredentialAuditRecord {
+	auditLog.mu.Lock()
+	defer auditLog.mu.Unlock()
+
+	return append([]CredentialAuditRecord(nil), auditLog.records...)
+}
+
+// SetCredentialScope grants the named registered function exactly keys, like
+// WithCredentialScope. Use it to grant credentials to a function after
+// ReplaceFunction, which drops its scope.
+func (faas *Faas) SetCredentialScope(name string, keys ...string) (err error) {
+	faas.mu.Lock()
+	defer faas.mu.Unlock()
+
+	if _, exists := faas.functions[name]; !exists {
+		err = fmt.Errorf("function with name %s does not exist", name)
+		return
+	}
+	faas.credentialScopes[name] = keys
+	return
+}
+
+// scopeCredentials wraps the resolver of an invocation so that it only
+// resolves the keys the operator granted to the function. The keys a
+// function declares in its config grant nothing by themselves.
+func (faas *Faas) scopeCredentials(ctx context.Context, id, name string, resolver intf.CredentialResolver) intf.CredentialResolver {
+	faas.mu.RLock()
+	keys := faas.credentialScopes[name]
+	faas.mu.RUnlock()
+
+	scoped := &scopedCredentialResolver{
+		resolver: resolver,
+		scope:    make(map[string]bool),
+		auditLog: faas.credentialAudit,
+		record: CredentialAuditRecord{
+			InvocationID: id,
+			FunctionName: name,
+			Caller:       CallerFromContext(ctx),
+		},
+	}
+	for _, key := range keys {
+		scoped.scope[key] = true
+	}
+	return scoped
+}
+
+// ResolveCredential implements intf.CredentialResolver
+func (scoped *scopedCredentialResolver) ResolveCredential(key string) (value string, err error) {
+	access := DeniedCredentialAccess
+	if scoped.scope[key] {
+		value, err = scoped.resolver.ResolveCredential(key)
+		switch {
+		case err != nil:
+			access = FailedCredentialAccess
+		case value == "":
+			access = MissingCredentialAccess
+		default:
+			access = ResolvedCredentialAccess
+		}
+	} else {
+		err = fmt.Errorf("%s: %w", key, ErrCredentialDenied)
+	}
+
+	record := scoped.record
+	record.Key = key
+	record.Access = access
+	record.Time = time.Now()
+	if auditErr := scoped.auditLog.Record(record); auditErr != nil {
+		return "", fmt.Errorf("recording access to credential %s: %w", key, auditErr)
+	}
+	return
+}
@@ -0,0 +1,307 @@
+package faas
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gsarmaonline/faas/faas/helpers"
+	"github.com/gsarmaonline/faas/faas/intf"
+)
+
+// ScopedFunction resolves the credential named by the "key" field of its
+// payload
+type ScopedFunction struct {
+	helpers.Credentials
+	EchoFunction
+}
+
+func (s *ScopedFunction) GetConfig() intf.FunctionConfig {
+	return intf.FunctionConfig{Name: "scoped", Credentials: []string{"TEST_SCOPED_TOKEN", "TEST_SCOPED_MISSING"}}
+}
+
+func (s *ScopedFunction) ParsePayload(payload intf.Payload) (err error) {
+	_, err = s.CredentialManager().ResolveCredential(nil, payload["key"].(string))
+	return
+}
+
+// ContextScopedFunction resolves the credential named by the "key" field of
+// its payload through the resolver in the context of Execute
+type ContextScopedFunction struct {
+	EchoFunction
+}
+
+func (s *ContextScopedFunction) GetConfig() intf.FunctionConfig {
+	return intf.FunctionConfig{Name: "context_scoped", Credentials: []string{"TEST_SCOPED_TOKEN"}}
+}
+
+func (s *ContextScopedFunction) Execute(ctx context.Context) (intf.FunctionOutput, error) {
+	value, err := helpers.CredentialManagerFromContext(ctx).ResolveCredential(nil, s.Input["key"].(string))
+	return EchoOutput{Payload: intf.Payload{"value": value}}, err
+}
+
+type failingCredentialAuditLog struct{}
+
+func (failingCredentialAuditLog) Record(record CredentialAuditRecord) error {
+	return errors.New("audit log unavailable")
+}
+
+func newScopedFaas(t *testing.T, opts ...Option) *Faas {
+	t.Helper()
+	dir := t.TempDir()
+	for _, key := range []string{"TEST_SCOPED_TOKEN", "TEST_OTHER_TOKEN"} {
+		if err := os.WriteFile(filepath.Join(dir, key), []byte(key+"-value"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	opts = append([]Option{
+		WithDefaultRetryPolicy(NoRetryPolicy),
+		WithSecretProvider(helpers.FileSecretProvider{Dir: dir}),
+		WithCredentialScope("scoped", "TEST_SCOPED_TOKEN", "TEST_SCOPED_MISSING"),
+	}, opts...)
+	faas := newFaas(context.Background(), opts...)
+	if err := faas.RegisterFunctions([]intf.FunctionFactory{
+		func() intf.Function { return &ScopedFunction{} },
+		func() intf.Function { return &ContextScopedFunction{} },
+	}); err != nil {
+		t.Fatalf("RegisterFunctions() error = %v", err)
+	}
+	return faas
+}
+
+func TestFaas_CredentialScope(t *testing.T) {
+	tests := []struct {
+		name       string
+		opts       []Option
+		key        string
+		wantDenied bool
+		wantAccess CredentialAccessT
+	}{
+		{
+			name:       "granted credential",
+			key:        "TEST_SCOPED_TOKEN",
+			wantAccess: ResolvedCredentialAccess,
+		},
+		{
+			name:       "granted credential without a value",
+			key:        "TEST_SCOPED_MISSING",
+			wantAccess: MissingCredentialAccess,
+		},
+		{
+			name:       "credential that was not granted",
+			key:        "TEST_OTHER_TOKEN",
+			wantDenied: true,
+			wantAccess: DeniedCredentialAccess,
+		},
+		{
+			name:       "scope option grants another credential",
+			opts:       []Option{WithCredentialScope("scoped", "TEST_OTHER_TOKEN")},
+			key:        "TEST_OTHER_TOKEN",
+			wantAccess: ResolvedCredentialAccess,
+		},
+		{
+			name:       "declared credential without a grant",
+			opts:       []Option{WithCredentialScope("scoped")},
+			key:        "TEST_SCOPED_TOKEN",
+			wantDenied: true,
+			wantAccess: DeniedCredentialAccess,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			auditLog := NewMemoryCredentialAuditLog(0)
+			faas := newScopedFaas(t, append(tt.opts, WithCredentialAuditLog(auditLog))...)
+
+			ctx := WithCaller(context.Background(), "tester")
+			_, err := faas.InvokeFunction(ctx, "scoped", intf.Payload{"key": tt.key})
+			if tt.wantDenied {
+				var invErr *InvocationError
+				if !errors.Is(err, ErrCredentialDenied) || !errors.As(err, &invErr) || invErr.Stage != ParseStage {
+					t.Errorf("InvokeFunction() error = %v, want ErrCredentialDenied at parse stage", err)
+				}
+			} else if err != nil {
+				t.Errorf("InvokeFunction() error = %v", err)
+			}
+
+			records := auditLog.Records()
+			if len(records) != 1 {
+				t.Fatalf("audit records = %+v, want 1", records)
+			}
+			record := records[0]
+			if record.FunctionName != "scoped" || record.Caller != "tester" || record.Key != tt.key ||
+				record.Access != tt.wantAccess || record.InvocationID == "" || record.Time.IsZero() {
+				t.Errorf("audit record = %+v, want a %s access to %s", record, tt.wantAccess, tt.key)
+			}
+		})
+	}
+}
+
+func TestFaas_CredentialScopeFromContext(t *testing.T) {
+	auditLog := NewMemoryCredentialAuditLog(0)
+	faas := newScopedFaas(t, WithCredentialAuditLog(auditLog), WithCredentialScope("context_scoped", "TEST_OTHER_TOKEN"))
+
+	output, err := faas.InvokeFunction(context.Background(), "context_scoped", intf.Payload{"key": "TEST_OTHER_TOKEN"})
+	if err != nil {
+		t.Fatalf("InvokeFunction() error = %v", err)
+	}
+	if payload, _ := output.GetPayload(); payload["value"] != "TEST_OTHER_TOKEN-value" {
+		t.Errorf("InvokeFunction() = %v, want the granted credential", payload)
+	}
+	// The declared key is not granted
+	if _, err = faas.InvokeFunction(context.Background(), "context_scoped", intf.Payload{"key": "TEST_SCOPED_TOKEN"}); !errors.Is(err, ErrCredentialDenied) {
+		t.Errorf("InvokeFunction() error = %v, want ErrCredentialDenied", err)
+	}
+
+	var accesses []CredentialAccessT
+	for _, record := range auditLog.Records() {
+		accesses = append(accesses, record.Access)
+	}
+	if want := []CredentialAccessT{ResolvedCredentialAccess, DeniedCredentialAccess}; !reflect.DeepEqual(accesses, want) {
+		t.Errorf("audited accesses = %v, want %v", accesses, want)
+	}
+}
+
+func TestFaas_CredentialScope_DroppedWithFunction(t *testing.T) {
+	faas := newScopedFaas(t, WithCredentialAuditLog(NewMemoryCredentialAuditLog(0)))
+	payload := intf.Payload{"key": "TEST_SCOPED_TOKEN"}
+	factory := func() intf.Function { return &ScopedFunction{} }
+
+	if err := faas.UnregisterFunction("scoped"); err != nil {
+		t.Fatalf("UnregisterFunction() error = %v", err)
+	}
+	if err := faas.RegisterFunctions([]intf.FunctionFactory{factory}); err != nil {
+		t.Fatalf("RegisterFunctions() error = %v", err)
+	}
+	if _, err := faas.InvokeFunction(context.Background(), "scoped", payload); !errors.Is(err, ErrCredentialDenied) {
+		t.Errorf("InvokeFunction() after re-registering error = %v, want ErrCredentialDenied", err)
+	}
+
+	if err := faas.SetCredentialScope("scoped", "TEST_SCOPED_TOKEN"); err != nil {
+		t.Fatalf("SetCredentialScope() error = %v", err)
+	}
+	if _, err := faas.InvokeFunction(context.Background(), "scoped", payload); err != nil {
+		t.Errorf("InvokeFunction() after SetCredentialScope() error = %v", err)
+	}
+
+	if err := faas.ReplaceFunction(factory); err != nil {
+		t.Fatalf("ReplaceFunction() error = %v", err)
+	}
+	if _, err := faas.InvokeFunction(context.Background(), "scoped", payload); !errors.Is(err, ErrCredentialDenied) {
+		t.Errorf("InvokeFunction() after ReplaceFunction() error = %v, want ErrCredentialDenied", err)
+	}
+
+	if err := faas.SetCredentialScope("non_existing", "TEST_SCOPED_TOKEN"); err == nil {
+		t.Error("SetCredentialScope() error = nil, want error for unknown function")
+	}
+}
+
+func TestFaas_CredentialAuditFailure(t *testing.T) {
+	faas := newScopedFaas(t, WithCredentialAuditLog(failingCredentialAuditLog{}))
+
+	_, err := faas.InvokeFunction(context.Background(), "scoped", intf.Payload{"key": "TEST_SCOPED_TOKEN"})
+	if err == nil || !strings.Contains(err.Error(), "audit log unavailable") {
+		t.Errorf("InvokeFunction() error = %v, want the audit error", err)
+	}
+}
+
+func TestLogCredentialAuditLog(t *testing.T) {
+	out := &bytes.Buffer{}
+	faas := newScopedFaas(t, WithLogger(slog.New(slog.NewTextHandler(out, nil))))
+
+	faas.InvokeFunction(context.Background(), "scoped", intf.Payload{"key": "TEST_SCOPED_TOKEN"})
+	faas.InvokeFunction(context.Background(), "scoped", intf.Payload{"key": "TEST_OTHER_TOKEN"})
+
+	logs := out.String()
+	for _, want := range []string{
+		`level=INFO msg="Credential access" function=scoped`,
+		"key=TEST_SCOPED_TOKEN access=resolved",
+		`level=WARN msg="Credential access" function=scoped`,
+		"key=TEST_OTHER_TOKEN access=denied",
+	} {
+		if !strings.Contains(logs, want) {
+			t.Errorf("logs = %s, want %q", logs, want)
+		}
+	}
+	if strings.Contains(logs, "TEST_SCOPED_TOKEN-value") {
+		t.Errorf("logs = %s, contain the credential value", logs)
+	}
+}
+
+func TestMemoryCredentialAuditLog(t *testing.T) {
+	auditLog := NewMemoryCredentialAuditLog(2)
+	for _, key := range []string{"A", "B", "C"} {
+		if err := auditLog.Record(CredentialAuditRecord{Key: key}); err != nil {
+			t.Fatalf("Record() error = %v", err)
+		}
+	}
+
+	var keys []string
+	for _, record := range auditLog.Records() {
+		keys = append(keys, record.Key)
+	}
+	if want := []string{"B", "C"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("Records() keys = %v, want %v", keys, want)
+	}
+}
+
+func TestNewFaas_CredentialScopeOverride(t *testing.T) {
+	faas, err := NewFaas(context.Background(), WithCredentialScope("github"))
+	if err != nil {
+		t.Fatalf("NewFaas() error = %v", err)
+	}
+	if granted, exists := faas.credentialScopes["github"]; !exists || len(granted) != 0 {
+		t.Errorf("github granted credentials = %v, want none", granted)
+	}
+}
+
+func TestNewFaas_BuiltinCredentialsAreScoped(t *testing.T) {
+	t.Setenv(helpers.EnvSlackAPIToken, "xoxb-env-token")
+	faas, err := NewFaas(context.Background(),
+		WithCredentialScope("slack"),
+		WithCredentialAuditLog(NewMemoryCredentialAuditLog(0)),
+	)
+	if err != nil {
+		t.Fatalf("NewFaas() error = %v", err)
+	}
+
+	_, err = faas.InvokeFunction(context.Background(), "slack", intf.Payload{"channel_id": "C1", "message": "hi"})
+	if !errors.Is(err, ErrCredentialDenied) {
+		t.Errorf("InvokeFunction() error = %v, want the environment token denied", err)
+	}
+}
+
+func TestNewFaas_CredentialScopes(t *testing.T) {
+	faas, err := NewFaas(context.Background())
+	if err != nil {
+		t.Fatalf("NewFaas() error = %v", err)
+	}
+
+	tests := map[string][]string{
+		"slack":           {helpers.EnvSlackAPIToken},
+		"email":           {helpers.EnvSendGridAPIKey},
+		"sms":             {helpers.EnvTwilioAccountSID, helpers.EnvTwilioAuthToken},
+		"docker_registry": {helpers.EnvDockerRegistryUsername, helpers.EnvDockerRegistryPassword},
+		"github":          {helpers.EnvGitHubToken},
+		"http":            nil,
+		"logger":          nil,
+	}
+	for name, want := range tests {
+		config, err := faas.DescribeFunction(name)
+		if err != nil {
+			t.Fatalf("DescribeFunction(%s) error = %v", name, err)
+		}
+		if !reflect.DeepEqual(config.Credentials, want) {
+			t.Errorf("%s credentials = %v, want %v", name, config.Credentials, want)
+		}
+		if granted := faas.credentialScopes[name]; !reflect.DeepEqual(granted, want) {
+			t.Errorf("%s granted credentials = %v, want %v", name, granted, want)
+		}
+	}
+}
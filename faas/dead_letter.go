@@ -0,0 +1,240 @@
+package faas
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/gsarmaonline/faas/faas/helpers"
+	"github.com/gsarmaonline/faas/faas/intf"
+)
+
+const (
+	// DefaultMaxDeadLetters is how many dead letters the default store keeps
+	// before it drops the oldest ones
+	DefaultMaxDeadLetters = 10000
+)
+
+var (
+	ErrDeadLetterNotFound = errors.New("dead letter not found")
+)
+
+type (
+	redriveOfKeyT struct{}
+
+	// RedriveOptions control how a dead letter is redriven
+	RedriveOptions struct {
+		// Overrides are merged into the payload of the letter, replacing
+		// top-level fields, e.g. to pass credentials that were redacted
+		Overrides intf.Payload
+		// DefaultCredentials redrives a letter whose credentials were
+		// redacted and not overridden with the default credentials of the
+		// function, such as its environment variables
+		DefaultCredentials bool
+	}
+
+	// DeadLetter is an invocation that failed at the execute stage after its
+	// final attempt. It keeps everything needed to inspect and redrive it.
+	DeadLetter struct {
+		ID           string           `json:"id"`
+		FunctionName string           `json:"function_name"`
+		Payload      intf.Payload     `json:"payload"`
+		Stage        InvocationStageT `json:"stage"`
+		Error        string           `json:"error"`
+		// ErrorChain holds the messages of the wrapped errors, outermost
+		// first
+		ErrorChain     []string  `json:"error_chain"`
+		Attempts       int       `json:"attempts"`
+		FirstAttemptAt time.Time `json:"first_attempt_at"`
+		FailedAt       time.Time `json:"failed_at"`
+	}
+
+	// DeadLetterStore keeps failed invocations until they are redriven or
+	// purged. List returns dead letters oldest first.
+	DeadLetterStore interface {
+		Add(letter DeadLetter) error
+		Get(id string) (DeadLetter, error)
+		List() ([]DeadLetter, error)
+		Delete(id string) error
+		Purge() error
+	}
+
+	// MemoryDeadLetterStore is a DeadLetterStore that keeps up to maxSize
+	// dead letters in memory
+	MemoryDeadLetterStore struct {
+		mu      sync.Mutex
+		maxSize int
+		letters map[string]DeadLetter
+		order   []string
+	}
+)
+
+func NewMemoryDeadLetterStore(maxSize int) *MemoryDeadLetterStore {
+	return &MemoryDeadLetterStore{
+		maxSize: maxSize,
+		letters: make(map[string]DeadLetter),
+	}
+}
+
+func (store *MemoryDeadLetterStore) Add(letter DeadLetter) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if _, exists := store.letters[letter.ID]; !exists {
+		store.order = append(store.order, letter.ID)
+	}
+	store.letters[letter.ID] = letter
+
+	for store.maxSize > 0 && len(store.letters) > store.maxSize {
+		delete(store.letters, store.order[0])
+		store.order = store.order[1:]
+	}
+	return nil
+}
+
+func (store *MemoryDeadLetterStore) Get(id string) (DeadLetter, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	letter, exists := store.letters[id]
+	if !exists {
+		return DeadLetter{}, ErrDeadLetterNotFound
+	}
+	return letter, nil
+}
+
+func (store *MemoryDeadLetterStore) List() ([]DeadLetter, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	letters := make([]DeadLetter, 0, len(store.order))
+	for _, id := range store.order {
+		letters = append(letters, store.letters[id])
+	}
+	return letters, nil
+}
+
+func (store *MemoryDeadLetterStore) Delete(id string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if _, exists := store.letters[id]; !exists {
+		return ErrDeadLetterNotFound
+	}
+	delete(store.letters, id)
+	for idx, orderedID := range store.order {
+		if orderedID == id {
+			store.order = append(store.order[:idx], store.order[idx+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+func (store *MemoryDeadLetterStore) Purge() error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	store.letters = make(map[string]DeadLetter)
+	store.order = nil
+	return nil
+}
+
+// ListDeadLetters returns the dead letters of the named function, or of all
+// functions when name is empty, oldest first
+func (faas *Faas) ListDeadLetters(name string) (letters []DeadLetter, err error) {
+	var all []DeadLetter
+	if all, err = faas.deadLetters.List(); err != nil {
+		return
+	}
+	for _, letter := range all {
+		if name == "" || letter.FunctionName == name {
+			letters = append(letters, letter)
+		}
+	}
+	return
+}
+
+// GetDeadLetter returns a single dead letter
+func (faas *Faas) GetDeadLetter(id string) (DeadLetter, error) {
+	return faas.deadLetters.Get(id)
+}
+
+// RedriveDeadLetter invokes the function of a dead letter again with its
+// original payload and removes the letter once the invocation succeeds. A
+// failed redrive keeps the letter; if it fails at the execute stage again,
+// the letter is updated with the new error and attempts.
+//
+// Credential fields that were redacted from the payload are not sent again.
+// The redrive fails with ErrRedactedCredentials unless opts overrides them
+// or allows the default credentials of the function.
+func (faas *Faas) RedriveDeadLetter(ctx context.Context, id string, opts RedriveOptions) (output intf.FunctionOutput, err error) {
+	var letter DeadLetter
+	if letter, err = faas.deadLetters.Get(id); err != nil {
+		return
+	}
+	if fields := missingCredentials(letter.Payload, opts.Overrides); len(fields) > 0 && !opts.DefaultCredentials {
+		err = redactedCredentialsError(fields)
+		return
+	}
+
+	ctx = context.WithValue(ctx, redriveOfKeyT{}, id)
+	if output, err = faas.InvokeFunction(ctx, letter.FunctionName, resendPayload(letter.Payload, opts.Overrides)); err != nil {
+		return
+	}
+	// A concurrent redrive may have removed the letter already
+	if deleteErr := faas.deadLetters.Delete(id); deleteErr != nil && !errors.Is(deleteErr, ErrDeadLetterNotFound) {
+		err = deleteErr
+	}
+	return
+}
+
+// PurgeDeadLetters removes all dead letters
+func (faas *Faas) PurgeDeadLetters() error {
+	return faas.deadLetters.Purge()
+}
+
+// deadLetter records an invocation that failed at the execute stage with its
+// credentials redacted. Invocations cancelled by their caller are not dead
+// lettered. A failed redrive updates the letter it redrove, given by
+// redriveOf.
+func (faas *Faas) deadLetter(ctx context.Context, name, redriveOf string, config intf.FunctionConfig, payload intf.Payload, err error, firstAttemptAt time.Time) {
+	var invErr *InvocationError
+	if !errors.As(err, &invErr) || invErr.Stage != ExecuteStage || errors.Is(err, context.Canceled) {
+		return
+	}
+
+	redactor := helpers.RedactorFromContext(ctx)
+	letter := DeadLetter{
+		ID:             newInvocationID(),
+		FunctionName:   name,
+		Payload:        redactor.Payload(config.InputSchema, payload),
+		Stage:          invErr.Stage,
+		Error:          redactor.String(err.Error()),
+		ErrorChain:     errorChain(redactor, err),
+		Attempts:       invErr.Attempts,
+		FirstAttemptAt: firstAttemptAt,
+		FailedAt:       time.Now(),
+	}
+	if redriveOf != "" {
+		// Keep the recorded payload, which tells which credentials were
+		// redacted
+		if original, getErr := faas.deadLetters.Get(redriveOf); getErr == nil && original.FunctionName == name {
+			letter.ID = original.ID
+			letter.Payload = original.Payload
+			letter.Attempts += original.Attempts
+			letter.FirstAttemptAt = original.FirstAttemptAt
+		}
+	}
+	if storeErr := faas.deadLetters.Add(letter); storeErr != nil {
+		faas.logger.Error("Failed to dead letter invocation", FunctionLogKey, name, "error", storeErr)
+	}
+}
+
+func errorChain(redactor *helpers.Redactor, err error) (chain []string) {
+	for ; err != nil; err = errors.Unwrap(err) {
+		chain = append(chain, redactor.String(err.Error()))
+	}
+	return
+}
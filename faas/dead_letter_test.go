@@ -0,0 +1,219 @@
+package faas
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gsarmaonline/faas/faas/helpers"
+	"github.com/gsarmaonline/faas/faas/intf"
+)
+
+func TestMemoryDeadLetterStore(t *testing.T) {
+	store := NewMemoryDeadLetterStore(2)
+	for _, id := range []string{"a", "b", "c"} {
+		if err := store.Add(DeadLetter{ID: id}); err != nil {
+			t.Fatalf("Add() error = %v", err)
+		}
+	}
+
+	if _, err := store.Get("a"); !errors.Is(err, ErrDeadLetterNotFound) {
+		t.Errorf("Get() of the oldest letter error = %v, want %v", err, ErrDeadLetterNotFound)
+	}
+	letters, _ := store.List()
+	if len(letters) != 2 || letters[0].ID != "b" || letters[1].ID != "c" {
+		t.Errorf("List() = %+v, want b and c", letters)
+	}
+
+	if err := store.Delete("b"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if err := store.Delete("b"); !errors.Is(err, ErrDeadLetterNotFound) {
+		t.Errorf("Delete() twice error = %v, want %v", err, ErrDeadLetterNotFound)
+	}
+	if err := store.Purge(); err != nil {
+		t.Fatalf("Purge() error = %v", err)
+	}
+	if letters, _ := store.List(); len(letters) != 0 {
+		t.Errorf("List() after Purge() = %+v, want empty", letters)
+	}
+}
+
+func TestFaas_DeadLetters(t *testing.T) {
+	unavailable := intf.NewProviderError("test", 503, errors.New("unavailable"))
+	faas, calls := newFlakyFaas(t, 3, unavailable, WithDefaultRetryPolicy(fastRetryPolicy(2)))
+	payload := intf.Payload{"message": "hello"}
+
+	before := time.Now()
+	if _, err := faas.InvokeFunction(context.Background(), "flaky", payload); err == nil {
+		t.Fatal("InvokeFunction() error = nil, want error")
+	}
+
+	letters, err := faas.ListDeadLetters("flaky")
+	if err != nil {
+		t.Fatalf("ListDeadLetters() error = %v", err)
+	}
+	if len(letters) != 1 {
+		t.Fatalf("ListDeadLetters() = %d letters, want 1", len(letters))
+	}
+	letter := letters[0]
+	if letter.FunctionName != "flaky" || letter.Stage != ExecuteStage || letter.Attempts != 2 {
+		t.Errorf("dead letter = %+v, want flaky failing at execute after 2 attempts", letter)
+	}
+	if letter.Payload["message"] != "hello" {
+		t.Errorf("dead letter payload = %v, want %v", letter.Payload, payload)
+	}
+	if len(letter.ErrorChain) < 2 || letter.ErrorChain[len(letter.ErrorChain)-1] != "unavailable" {
+		t.Errorf("dead letter error chain = %v, want it to end with the root cause", letter.ErrorChain)
+	}
+	if letter.FirstAttemptAt.Before(before) || letter.FailedAt.Before(letter.FirstAttemptAt) {
+		t.Errorf("dead letter timestamps = %v..%v, want after %v", letter.FirstAttemptAt, letter.FailedAt, before)
+	}
+	if got, err := faas.GetDeadLetter(letter.ID); err != nil || got.ID != letter.ID {
+		t.Errorf("GetDeadLetter() = %+v, %v", got, err)
+	}
+	if letters, _ := faas.ListDeadLetters("other"); len(letters) != 0 {
+		t.Errorf("ListDeadLetters(other) = %+v, want empty", letters)
+	}
+
+	// The third call succeeds, so the redrive removes the letter for good
+	if _, err := faas.RedriveDeadLetter(context.Background(), letter.ID, RedriveOptions{}); err != nil {
+		t.Fatalf("RedriveDeadLetter() error = %v", err)
+	}
+	if got := calls.Load(); got != 4 {
+		t.Errorf("Execute called %d times, want 4", got)
+	}
+	if letters, _ := faas.ListDeadLetters(""); len(letters) != 0 {
+		t.Errorf("ListDeadLetters() after redrive = %+v, want empty", letters)
+	}
+	if _, err := faas.RedriveDeadLetter(context.Background(), letter.ID, RedriveOptions{}); !errors.Is(err, ErrDeadLetterNotFound) {
+		t.Errorf("RedriveDeadLetter() twice error = %v, want %v", err, ErrDeadLetterNotFound)
+	}
+}
+
+func TestFaas_RedriveDeadLetter_KeepsLetterOnFailure(t *testing.T) {
+	unavailable := intf.NewProviderError("test", 503, errors.New("unavailable"))
+	faas, _ := newFlakyFaas(t, 10, unavailable, WithDefaultRetryPolicy(fastRetryPolicy(2)))
+	faas.InvokeFunction(context.Background(), "flaky", intf.Payload{})
+	letters, _ := faas.ListDeadLetters("flaky")
+	if len(letters) != 1 {
+		t.Fatalf("ListDeadLetters() = %+v, want 1 letter", letters)
+	}
+	original := letters[0]
+
+	if _, err := faas.RedriveDeadLetter(context.Background(), original.ID, RedriveOptions{}); err == nil {
+		t.Fatal("RedriveDeadLetter() error = nil, want the function to fail again")
+	}
+	letters, _ = faas.ListDeadLetters("")
+	if len(letters) != 1 || letters[0].ID != original.ID || letters[0].Attempts != 4 ||
+		!letters[0].FirstAttemptAt.Equal(original.FirstAttemptAt) || !letters[0].FailedAt.After(original.FailedAt) {
+		t.Errorf("ListDeadLetters() after a failed redrive = %+v, want %s updated with 4 attempts", letters, original.ID)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := faas.RedriveDeadLetter(ctx, original.ID, RedriveOptions{}); !errors.Is(err, context.Canceled) {
+		t.Errorf("RedriveDeadLetter() with a cancelled context error = %v, want %v", err, context.Canceled)
+	}
+	if _, err := faas.GetDeadLetter(original.ID); err != nil {
+		t.Errorf("GetDeadLetter() after a cancelled redrive error = %v, want the letter kept", err)
+	}
+}
+
+func TestFaas_RedriveDeadLetter_NestedFailure(t *testing.T) {
+	unavailable := intf.NewProviderError("test", 503, errors.New("unavailable"))
+	faas, _ := newFlakyFaas(t, 10, unavailable, WithDefaultRetryPolicy(NoRetryPolicy))
+	if err := faas.RegisterFunctions([]intf.FunctionFactory{func() intf.Function {
+		return &NestedFunction{faas: faas, target: "flaky"}
+	}}); err != nil {
+		t.Fatalf("RegisterFunctions() error = %v", err)
+	}
+	faas.InvokeFunction(context.Background(), "nested", intf.Payload{})
+	letters, _ := faas.ListDeadLetters("nested")
+	if len(letters) != 1 {
+		t.Fatalf("ListDeadLetters() = %+v, want 1 letter", letters)
+	}
+	original := letters[0]
+
+	if _, err := faas.RedriveDeadLetter(context.Background(), original.ID, RedriveOptions{}); err == nil {
+		t.Fatal("RedriveDeadLetter() error = nil, want the function to fail again")
+	}
+	if letters, _ := faas.ListDeadLetters("flaky"); len(letters) != 2 {
+		t.Errorf("ListDeadLetters(flaky) = %+v, want a letter for each failed nested invocation", letters)
+	}
+	if letter, err := faas.GetDeadLetter(original.ID); err != nil || letter.FunctionName != "nested" || letter.Attempts != 2 {
+		t.Errorf("GetDeadLetter() = %+v, %v; want the nested letter updated with 2 attempts", letter, err)
+	}
+}
+
+func TestFaas_RedriveDeadLetter_RedactedCredentials(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    RedriveOptions
+		wantErr error
+	}{
+		{name: "refused without override", wantErr: ErrRedactedCredentials},
+		{name: "credential overridden", opts: RedriveOptions{Overrides: intf.Payload{"api_key": "sk-new"}}},
+		{name: "default credentials allowed", opts: RedriveOptions{DefaultCredentials: true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			faas := newFaas(context.Background())
+			if err := faas.RegisterFunctions([]intf.FunctionFactory{intf.FactoryOf(newCredentialFunction)}); err != nil {
+				t.Fatalf("RegisterFunctions() error = %v", err)
+			}
+			faas.deadLetters.Add(DeadLetter{
+				ID:           "letter",
+				FunctionName: "credential",
+				Payload:      intf.Payload{"message": "hi", "api_key": helpers.RedactedValue},
+			})
+
+			_, err := faas.RedriveDeadLetter(context.Background(), "letter", tt.opts)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("RedriveDeadLetter() error = %v, want %v", err, tt.wantErr)
+			}
+			_, getErr := faas.GetDeadLetter("letter")
+			if kept := getErr == nil; kept != (tt.wantErr != nil) {
+				t.Errorf("letter kept = %v after RedriveDeadLetter() error = %v", kept, err)
+			}
+			if tt.wantErr != nil && !strings.Contains(err.Error(), "api_key") {
+				t.Errorf("RedriveDeadLetter() error = %v, want the redacted field", err)
+			}
+		})
+	}
+}
+
+func TestFaas_DeadLetters_SkipsEarlyStagesAndCancellation(t *testing.T) {
+	faas := newFaas(context.Background())
+	if err := faas.RegisterFunctions(mockFactories(
+		&MockFunction{name: "invalid", shouldErr: true},
+		&MockFunction{name: "execute_error", executeErr: true},
+	)); err != nil {
+		t.Fatalf("RegisterFunctions() error = %v", err)
+	}
+	if err := faas.RegisterFunctions([]intf.FunctionFactory{intf.FactoryOf(newBlockingFunction)}); err != nil {
+		t.Fatalf("RegisterFunctions() error = %v", err)
+	}
+
+	faas.InvokeFunction(context.Background(), "invalid", intf.Payload{})
+	faas.InvokeFunction(context.Background(), "execute_error", intf.Payload{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+	faas.InvokeFunction(ctx, "blocking", intf.Payload{})
+
+	letters, _ := faas.ListDeadLetters("")
+	if len(letters) != 1 || letters[0].FunctionName != "execute_error" {
+		t.Errorf("ListDeadLetters() = %+v, want only execute_error", letters)
+	}
+
+	if err := faas.PurgeDeadLetters(); err != nil {
+		t.Fatalf("PurgeDeadLetters() error = %v", err)
+	}
+	if letters, _ := faas.ListDeadLetters(""); len(letters) != 0 {
+		t.Errorf("ListDeadLetters() after purge = %+v, want empty", letters)
+	}
+}
@@ -0,0 +1,42 @@
+package faas
+
+import "fmt"
+
+const (
+	// Invocation stages
+	SchemaStage    = InvocationStageT("schema")
+	ParseStage     = InvocationStageT("parse")
+	ValidateStage  = InvocationStageT("validate")
+	RateLimitStage = InvocationStageT("rate_limit")
+	ExecuteStage   = InvocationStageT("execute")
+)
+
+type (
+	InvocationStageT string
+
+	// InvocationError tags an error returned by a function with the
+	// lifecycle stage in which it occurred
+	InvocationError struct {
+		FunctionName string
+		Stage        InvocationStageT
+		// Attempts is the number of times the execute stage ran
+		Attempts int
+		Err      error
+	}
+)
+
+func newInvocationError(name string, stage InvocationStageT, err error) *InvocationError {
+	return &InvocationError{
+		FunctionName: name,
+		Stage:        stage,
+		Err:          err,
+	}
+}
+
+func (invErr *InvocationError) Error() string {
+	return fmt.Sprintf("function %s failed at %s stage: %v", invErr.FunctionName, invErr.Stage, invErr.Err)
+}
+
+func (invErr *InvocationError) Unwrap() error {
+	return invErr.Err
+}
@@ -2,61 +2,506 @@ package faas
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
 
 	"github.com/gsarmaonline/faas/faas/functions"
+	"github.com/gsarmaonline/faas/faas/helpers"
 	"github.com/gsarmaonline/faas/faas/intf"
+	"github.com/gsarmaonline/faas/faas/metrics"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type (
+	// poolSlotKeyT marks the context of an invocation that holds a slot of
+	// the worker pool of a Faas
+	poolSlotKeyT struct{}
+
+	// poolSlot is the slot held by an invocation
+	poolSlot struct {
+		pool         *WorkerPool
+		functionName string
+	}
+
 	Faas struct {
 		ctx context.Context
 
-		functions map[string]intf.Function
+		mu        sync.RWMutex
+		functions map[string]intf.FunctionFactory
+
+		defaultTimeout time.Duration
+		timeouts       map[string]time.Duration
+
+		defaultRetryPolicy RetryPolicy
+		retryPolicies      map[string]RetryPolicy
+
+		interceptors []Interceptor
+		idempotency  *idempotencyCache
+		rateLimiter  *rateLimiter
+		breakers     *circuitBreakers
+
+		metricsRegistry *metrics.Registry
+		metricsInstance string
+		metrics         *invocationMetrics
+		tracer          trace.Tracer
+		logger          *slog.Logger
+		logLevels       map[string]slog.Level
+		redactor        *helpers.Redactor
+		secrets         helpers.SecretProvider
+		// credentialScopes replace the credential keys declared by functions;
+		// they are guarded by mu
+		credentialScopes map[string][]string
+		credentialAudit  CredentialAuditLog
+
+		resultStore ResultStore
+		deadLetters DeadLetterStore
+		history     HistoryStore
+		pool        *WorkerPool
 	}
 )
 
-func NewFaas(ctx context.Context) (*Faas, error) {
-	faas := &Faas{
-		ctx:       ctx,
-		functions: make(map[string]intf.Function),
-	}
-	if err := faas.RegisterFunctions([]intf.Function{
-		functions.NewSlack(),
-		functions.NewEmailAction(),
-		functions.NewSmsAction(),
-		functions.NewDockerRegistryAction(),
-		functions.NewHttpAction(),
-		functions.NewLoggerAction(),
-		functions.NewGithubAction(),
-	}); err != nil {
+// NewFaas creates a Faas with all built-in functions registered. The
+// built-ins are granted the credentials their configs declare, unless
+// WithCredentialScope sets their scope. Cancelling ctx cancels every
+// in-flight invocation.
+func NewFaas(ctx context.Context, opts ...Option) (*Faas, error) {
+	faas := newFaas(ctx, opts...)
+	builtins := []intf.FunctionFactory{
+		intf.FactoryOf(functions.NewSlack),
+		intf.FactoryOf(functions.NewEmailAction),
+		intf.FactoryOf(functions.NewSmsAction),
+		intf.FactoryOf(functions.NewDockerRegistryAction),
+		intf.FactoryOf(functions.NewHttpAction),
+		intf.FactoryOf(functions.NewLoggerAction),
+		intf.FactoryOf(functions.NewGithubAction),
+	}
+	if err := faas.RegisterFunctions(builtins); err != nil {
 		return nil, err
 	}
+	for _, factory := range builtins {
+		config := factory().GetConfig()
+		if _, exists := faas.credentialScopes[config.Name]; !exists && len(config.Credentials) > 0 {
+			faas.credentialScopes[config.Name] = config.Credentials
+		}
+	}
 	return faas, nil
 }
 
-func (faas *Faas) RegisterFunctions(functions []intf.Function) (err error) {
-	for _, function := range functions {
-		if _, exists := faas.functions[function.GetConfig().Name]; exists {
-			err = fmt.Errorf("function with name %s already exists", function.GetConfig().Name)
+// newFaas creates a Faas without any registered function
+func newFaas(ctx context.Context, opts ...Option) *Faas {
+	faas := &Faas{
+		ctx:         ctx,
+		functions:   make(map[string]intf.FunctionFactory),
+		timeouts:    make(map[string]time.Duration),
+		resultStore: NewMemoryResultStore(DefaultResultTTL),
+		deadLetters: NewMemoryDeadLetterStore(DefaultMaxDeadLetters),
+		history:     NewMemoryHistoryStore(DefaultMaxHistoryRecords),
+		idempotency: newIdempotencyCache(DefaultIdempotencyWindow),
+		rateLimiter: newRateLimiter(),
+		breakers:    newCircuitBreakers(),
+		pool:        NewWorkerPool(DefaultMaxConcurrency, DefaultMaxQueueSize),
+
+		defaultRetryPolicy: DefaultRetryPolicy(),
+		retryPolicies:      make(map[string]RetryPolicy),
+		metricsRegistry:    metrics.NewRegistry(),
+		metricsInstance:    DefaultMetricsInstance,
+		tracer:             otel.GetTracerProvider().Tracer(helpers.TracerName),
+		logger:             slog.Default(),
+		logLevels:          make(map[string]slog.Level),
+		redactor:           helpers.NewRedactor(),
+		secrets:            helpers.DefaultSecretProvider(),
+		credentialScopes:   make(map[string][]string),
+	}
+	for _, opt := range opts {
+		opt(faas)
+	}
+	var err error
+	if faas.metrics, err = newInvocationMetrics(faas.metricsRegistry, faas.metricsInstance, faas.pool); err != nil {
+		faas.logger.Warn("Failed to register pool gauges", "error", err)
+	}
+	faas.breakers.logger = faas.logger
+	if faas.credentialAudit == nil {
+		faas.credentialAudit = NewLogCredentialAuditLog(faas.logger)
+	}
+	return faas
+}
+
+// RegisterFunctions registers a factory per function name. The name is
+// read from the config of an instance created by the factory.
+func (faas *Faas) RegisterFunctions(factories []intf.FunctionFactory) (err error) {
+	faas.mu.Lock()
+	defer faas.mu.Unlock()
+
+	for _, factory := range factories {
+		name := factory().GetConfig().Name
+		if _, exists := faas.functions[name]; exists {
+			err = fmt.Errorf("function with name %s already exists", name)
 			return
 		}
-		faas.functions[function.GetConfig().Name] = function
+		faas.functions[name] = factory
 	}
 	return
 }
 
-func (faas *Faas) ExecuteFunction(name string) (output intf.FunctionOutput, err error) {
-	function, exists := faas.functions[name]
+// ReplaceFunction atomically swaps the factory of an already registered
+// function. Invocations that are already running keep their instance. The
+// replacement is granted no credentials until SetCredentialScope grants them.
+func (faas *Faas) ReplaceFunction(factory intf.FunctionFactory) (err error) {
+	name := factory().GetConfig().Name
+
+	faas.mu.Lock()
+	defer faas.mu.Unlock()
+
+	if _, exists := faas.functions[name]; !exists {
+		err = fmt.Errorf("function with name %s does not exist", name)
+		return
+	}
+	faas.functions[name] = factory
+	delete(faas.credentialScopes, name)
+	return
+}
+
+// UnregisterFunction removes the named function and its credential scope.
+// Invocations that are already running are not affected.
+func (faas *Faas) UnregisterFunction(name string) (err error) {
+	faas.mu.Lock()
+	defer faas.mu.Unlock()
+
+	if _, exists := faas.functions[name]; !exists {
+		err = fmt.Errorf("function with name %s does not exist", name)
+		return
+	}
+	delete(faas.functions, name)
+	delete(faas.credentialScopes, name)
+	return
+}
+
+// ListFunctions returns the config of every registered function, sorted by
+// name
+func (faas *Faas) ListFunctions() (configs []intf.FunctionConfig) {
+	faas.mu.RLock()
+	factories := make([]intf.FunctionFactory, 0, len(faas.functions))
+	for _, factory := range faas.functions {
+		factories = append(factories, factory)
+	}
+	faas.mu.RUnlock()
+
+	for _, factory := range factories {
+		configs = append(configs, factory().GetConfig())
+	}
+	sort.Slice(configs, func(i, j int) bool {
+		return configs[i].Name < configs[j].Name
+	})
+	return
+}
+
+// DescribeFunction returns the config of the named function
+func (faas *Faas) DescribeFunction(name string) (config intf.FunctionConfig, err error) {
+	var function intf.Function
+
+	if function, err = faas.newFunction(name); err != nil {
+		return
+	}
+	config = function.GetConfig()
+	return
+}
+
+// newFunction creates a fresh instance of the named function
+func (faas *Faas) newFunction(name string) (function intf.Function, err error) {
+	faas.mu.RLock()
+	factory, exists := faas.functions[name]
+	faas.mu.RUnlock()
+
 	if !exists {
 		err = fmt.Errorf("function with name %s does not exist", name)
 		return
 	}
-	if err = function.Validate(); err != nil {
+	function = factory()
+	return
+}
+
+// ExecuteFunction validates and executes a fresh instance of the named
+// function without a payload.
+//
+// Deprecated: use InvokeFunction, which parses a payload first.
+func (faas *Faas) ExecuteFunction(name string) (output intf.FunctionOutput, err error) {
+	var function intf.Function
+
+	if function, err = faas.newFunction(name); err != nil {
 		return
 	}
-	if output, err = function.Execute(); err != nil {
+
+	ctx, span := faas.tracer.Start(faas.ctx, "faas.execute_function", trace.WithAttributes(helpers.FunctionAttribute.String(name)))
+	defer func() { helpers.EndSpan(ctx, span, err) }()
+	ctx = helpers.WithLogger(ctx, faas.invocationLogger(newInvocationID(), name, function.GetConfig(), faas.redactor))
+
+	if err = traceStage(ctx, ValidateStage, func(context.Context) error {
+		return function.Validate()
+	}); err != nil {
 		return
 	}
+	err = traceStage(ctx, ExecuteStage, func(ctx context.Context) (stageErr error) {
+		output, stageErr = function.Execute(ctx)
+		return
+	})
 	return
 }
+
+// InvokeFunction runs the full lifecycle of a fresh instance of the named
+// function with the given payload: the payload is checked against the input
+// schema of the function, then ParsePayload, Validate and Execute run in
+// that order. Execute receives a context that is cancelled when ctx or the
+// Faas context is done, or when the function timeout elapses.
+// Errors raised by the function are wrapped in an *InvocationError that
+// records the stage that failed.
+//
+// The invocation runs in the worker pool; it waits for a free slot while ctx
+// allows and fails with ErrQueueFull if the queue is full. A function that
+// invokes itself with the context passed to Execute runs the nested
+// invocation in its own slot. Nested invocations of other functions wait for
+// the cap of their function only, so they cannot deadlock a full pool.
+// Invocations with a key set by WithIdempotencyKey are deduplicated; the key
+// is not passed on to the invocations the function makes.
+func (faas *Faas) InvokeFunction(ctx context.Context, name string, payload intf.Payload) (output intf.FunctionOutput, err error) {
+	if _, err = faas.newFunction(name); err != nil {
+		return
+	}
+	if key := IdempotencyKeyFromContext(ctx); key != "" {
+		return faas.idempotency.do(ctx, name, key, payload, func() (intf.FunctionOutput, error) {
+			return faas.runInPool(ctx, name, payload)
+		})
+	}
+	return faas.runInPool(ctx, name, payload)
+}
+
+// runInPool runs an invocation in the worker pool. Invocations of the same
+// function made from within an invocation reuse the slot of their caller;
+// those of other functions take a slot of their own without waiting for the
+// global cap.
+func (faas *Faas) runInPool(ctx context.Context, name string, payload intf.Payload) (output intf.FunctionOutput, err error) {
+	run := faas.pool.Run
+	if slot, ok := ctx.Value(poolSlotKeyT{}).(poolSlot); ok && slot.pool == faas.pool {
+		if slot.functionName == name {
+			output, _, err = faas.invoke(ctx, name, payload)
+			return
+		}
+		run = faas.pool.runNested
+	}
+	if runErr := run(ctx, name, func() {
+		output, _, err = faas.invoke(ctx, name, payload)
+	}); runErr != nil {
+		faas.metrics.recordRejection(name, runErr)
+		err = runErr
+	}
+	return
+}
+
+// WorkerPoolStats returns the queue depth and running invocation counts of
+// the worker pool
+func (faas *Faas) WorkerPoolStats() WorkerPoolStats {
+	return faas.pool.Stats()
+}
+
+// invoke runs the invocation pipeline of the named function. It also returns
+// the redactor of the invocation, which knows the secrets it resolved, or nil
+// if the function did not start.
+func (faas *Faas) invoke(ctx context.Context, name string, payload intf.Payload) (output intf.FunctionOutput, redactor *helpers.Redactor, err error) {
+	var function intf.Function
+
+	if function, err = faas.newFunction(name); err != nil {
+		return
+	}
+
+	ctx, span := faas.tracer.Start(ctx, "faas.invoke", trace.WithAttributes(helpers.FunctionAttribute.String(name)))
+	defer func() { helpers.EndSpan(ctx, span, err) }()
+
+	ctx, cancel := faas.invocationContext(ctx, name)
+	defer cancel()
+	ctx = metrics.WithRegistry(ctx, faas.metricsRegistry)
+	ctx = context.WithValue(ctx, poolSlotKeyT{}, poolSlot{pool: faas.pool, functionName: name})
+	ctx = withoutIdempotencyKey(ctx)
+
+	if err = ctx.Err(); err != nil {
+		return
+	}
+
+	config := function.GetConfig()
+	startedAt := time.Now()
+	id := invocationIDFromContext(ctx)
+	redriveOf, _ := ctx.Value(redriveOfKeyT{}).(string)
+	replayOf := replayOfFromContext(ctx)
+	// The ID, the redriven letter and the replayed record belong to this
+	// invocation only, not to the invocations the function makes
+	ctx = withInvocationID(ctx, "")
+	ctx = context.WithValue(ctx, redriveOfKeyT{}, "")
+	ctx = context.WithValue(ctx, replayOfKeyT{}, "")
+	resolver := helpers.BindSecretProvider(ctx, faas.secrets)
+	scoped := faas.scopeCredentials(ctx, id, name, resolver)
+	if consumer, ok := function.(intf.CredentialConsumer); ok {
+		consumer.SetCredentialResolver(scoped)
+	}
+	redactor = faas.invocationRedactor(config, payload).WithSecrets(resolver.Resolved)
+	ctx = helpers.WithCredentialResolver(ctx, scoped)
+	ctx = helpers.WithRedactor(ctx, redactor)
+	ctx = helpers.WithLogger(ctx, faas.invocationLogger(id, name, config, redactor))
+	// executed is the payload the function ran with, which interceptors
+	// may have replaced
+	executed := payload
+	handler := faas.chain(func(ctx context.Context, request InvocationRequest) (intf.FunctionOutput, error) {
+		executed = request.Payload
+		return faas.run(ctx, name, config, function, request.Payload)
+	})
+	request := InvocationRequest{
+		FunctionName: name,
+		Config:       config,
+		Payload:      payload,
+	}
+	output, err = handler(ctx, request)
+
+	// Record the executed payload and mask the credentials interceptors
+	// added to it
+	request.Payload = executed
+	redactor = redactor.WithPayloadCredentials(config.InputSchema, executed)
+	ctx = helpers.WithRedactor(ctx, redactor)
+	err = redactInvocationError(redactor, err)
+	faas.recordHistory(ctx, id, replayOf, request, output, err, startedAt)
+	faas.metrics.recordInvocation(name, err, startedAt)
+	if err != nil {
+		faas.deadLetter(ctx, name, redriveOf, config, executed, err, startedAt)
+		return
+	}
+	return
+}
+
+// run is the innermost handler of an invocation; it runs the schema, parse,
+// validate and execute stages on a fresh function instance. The parse,
+// validate and execute stages each get a span; the schema check is part of
+// the parse span.
+func (faas *Faas) run(ctx context.Context, name string, config intf.FunctionConfig, function intf.Function, payload intf.Payload) (output intf.FunctionOutput, err error) {
+	if err = traceStage(ctx, ParseStage, func(context.Context) error {
+		if schemaErr := helpers.ValidateSchema(config.InputSchema, payload); schemaErr != nil {
+			return newInvocationError(name, SchemaStage, schemaErr)
+		}
+		if parseErr := function.ParsePayload(payload); parseErr != nil {
+			return newInvocationError(name, ParseStage, parseErr)
+		}
+		return nil
+	}); err != nil {
+		return
+	}
+	if err = traceStage(ctx, ValidateStage, func(context.Context) error {
+		if validateErr := function.Validate(); validateErr != nil {
+			return newInvocationError(name, ValidateStage, validateErr)
+		}
+		return nil
+	}); err != nil {
+		return
+	}
+	err = traceStage(ctx, ExecuteStage, func(ctx context.Context) (stageErr error) {
+		output, stageErr = faas.execute(ctx, name, function)
+		return
+	})
+	return
+}
+
+// traceStage runs a stage of an invocation in a child span of ctx
+func traceStage(ctx context.Context, stage InvocationStageT, fn func(context.Context) error) (err error) {
+	ctx, span := helpers.StartSpan(ctx, "faas."+string(stage), helpers.StageAttribute.String(string(stage)))
+	defer func() { helpers.EndSpan(ctx, span, err) }()
+
+	err = fn(ctx)
+	return
+}
+
+// execute runs the execute stage of an invocation, retrying retryable errors
+// according to the retry policy of the function. Every attempt takes a rate
+// limit token first; only the first attempt may be rejected. Attempts go
+// through the circuit breaker of the endpoint of the function.
+func (faas *Faas) execute(ctx context.Context, name string, function intf.Function) (output intf.FunctionOutput, err error) {
+	policy := faas.retryPolicy(name)
+	firstAttemptAt := time.Now()
+
+	if err = ctx.Err(); err != nil {
+		return
+	}
+	if err = faas.rateLimiter.acquire(ctx, name, function, RateLimitModeFromContext(ctx) == RejectRateLimitMode); err != nil {
+		if errors.Is(err, ErrRateLimited) {
+			faas.metrics.recordRejection(name, err)
+			err = newInvocationError(name, RateLimitStage, err)
+		}
+		return
+	}
+
+	for attempt := 1; ; attempt++ {
+		// Open circuits fail fast without calling the function
+		if err = faas.breakers.allow(function); err == nil {
+			attemptCtx := helpers.WithLogger(ctx, helpers.LoggerFromContext(ctx).With(AttemptLogKey, attempt))
+			output, err = function.Execute(attemptCtx)
+			faas.breakers.record(function, err)
+		}
+		if err == nil {
+			return
+		}
+		faas.rateLimiter.adapt(name, function, err)
+		faas.metrics.recordExecuteError(err)
+
+		delay := policy.Backoff(attempt, err)
+		if !policy.shouldRetry(attempt, err, delay, firstAttemptAt) || faas.waitForRetry(ctx, name, function, delay) != nil {
+			invErr := newInvocationError(name, ExecuteStage, err)
+			invErr.Attempts = attempt
+			err = invErr
+			return
+		}
+		faas.metrics.recordRetry(name)
+		helpers.LoggerFromContext(ctx).Debug("Retrying invocation", AttemptLogKey, attempt+1, "delay", delay)
+		trace.SpanFromContext(ctx).AddEvent("retry", trace.WithAttributes(helpers.AttemptsAttribute.Int(attempt+1)))
+	}
+}
+
+// waitForRetry waits for the backoff delay and a rate limit token before the
+// next attempt
+func (faas *Faas) waitForRetry(ctx context.Context, name string, function intf.Function, delay time.Duration) error {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+	}
+	return faas.rateLimiter.acquire(ctx, name, function, false)
+}
+
+func (faas *Faas) retryPolicy(name string) RetryPolicy {
+	if policy, exists := faas.retryPolicies[name]; exists {
+		return policy
+	}
+	return faas.defaultRetryPolicy
+}
+
+// invocationContext derives the context of a single invocation from ctx. It
+// is also cancelled with the Faas context and carries the function timeout.
+func (faas *Faas) invocationContext(ctx context.Context, name string) (context.Context, context.CancelFunc) {
+	timeout, exists := faas.timeouts[name]
+	if !exists {
+		timeout = faas.defaultTimeout
+	}
+
+	var cancelTimeout context.CancelFunc = func() {}
+	if timeout > 0 {
+		ctx, cancelTimeout = context.WithTimeout(ctx, timeout)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	stop := context.AfterFunc(faas.ctx, cancel)
+
+	return ctx, func() {
+		stop()
+		cancel()
+		cancelTimeout()
+	}
+}
@@ -2,19 +2,33 @@ package faas
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/gsarmaonline/faas/faas/functions"
+	"github.com/gsarmaonline/faas/faas/helpers"
 	"github.com/gsarmaonline/faas/faas/intf"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 )
 
 // Mock function for testing
 type MockFunction struct {
-	name      string
-	validated bool
-	executed  bool
-	shouldErr bool
+	name       string
+	payload    intf.Payload
+	parsed     bool
+	validated  bool
+	executed   bool
+	shouldErr  bool
+	parseErr   bool
+	executeErr bool
 }
 
 func (m *MockFunction) GetConfig() intf.FunctionConfig {
@@ -22,6 +36,11 @@ func (m *MockFunction) GetConfig() intf.FunctionConfig {
 }
 
 func (m *MockFunction) ParsePayload(payload intf.Payload) error {
+	m.parsed = true
+	m.payload = payload
+	if m.parseErr {
+		return fmt.Errorf("parse error")
+	}
 	return nil
 }
 
@@ -33,14 +52,89 @@ func (m *MockFunction) Validate() error {
 	return nil
 }
 
-func (m *MockFunction) Execute() (intf.FunctionOutput, error) {
+func (m *MockFunction) Execute(ctx context.Context) (intf.FunctionOutput, error) {
 	m.executed = true
-	if m.shouldErr {
+	if m.shouldErr || m.executeErr {
 		return nil, fmt.Errorf("execution error")
 	}
 	return nil, nil
 }
 
+// EchoFunction stores its parsed payload on the instance and echoes it
+// back from Execute, so shared instances show up as mismatched outputs
+type (
+	EchoFunction struct {
+		Input intf.Payload
+	}
+	EchoOutput struct {
+		Payload intf.Payload
+	}
+)
+
+func (e *EchoFunction) GetConfig() intf.FunctionConfig {
+	return intf.FunctionConfig{Name: "echo"}
+}
+
+func (e *EchoFunction) ParsePayload(payload intf.Payload) error {
+	e.Input = payload
+	return nil
+}
+
+func (e *EchoFunction) Validate() error {
+	return nil
+}
+
+func (e *EchoFunction) Execute(ctx context.Context) (intf.FunctionOutput, error) {
+	return EchoOutput{Payload: e.Input}, nil
+}
+
+func (o EchoOutput) GetPayload() (intf.Payload, error) {
+	return o.Payload, nil
+}
+
+func newEchoFunction() *EchoFunction {
+	return &EchoFunction{}
+}
+
+// BlockingFunction blocks in Execute until its context is done
+type BlockingFunction struct{}
+
+func (b *BlockingFunction) GetConfig() intf.FunctionConfig {
+	return intf.FunctionConfig{Name: "blocking"}
+}
+
+func (b *BlockingFunction) ParsePayload(payload intf.Payload) error {
+	return nil
+}
+
+func (b *BlockingFunction) Validate() error {
+	return nil
+}
+
+func (b *BlockingFunction) Execute(ctx context.Context) (intf.FunctionOutput, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func newBlockingFunction() *BlockingFunction {
+	return &BlockingFunction{}
+}
+
+// mockFactory returns a factory that always hands out the same mock so
+// tests can inspect which lifecycle methods were called
+func mockFactory(m *MockFunction) intf.FunctionFactory {
+	return func() intf.Function {
+		return m
+	}
+}
+
+func mockFactories(mocks ...*MockFunction) (factories []intf.FunctionFactory) {
+	for _, m := range mocks {
+		factories = append(factories, mockFactory(m))
+	}
+	return
+}
+
 func TestNewFaas(t *testing.T) {
 	ctx := context.Background()
 	faas, err := NewFaas(ctx)
@@ -74,36 +168,33 @@ func TestNewFaas(t *testing.T) {
 
 func TestFaas_RegisterFunctions(t *testing.T) {
 	ctx := context.Background()
-	faas := &Faas{
-		ctx:       ctx,
-		functions: make(map[string]intf.Function),
-	}
+	faas := newFaas(ctx)
 
 	tests := []struct {
 		name      string
-		functions []intf.Function
+		functions []*MockFunction
 		wantErr   bool
 		errMsg    string
 	}{
 		{
 			name: "register single function",
-			functions: []intf.Function{
-				&MockFunction{name: "test1"},
+			functions: []*MockFunction{
+				{name: "test1"},
 			},
 			wantErr: false,
 		},
 		{
 			name: "register multiple functions",
-			functions: []intf.Function{
-				&MockFunction{name: "test2"},
-				&MockFunction{name: "test3"},
+			functions: []*MockFunction{
+				{name: "test2"},
+				{name: "test3"},
 			},
 			wantErr: false,
 		},
 		{
 			name: "register duplicate function",
-			functions: []intf.Function{
-				&MockFunction{name: "test1"}, // Already registered in first test
+			functions: []*MockFunction{
+				{name: "test1"}, // Already registered in first test
 			},
 			wantErr: true,
 			errMsg:  "function with name test1 already exists",
@@ -112,7 +203,7 @@ func TestFaas_RegisterFunctions(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			err := faas.RegisterFunctions(tt.functions)
+			err := faas.RegisterFunctions(mockFactories(tt.functions...))
 
 			if tt.wantErr {
 				if err == nil {
@@ -141,10 +232,7 @@ func TestFaas_RegisterFunctions(t *testing.T) {
 
 func TestFaas_ExecuteFunction(t *testing.T) {
 	ctx := context.Background()
-	faas := &Faas{
-		ctx:       ctx,
-		functions: make(map[string]intf.Function),
-	}
+	faas := newFaas(ctx)
 
 	// Register test functions
 	mockFunc1 := &MockFunction{name: "success_func", shouldErr: false}
@@ -153,9 +241,9 @@ func TestFaas_ExecuteFunction(t *testing.T) {
 
 	// Set execution_error_func to fail during execution
 	mockFunc3.validated = true // This will bypass validation error
-	faas.functions["success_func"] = mockFunc1
-	faas.functions["validation_error_func"] = mockFunc2
-	faas.functions["execution_error_func"] = mockFunc3
+	faas.functions["success_func"] = mockFactory(mockFunc1)
+	faas.functions["validation_error_func"] = mockFactory(mockFunc2)
+	faas.functions["execution_error_func"] = mockFactory(mockFunc3)
 
 	tests := []struct {
 		name         string
@@ -216,20 +304,17 @@ func TestFaas_ExecuteFunction(t *testing.T) {
 
 func TestFaas_Integration_WithRealFunctions(t *testing.T) {
 	ctx := context.Background()
-	faas := &Faas{
-		ctx:       ctx,
-		functions: make(map[string]intf.Function),
-	}
+	faas := newFaas(ctx)
 
 	// Register all the real functions
-	realFunctions := []intf.Function{
-		functions.NewSlack(),
-		functions.NewEmailAction(),
-		functions.NewSmsAction(),
-		functions.NewDockerRegistryAction(),
-		functions.NewHttpAction(),
-		functions.NewLoggerAction(),
-		functions.NewGithubAction(),
+	realFunctions := []intf.FunctionFactory{
+		intf.FactoryOf(functions.NewSlack),
+		intf.FactoryOf(functions.NewEmailAction),
+		intf.FactoryOf(functions.NewSmsAction),
+		intf.FactoryOf(functions.NewDockerRegistryAction),
+		intf.FactoryOf(functions.NewHttpAction),
+		intf.FactoryOf(functions.NewLoggerAction),
+		intf.FactoryOf(functions.NewGithubAction),
 	}
 
 	err := faas.RegisterFunctions(realFunctions)
@@ -247,7 +332,7 @@ func TestFaas_Integration_WithRealFunctions(t *testing.T) {
 	}
 
 	// Test that we can't register duplicate functions
-	err = faas.RegisterFunctions([]intf.Function{functions.NewSlack()})
+	err = faas.RegisterFunctions([]intf.FunctionFactory{intf.FactoryOf(functions.NewSlack)})
 	if err == nil {
 		t.Error("Should not be able to register duplicate slack function")
 	}
@@ -255,14 +340,10 @@ func TestFaas_Integration_WithRealFunctions(t *testing.T) {
 
 func TestFaas_ExecuteFunction_WithPayload(t *testing.T) {
 	ctx := context.Background()
-	faas := &Faas{
-		ctx:       ctx,
-		functions: make(map[string]intf.Function),
-	}
+	faas := newFaas(ctx)
 
 	// Register logger function for testing (it has minimal validation requirements)
-	loggerFunc := functions.NewLoggerAction()
-	err := faas.RegisterFunctions([]intf.Function{loggerFunc})
+	err := faas.RegisterFunctions([]intf.FunctionFactory{intf.FactoryOf(functions.NewLoggerAction)})
 	if err != nil {
 		t.Errorf("Failed to register logger function: %v", err)
 		return
@@ -277,17 +358,14 @@ func TestFaas_ExecuteFunction_WithPayload(t *testing.T) {
 
 func TestFaas_GetRegisteredFunctions(t *testing.T) {
 	ctx := context.Background()
-	faas := &Faas{
-		ctx:       ctx,
-		functions: make(map[string]intf.Function),
-	}
+	faas := newFaas(ctx)
 
 	// Register some test functions
-	testFunctions := []intf.Function{
+	testFunctions := mockFactories(
 		&MockFunction{name: "func1"},
 		&MockFunction{name: "func2"},
 		&MockFunction{name: "func3"},
-	}
+	)
 
 	err := faas.RegisterFunctions(testFunctions)
 	if err != nil {
@@ -308,3 +386,443 @@ func TestFaas_GetRegisteredFunctions(t *testing.T) {
 		}
 	}
 }
+
+func TestFaas_InvokeFunction(t *testing.T) {
+	tests := []struct {
+		name         string
+		function     *MockFunction
+		functionName string
+		wantErr      bool
+		wantStage    InvocationStageT
+		wantExecuted bool
+	}{
+		{
+			name:         "successful invocation runs every stage",
+			function:     &MockFunction{name: "mock"},
+			functionName: "mock",
+			wantExecuted: true,
+		},
+		{
+			name:         "non-existing function",
+			function:     &MockFunction{name: "mock"},
+			functionName: "non_existing",
+			wantErr:      true,
+		},
+		{
+			name:         "parse error",
+			function:     &MockFunction{name: "mock", parseErr: true},
+			functionName: "mock",
+			wantErr:      true,
+			wantStage:    ParseStage,
+		},
+		{
+			name:         "validation error",
+			function:     &MockFunction{name: "mock", shouldErr: true},
+			functionName: "mock",
+			wantErr:      true,
+			wantStage:    ValidateStage,
+		},
+		{
+			name:         "execution error",
+			function:     &MockFunction{name: "mock", executeErr: true},
+			functionName: "mock",
+			wantErr:      true,
+			wantStage:    ExecuteStage,
+			wantExecuted: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			faas := newFaas(context.Background())
+			if err := faas.RegisterFunctions(mockFactories(tt.function)); err != nil {
+				t.Fatalf("RegisterFunctions() error = %v", err)
+			}
+
+			payload := intf.Payload{"message": "hello"}
+			_, err := faas.InvokeFunction(context.Background(), tt.functionName, payload)
+
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("InvokeFunction() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantStage != "" {
+				var invErr *InvocationError
+				if !errors.As(err, &invErr) {
+					t.Fatalf("InvokeFunction() error = %v, want *InvocationError", err)
+				}
+				if invErr.Stage != tt.wantStage {
+					t.Errorf("Stage = %v, want %v", invErr.Stage, tt.wantStage)
+				}
+				if invErr.FunctionName != tt.functionName {
+					t.Errorf("FunctionName = %v, want %v", invErr.FunctionName, tt.functionName)
+				}
+			}
+			if tt.functionName == tt.function.name {
+				if tt.function.payload["message"] != "hello" {
+					t.Errorf("ParsePayload() received %v, want payload to be passed through", tt.function.payload)
+				}
+			}
+			if tt.function.executed != tt.wantExecuted {
+				t.Errorf("executed = %v, want %v", tt.function.executed, tt.wantExecuted)
+			}
+		})
+	}
+}
+
+func TestFaas_InvokeFunction_CancelledContext(t *testing.T) {
+	faas := newFaas(context.Background())
+	mockFunc := &MockFunction{name: "mock"}
+	if err := faas.RegisterFunctions(mockFactories(mockFunc)); err != nil {
+		t.Fatalf("RegisterFunctions() error = %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := faas.InvokeFunction(ctx, "mock", intf.Payload{}); !errors.Is(err, context.Canceled) {
+		t.Errorf("InvokeFunction() error = %v, want %v", err, context.Canceled)
+	}
+	if mockFunc.parsed || mockFunc.executed {
+		t.Error("InvokeFunction() should not run any stage with a cancelled context")
+	}
+}
+
+func TestFaas_InvokeFunction_Concurrent(t *testing.T) {
+	faas := newFaas(context.Background())
+	if err := faas.RegisterFunctions([]intf.FunctionFactory{intf.FactoryOf(newEchoFunction)}); err != nil {
+		t.Fatalf("RegisterFunctions() error = %v", err)
+	}
+
+	const invocations = 500
+	var wg sync.WaitGroup
+	for i := 0; i < invocations; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			output, err := faas.InvokeFunction(context.Background(), "echo", intf.Payload{"id": i})
+			if err != nil {
+				t.Errorf("InvokeFunction() error = %v", err)
+				return
+			}
+			payload, _ := output.GetPayload()
+			if payload["id"] != i {
+				t.Errorf("invocation %d received output for %v", i, payload["id"])
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestFaas_RegisterFunctions_ConcurrentWithInvocations(t *testing.T) {
+	faas := newFaas(context.Background())
+	if err := faas.RegisterFunctions([]intf.FunctionFactory{intf.FactoryOf(newEchoFunction)}); err != nil {
+		t.Fatalf("RegisterFunctions() error = %v", err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 200; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			if _, err := faas.InvokeFunction(context.Background(), "echo", intf.Payload{"id": i}); err != nil {
+				t.Errorf("InvokeFunction() error = %v", err)
+			}
+		}(i)
+		go func(i int) {
+			defer wg.Done()
+			mock := &MockFunction{name: fmt.Sprintf("mock_%d", i)}
+			if err := faas.RegisterFunctions(mockFactories(mock)); err != nil {
+				t.Errorf("RegisterFunctions() error = %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestFaas_InvokeFunction_Deadlines(t *testing.T) {
+	t.Run("function timeout", func(t *testing.T) {
+		faas, err := NewFaas(context.Background(), WithFunctionTimeout("blocking", 20*time.Millisecond))
+		if err != nil {
+			t.Fatalf("NewFaas() error = %v", err)
+		}
+		if err = faas.RegisterFunctions([]intf.FunctionFactory{intf.FactoryOf(newBlockingFunction)}); err != nil {
+			t.Fatalf("RegisterFunctions() error = %v", err)
+		}
+
+		_, err = faas.InvokeFunction(context.Background(), "blocking", intf.Payload{})
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("InvokeFunction() error = %v, want %v", err, context.DeadlineExceeded)
+		}
+	})
+
+	t.Run("default timeout", func(t *testing.T) {
+		faas, err := NewFaas(context.Background(), WithDefaultTimeout(20*time.Millisecond))
+		if err != nil {
+			t.Fatalf("NewFaas() error = %v", err)
+		}
+		if err = faas.RegisterFunctions([]intf.FunctionFactory{intf.FactoryOf(newBlockingFunction)}); err != nil {
+			t.Fatalf("RegisterFunctions() error = %v", err)
+		}
+
+		_, err = faas.InvokeFunction(context.Background(), "blocking", intf.Payload{})
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("InvokeFunction() error = %v, want %v", err, context.DeadlineExceeded)
+		}
+	})
+
+	t.Run("cancelling the faas context aborts in-flight invocations", func(t *testing.T) {
+		parent, cancel := context.WithCancel(context.Background())
+		faas, err := NewFaas(parent)
+		if err != nil {
+			t.Fatalf("NewFaas() error = %v", err)
+		}
+		if err = faas.RegisterFunctions([]intf.FunctionFactory{intf.FactoryOf(newBlockingFunction)}); err != nil {
+			t.Fatalf("RegisterFunctions() error = %v", err)
+		}
+
+		time.AfterFunc(20*time.Millisecond, cancel)
+		_, err = faas.InvokeFunction(context.Background(), "blocking", intf.Payload{})
+
+		var invErr *InvocationError
+		if !errors.As(err, &invErr) || invErr.Stage != ExecuteStage {
+			t.Fatalf("InvokeFunction() error = %v, want execute stage error", err)
+		}
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("InvokeFunction() error = %v, want %v", err, context.Canceled)
+		}
+	})
+}
+
+func TestFaas_InvokeFunction_SchemaValidation(t *testing.T) {
+	faas, err := NewFaas(context.Background())
+	if err != nil {
+		t.Fatalf("NewFaas() error = %v", err)
+	}
+
+	// channel_id is required by the slack input schema and message has the wrong type
+	_, err = faas.InvokeFunction(context.Background(), "slack", intf.Payload{"message": float64(1)})
+
+	var invErr *InvocationError
+	if !errors.As(err, &invErr) || invErr.Stage != SchemaStage {
+		t.Fatalf("InvokeFunction() error = %v, want schema stage error", err)
+	}
+	var payloadErr *helpers.PayloadError
+	if !errors.As(err, &payloadErr) {
+		t.Fatalf("InvokeFunction() error = %v, want *helpers.PayloadError", err)
+	}
+	if len(payloadErr.Errors) != 2 {
+		t.Errorf("Errors = %v, want errors for channel_id and message", payloadErr.Errors)
+	}
+}
+
+// VersionedFunction reports its version in its output so tests can see
+// which implementation served an invocation
+type VersionedFunction struct {
+	EchoFunction
+	version string
+}
+
+func (v *VersionedFunction) GetConfig() intf.FunctionConfig {
+	return intf.FunctionConfig{Name: "echo", Version: v.version}
+}
+
+func (v *VersionedFunction) Execute(ctx context.Context) (intf.FunctionOutput, error) {
+	return EchoOutput{Payload: intf.Payload{"version": v.version}}, nil
+}
+
+func versionedFactory(version string) intf.FunctionFactory {
+	return func() intf.Function {
+		return &VersionedFunction{version: version}
+	}
+}
+
+func TestFaas_ListFunctions(t *testing.T) {
+	faas, err := NewFaas(context.Background())
+	if err != nil {
+		t.Fatalf("NewFaas() error = %v", err)
+	}
+
+	configs := faas.ListFunctions()
+	wantNames := []string{"docker_registry", "email", "github", "http", "logger", "slack", "sms"}
+	if len(configs) != len(wantNames) {
+		t.Fatalf("ListFunctions() returned %d functions, want %d", len(configs), len(wantNames))
+	}
+	for i, config := range configs {
+		if config.Name != wantNames[i] {
+			t.Errorf("ListFunctions()[%d] = %v, want %v", i, config.Name, wantNames[i])
+		}
+	}
+}
+
+func TestFaas_DescribeFunction(t *testing.T) {
+	faas, err := NewFaas(context.Background())
+	if err != nil {
+		t.Fatalf("NewFaas() error = %v", err)
+	}
+
+	config, err := faas.DescribeFunction("sms")
+	if err != nil {
+		t.Fatalf("DescribeFunction() error = %v", err)
+	}
+	if config.Name != "sms" || config.InputSchema == nil {
+		t.Errorf("DescribeFunction() = %+v, want sms config with an input schema", config)
+	}
+
+	if _, err = faas.DescribeFunction("non_existing"); err == nil {
+		t.Error("DescribeFunction() error = nil, want error for unknown function")
+	}
+}
+
+func TestFaas_UnregisterFunction(t *testing.T) {
+	faas, err := NewFaas(context.Background())
+	if err != nil {
+		t.Fatalf("NewFaas() error = %v", err)
+	}
+
+	if err = faas.UnregisterFunction("github"); err != nil {
+		t.Fatalf("UnregisterFunction() error = %v", err)
+	}
+	if _, err = faas.DescribeFunction("github"); err == nil {
+		t.Error("DescribeFunction() should fail after the function is unregistered")
+	}
+	if err = faas.UnregisterFunction("github"); err == nil {
+		t.Error("UnregisterFunction() error = nil, want error for unknown function")
+	}
+
+	// The name can be registered again once it is free
+	if err = faas.RegisterFunctions([]intf.FunctionFactory{intf.FactoryOf(functions.NewGithubAction)}); err != nil {
+		t.Errorf("RegisterFunctions() error = %v", err)
+	}
+}
+
+func TestFaas_ReplaceFunction(t *testing.T) {
+	faas := newFaas(context.Background())
+
+	if err := faas.ReplaceFunction(versionedFactory("v1")); err == nil {
+		t.Error("ReplaceFunction() error = nil, want error for unknown function")
+	}
+	if err := faas.RegisterFunctions([]intf.FunctionFactory{versionedFactory("v1")}); err != nil {
+		t.Fatalf("RegisterFunctions() error = %v", err)
+	}
+
+	// Hot-swap the implementation while invocations are running
+	var wg sync.WaitGroup
+	for i := 0; i < 200; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			output, err := faas.InvokeFunction(context.Background(), "echo", intf.Payload{})
+			if err != nil {
+				t.Errorf("InvokeFunction() error = %v", err)
+				return
+			}
+			payload, _ := output.GetPayload()
+			if version := payload["version"]; version != "v1" && version != "v2" {
+				t.Errorf("InvokeFunction() served by version %v", version)
+			}
+		}()
+		if i == 100 {
+			if err := faas.ReplaceFunction(versionedFactory("v2")); err != nil {
+				t.Errorf("ReplaceFunction() error = %v", err)
+			}
+		}
+	}
+	wg.Wait()
+
+	config, err := faas.DescribeFunction("echo")
+	if err != nil {
+		t.Fatalf("DescribeFunction() error = %v", err)
+	}
+	if config.Version != "v2" {
+		t.Errorf("Version = %v, want v2 after replacement", config.Version)
+	}
+}
+
+func TestFaas_InvokeFunction_Tracing(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	faas, _ := newFlakyFaas(t, 1, intf.NewProviderError("twilio", 503, errors.New("unavailable")),
+		WithDefaultRetryPolicy(fastRetryPolicy(3)),
+		WithTracerProvider(provider),
+	)
+	if _, err := faas.InvokeFunction(context.Background(), "flaky", intf.Payload{}); err != nil {
+		t.Fatalf("InvokeFunction() error = %v", err)
+	}
+
+	spans := make(map[string]tracetest.SpanStub)
+	for _, span := range exporter.GetSpans() {
+		spans[span.Name] = span
+	}
+	invocation, exists := spans["faas.invoke"]
+	if !exists {
+		t.Fatalf("no faas.invoke span in %v", exporter.GetSpans().Snapshots())
+	}
+	for _, name := range []string{"faas.parse", "faas.validate", "faas.execute"} {
+		span, exists := spans[name]
+		if !exists {
+			t.Errorf("no %s span", name)
+			continue
+		}
+		if span.Parent.SpanID() != invocation.SpanContext.SpanID() {
+			t.Errorf("%s is not a child of faas.invoke", name)
+		}
+	}
+	if events := spans["faas.execute"].Events; len(events) != 1 || events[0].Name != "retry" {
+		t.Errorf("faas.execute events = %+v, want a single retry", events)
+	}
+
+	// Failed invocations mark their spans as errors
+	exporter.Reset()
+	faas, _ = newFlakyFaas(t, 1, intf.NewProviderError("twilio", 503, errors.New("unavailable")),
+		WithDefaultRetryPolicy(NoRetryPolicy),
+		WithTracerProvider(provider),
+	)
+	faas.InvokeFunction(context.Background(), "flaky", intf.Payload{})
+	for _, span := range exporter.GetSpans() {
+		if (span.Name == "faas.invoke" || span.Name == "faas.execute") && span.Status.Code != codes.Error {
+			t.Errorf("%s status = %v, want %v", span.Name, span.Status.Code, codes.Error)
+		}
+	}
+}
+
+// SecretFunction resolves its token through the resolver injected by Faas
+// and fails with an error that contains it
+type SecretFunction struct {
+	helpers.Credentials
+	EchoFunction
+	token string
+}
+
+func (s *SecretFunction) GetConfig() intf.FunctionConfig {
+	return intf.FunctionConfig{Name: "secret", Credentials: []string{"TEST_SECRET_TOKEN"}}
+}
+
+func (s *SecretFunction) ParsePayload(payload intf.Payload) (err error) {
+	s.token, err = s.CredentialManager().ResolveCredential(nil, "TEST_SECRET_TOKEN")
+	return
+}
+
+func (s *SecretFunction) Execute(ctx context.Context) (intf.FunctionOutput, error) {
+	return nil, fmt.Errorf("token %s rejected", s.token)
+}
+
+func TestFaas_WithSecretProvider(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "TEST_SECRET_TOKEN"), []byte("mounted-token\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	faas := newFaas(context.Background(),
+		WithDefaultRetryPolicy(NoRetryPolicy),
+		WithSecretProvider(helpers.FileSecretProvider{Dir: dir}),
+		WithCredentialScope("secret", "TEST_SECRET_TOKEN"),
+	)
+	if err := faas.RegisterFunctions([]intf.FunctionFactory{func() intf.Function { return &SecretFunction{} }}); err != nil {
+		t.Fatalf("RegisterFunctions() error = %v", err)
+	}
+
+	_, err := faas.InvokeFunction(context.Background(), "secret", intf.Payload{})
+	if err == nil || !strings.Contains(err.Error(), "token "+helpers.RedactedValue+" rejected") {
+		t.Errorf("InvokeFunction() error = %v, want the resolved token redacted", err)
+	}
+}
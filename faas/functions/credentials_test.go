@@ -0,0 +1,14 @@
+package functions
+
+import (
+	"context"
+
+	"github.com/gsarmaonline/faas/faas/helpers"
+	"github.com/gsarmaonline/faas/faas/intf"
+)
+
+// envCredentialResolver resolves credentials from the environment, as Faas
+// does for the keys a function was granted
+func envCredentialResolver() intf.CredentialResolver {
+	return helpers.BindSecretProvider(context.Background(), helpers.EnvSecretProvider{})
+}
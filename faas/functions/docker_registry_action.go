@@ -1,22 +1,36 @@
 package functions
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/gsarmaonline/faas/faas/helpers"
 	"github.com/gsarmaonline/faas/faas/intf"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 type (
 	DockerRegistryInput struct {
-		Image            string `json:"image"`
-		Registry         string `json:"registry"`
-		RegistryUsername string `json:"registry_username"`
-		RegistryPassword string `json:"registry_password"`
+		Image            string `json:"image" jsonschema:"required" description:"Image to run"`
+		Registry         string `json:"registry" description:"Registry host to pull the image from"`
+		RegistryUsername string `json:"registry_username" jsonschema:"credential" description:"Registry username, defaults to DOCKER_REGISTRY_USERNAME"`
+		RegistryPassword string `json:"registry_password" jsonschema:"credential" description:"Registry password, defaults to DOCKER_REGISTRY_PASSWORD"`
 	}
 	DockerRegistryAction struct {
+		helpers.Credentials
 		Input DockerRegistryInput
 	}
+
+	DockerRegistryOutput struct {
+		ExitCode      int64  `json:"exit_code" description:"Exit code of the container"`
+		Stdout        string `json:"stdout" description:"Standard output of the container"`
+		Stderr        string `json:"stderr" description:"Standard error of the container"`
+		LogsTruncated bool   `json:"logs_truncated,omitempty" description:"Whether stdout and stderr were cut off at their size limit"`
+	}
+)
+
+const (
+	DockerProvider = "docker"
 )
 
 func NewDockerRegistryAction() (dockerAction *DockerRegistryAction) {
@@ -24,27 +38,34 @@ func NewDockerRegistryAction() (dockerAction *DockerRegistryAction) {
 }
 
 func (dockerAction DockerRegistryAction) GetConfig() intf.FunctionConfig {
-	return intf.FunctionConfig{Name: "docker_registry"}
+	return intf.FunctionConfig{
+		Name:         "docker_registry",
+		Description:  "Run a container from a public or private registry",
+		Version:      "1.0.0",
+		InputSchema:  helpers.GenerateSchema(DockerRegistryInput{}),
+		OutputSchema: helpers.GenerateSchema(DockerRegistryOutput{}),
+		Credentials:  []string{helpers.EnvDockerRegistryUsername, helpers.EnvDockerRegistryPassword},
+	}
 }
 
-func (dockerAction *DockerRegistryAction) ParsePayload(payload intf.Payload) error {
-	credManager := helpers.NewCredentialManager()
-	
-	processedInput := DockerRegistryInput{
-		Image: payload["image"].(string),
-	}
+func (dockerAction *DockerRegistryAction) ParsePayload(payload intf.Payload) (err error) {
+	credManager := dockerAction.CredentialManager()
 
-	// Optional fields
-	if registry, exists := payload["registry"]; exists && registry != nil {
-		processedInput.Registry = registry.(string)
+	processedInput := DockerRegistryInput{}
+	if err = helpers.DecodePayload(payload, &processedInput); err != nil {
+		return
 	}
 
 	// Credential fields with fallback to environment variables
-	processedInput.RegistryUsername = credManager.GetCredential(payload["registry_username"], helpers.EnvDockerRegistryUsername)
-	processedInput.RegistryPassword = credManager.GetCredential(payload["registry_password"], helpers.EnvDockerRegistryPassword)
+	if processedInput.RegistryUsername, err = credManager.ResolveCredential(processedInput.RegistryUsername, helpers.EnvDockerRegistryUsername); err != nil {
+		return
+	}
+	if processedInput.RegistryPassword, err = credManager.ResolveCredential(processedInput.RegistryPassword, helpers.EnvDockerRegistryPassword); err != nil {
+		return
+	}
 
 	dockerAction.Input = processedInput
-	return nil
+	return
 }
 
 func (dockerAction DockerRegistryAction) Validate() (err error) {
@@ -67,8 +88,16 @@ func (dockerAction DockerRegistryAction) Validate() (err error) {
 	return nil
 }
 
-func (dockerAction DockerRegistryAction) Execute() (output intf.FunctionOutput, err error) {
-	var dockerExecutor *helpers.DockerExecutor
+// Endpoint shares a circuit breaker between all calls to the Docker daemon
+func (dockerAction DockerRegistryAction) Endpoint() string {
+	return DockerProvider
+}
+
+func (dockerAction DockerRegistryAction) Execute(ctx context.Context) (output intf.FunctionOutput, err error) {
+	var (
+		dockerExecutor *helpers.DockerExecutor
+		result         helpers.DockerExecutionResult
+	)
 
 	// Create Docker executor with all parameters
 	if dockerExecutor, err = helpers.NewDockerExecutor(
@@ -79,11 +108,29 @@ func (dockerAction DockerRegistryAction) Execute() (output intf.FunctionOutput,
 	); err != nil {
 		return
 	}
+	defer dockerExecutor.Close()
+
+	ctx, span := helpers.StartProviderSpan(ctx, DockerProvider, "run")
+	span.SetAttributes(attribute.String("container.image.name", dockerAction.Input.Image))
+	defer func() { helpers.EndSpan(ctx, span, err) }()
 
 	// Execute the Docker container
-	if _, err = dockerExecutor.Execute(); err != nil {
+	if result, err = dockerExecutor.Execute(ctx); err != nil {
+		if helpers.IsDockerDaemonUnavailable(err) {
+			err = intf.NewProviderError(DockerProvider, 0, err)
+		}
 		return
 	}
 
+	output = DockerRegistryOutput{
+		ExitCode:      result.ExitCode,
+		Stdout:        result.Stdout,
+		Stderr:        result.Stderr,
+		LogsTruncated: result.LogsTruncated,
+	}
 	return
 }
+
+func (dockerOutput DockerRegistryOutput) GetPayload() (intf.Payload, error) {
+	return helpers.ToPayload(dockerOutput)
+}
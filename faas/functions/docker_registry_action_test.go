@@ -77,6 +77,7 @@ func TestDockerAction_ParsePayload(t *testing.T) {
 			}
 			
 			dockerAction := NewDockerRegistryAction()
+			dockerAction.SetCredentialResolver(envCredentialResolver())
 			err := dockerAction.ParsePayload(tt.payload)
 
 			if err != nil {
@@ -170,3 +171,21 @@ func TestDockerAction_Validate(t *testing.T) {
 		})
 	}
 }
+
+func TestDockerRegistryOutput_GetPayload(t *testing.T) {
+	output := DockerRegistryOutput{ExitCode: 1, Stdout: "hello", Stderr: "oops"}
+
+	payload, err := output.GetPayload()
+	if err != nil {
+		t.Fatalf("GetPayload() error = %v", err)
+	}
+	if payload["exit_code"] != float64(1) {
+		t.Errorf("exit_code = %v, want %v", payload["exit_code"], 1)
+	}
+	if payload["stdout"] != "hello" {
+		t.Errorf("stdout = %v, want %v", payload["stdout"], "hello")
+	}
+	if payload["stderr"] != "oops" {
+		t.Errorf("stderr = %v, want %v", payload["stderr"], "oops")
+	}
+}
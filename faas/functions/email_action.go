@@ -1,29 +1,43 @@
 package functions
 
 import (
+	"context"
 	"fmt"
-	"log"
 
 	"github.com/gsarmaonline/faas/faas/helpers"
 	"github.com/gsarmaonline/faas/faas/intf"
+	"github.com/sendgrid/rest"
 	"github.com/sendgrid/sendgrid-go"
 	"github.com/sendgrid/sendgrid-go/helpers/mail"
 )
 
 type (
 	EmailInput struct {
-		ApiKey    string `json:"api_key"`
-		FromEmail string `json:"from_email"`
-		FromName  string `json:"from_name"`
-		ToEmail   string `json:"to_email"`
-		ToName    string `json:"to_name"`
-		Subject   string `json:"subject"`
-		PlainText string `json:"plain_text"`
-		HtmlText  string `json:"html_text"`
+		ApiKey    string `json:"api_key" jsonschema:"credential" description:"SendGrid API key, defaults to SENDGRID_API_KEY"`
+		FromEmail string `json:"from_email" jsonschema:"required,format=email" description:"Sender address"`
+		FromName  string `json:"from_name" description:"Sender name"`
+		ToEmail   string `json:"to_email" jsonschema:"required,format=email" description:"Recipient address"`
+		ToName    string `json:"to_name" description:"Recipient name"`
+		Subject   string `json:"subject" jsonschema:"required" description:"Subject line"`
+		PlainText string `json:"plain_text" description:"Plain text body, required unless html_text is set"`
+		HtmlText  string `json:"html_text" description:"HTML body, required unless plain_text is set"`
 	}
 	EmailAction struct {
+		helpers.Credentials
 		Input EmailInput
 	}
+
+	EmailOutput struct {
+		MessageID  string `json:"message_id" description:"SendGrid message ID"`
+		StatusCode int    `json:"status_code" description:"HTTP status returned by SendGrid"`
+	}
+)
+
+const (
+	SendGridProvider = "sendgrid"
+
+	// sendGridMessageIDHeader carries the id SendGrid assigns to an accepted message
+	sendGridMessageIDHeader = "X-Message-Id"
 )
 
 func NewEmailAction() (emailAction *EmailAction) {
@@ -31,41 +45,31 @@ func NewEmailAction() (emailAction *EmailAction) {
 }
 
 func (emailAction EmailAction) GetConfig() intf.FunctionConfig {
-	return intf.FunctionConfig{Name: "email"}
-}
-
-func (emailAction *EmailAction) ParsePayload(payload intf.Payload) error {
-	credManager := helpers.NewCredentialManager()
-
-	// Use credential manager to get API key from env variable or payload
-	apiKey := credManager.GetCredential(payload["api_key"], helpers.EnvSendGridAPIKey)
-
-	processedInput := EmailInput{
-		ApiKey:    apiKey,
-		FromEmail: payload["from_email"].(string),
-		ToEmail:   payload["to_email"].(string),
-		Subject:   payload["subject"].(string),
-	}
-
-	// Optional fields
-	if fromName, exists := payload["from_name"]; exists && fromName != nil {
-		processedInput.FromName = fromName.(string)
+	return intf.FunctionConfig{
+		Name:         "email",
+		Description:  "Send an email through SendGrid",
+		Version:      "1.0.0",
+		InputSchema:  helpers.GenerateSchema(EmailInput{}),
+		OutputSchema: helpers.GenerateSchema(EmailOutput{}),
+		Credentials:  []string{helpers.EnvSendGridAPIKey},
 	}
+}
 
-	if toName, exists := payload["to_name"]; exists && toName != nil {
-		processedInput.ToName = toName.(string)
-	}
+func (emailAction *EmailAction) ParsePayload(payload intf.Payload) (err error) {
+	credManager := emailAction.CredentialManager()
 
-	if plainText, exists := payload["plain_text"]; exists && plainText != nil {
-		processedInput.PlainText = plainText.(string)
+	processedInput := EmailInput{}
+	if err = helpers.DecodePayload(payload, &processedInput); err != nil {
+		return
 	}
 
-	if htmlText, exists := payload["html_text"]; exists && htmlText != nil {
-		processedInput.HtmlText = htmlText.(string)
+	// Use credential manager to get API key from env variable or payload
+	if processedInput.ApiKey, err = credManager.ResolveCredential(processedInput.ApiKey, helpers.EnvSendGridAPIKey); err != nil {
+		return
 	}
 
 	emailAction.Input = processedInput
-	return nil
+	return
 }
 
 func (emailAction EmailAction) Validate() (err error) {
@@ -87,7 +91,17 @@ func (emailAction EmailAction) Validate() (err error) {
 	return nil
 }
 
-func (emailAction EmailAction) Execute() (output intf.FunctionOutput, err error) {
+// Endpoint shares a circuit breaker between all SendGrid calls
+func (emailAction EmailAction) Endpoint() string {
+	return SendGridProvider
+}
+
+// RateLimitKey limits SendGrid calls per API key
+func (emailAction EmailAction) RateLimitKey() string {
+	return emailAction.Input.ApiKey
+}
+
+func (emailAction EmailAction) Execute(ctx context.Context) (output intf.FunctionOutput, err error) {
 	// Create sender and recipient
 	from := mail.NewEmail(emailAction.Input.FromName, emailAction.Input.FromEmail)
 	to := mail.NewEmail(emailAction.Input.ToName, emailAction.Input.ToEmail)
@@ -106,20 +120,55 @@ func (emailAction EmailAction) Execute() (output intf.FunctionOutput, err error)
 	// Create SendGrid client
 	client := sendgrid.NewSendClient(emailAction.Input.ApiKey)
 
+	ctx, span := helpers.StartProviderSpan(ctx, SendGridProvider, "send")
+	defer func() { helpers.EndSpan(ctx, span, err) }()
+
 	// Send the email
-	response, err := client.Send(message)
+	response, err := client.SendWithContext(ctx, message)
 	if err != nil {
-		log.Printf("Failed to send email: %v", err)
-		return nil, err
+		helpers.LoggerFromContext(ctx).Error("Failed to send email", "error", err)
+		return nil, sendGridSendError(err)
 	}
 
 	// Check if the response indicates success
-	if response.StatusCode >= 400 {
-		err = fmt.Errorf("sendgrid API error: status code %d, body: %s", response.StatusCode, response.Body)
-		log.Printf("SendGrid API error: %v", err)
+	if err = sendGridResponseError(response); err != nil {
+		helpers.LoggerFromContext(ctx).Error("SendGrid API error", "error", err)
 		return nil, err
 	}
 
-	log.Printf("Email sent successfully. Status: %d", response.StatusCode)
-	return nil, nil
+	emailOutput := EmailOutput{
+		StatusCode: response.StatusCode,
+	}
+	if messageIDs := response.Headers[sendGridMessageIDHeader]; len(messageIDs) > 0 {
+		emailOutput.MessageID = messageIDs[0]
+	}
+
+	helpers.LoggerFromContext(ctx).Info("Email sent successfully", "status_code", emailOutput.StatusCode, "message_id", emailOutput.MessageID)
+	return emailOutput, nil
+}
+
+// sendGridSendError classifies a send that got no response. SendGrid may
+// have accepted the email, so it is not retried.
+func sendGridSendError(err error) error {
+	providerErr := intf.NewProviderError(SendGridProvider, 0, err)
+	providerErr.Retryable = false
+	return providerErr
+}
+
+// sendGridResponseError classifies unsuccessful SendGrid responses, so that
+// rate limits and server errors are retried
+func sendGridResponseError(response *rest.Response) error {
+	if response.StatusCode < 400 {
+		return nil
+	}
+	providerErr := intf.NewProviderError(SendGridProvider, response.StatusCode,
+		fmt.Errorf("sendgrid API error: status code %d, body: %s", response.StatusCode, response.Body))
+	if retryAfter := response.Headers["Retry-After"]; len(retryAfter) > 0 {
+		providerErr.RetryAfter = helpers.ParseRetryAfter(retryAfter[0])
+	}
+	return providerErr
+}
+
+func (emailOutput EmailOutput) GetPayload() (intf.Payload, error) {
+	return helpers.ToPayload(emailOutput)
 }
@@ -1,11 +1,16 @@
 package functions
 
 import (
+	"errors"
+	"net/http"
 	"os"
+	"reflect"
 	"testing"
+	"time"
 
 	"github.com/gsarmaonline/faas/faas/helpers"
 	"github.com/gsarmaonline/faas/faas/intf"
+	"github.com/sendgrid/rest"
 )
 
 func TestEmailAction_GetConfig(t *testing.T) {
@@ -15,6 +20,20 @@ func TestEmailAction_GetConfig(t *testing.T) {
 	if config.Name != "email" {
 		t.Errorf("Expected config name 'email', got '%s'", config.Name)
 	}
+	if config.Description == "" || config.Version == "" {
+		t.Error("Expected config to carry a description and version")
+	}
+
+	wantRequired := []string{"from_email", "to_email", "subject"}
+	if !reflect.DeepEqual(config.InputSchema.Required, wantRequired) {
+		t.Errorf("InputSchema.Required = %v, want %v", config.InputSchema.Required, wantRequired)
+	}
+	if !config.InputSchema.Properties["api_key"].WriteOnly {
+		t.Error("Expected api_key to be marked as a credential")
+	}
+	if _, exists := config.OutputSchema.Properties["message_id"]; !exists {
+		t.Error("Expected OutputSchema to describe message_id")
+	}
 }
 
 func TestEmailAction_ParsePayload(t *testing.T) {
@@ -95,6 +114,7 @@ func TestEmailAction_ParsePayload(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			emailAction := NewEmailAction()
+			emailAction.SetCredentialResolver(envCredentialResolver())
 			err := emailAction.ParsePayload(tt.payload)
 
 			if err != nil {
@@ -278,7 +298,7 @@ func TestEmailAction_Execute_Integration(t *testing.T) {
 			return
 		}
 
-		_, err = emailAction.Execute()
+		_, err = emailAction.Execute(context.Background())
 		if err != nil {
 			t.Errorf("Execute() error = %v", err)
 		}
@@ -342,6 +362,7 @@ func TestEmailAction_ParsePayload_WithEnvironmentVariable(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			emailAction := NewEmailAction()
+			emailAction.SetCredentialResolver(envCredentialResolver())
 			err := emailAction.ParsePayload(tt.payload)
 
 			if err != nil {
@@ -408,3 +429,86 @@ func TestEmailAction_Validate_WithEnvironmentCredentials(t *testing.T) {
 		}
 	})
 }
+
+func TestEmailOutput_GetPayload(t *testing.T) {
+	output := EmailOutput{MessageID: "msg-123", StatusCode: 202}
+
+	payload, err := output.GetPayload()
+	if err != nil {
+		t.Fatalf("GetPayload() error = %v", err)
+	}
+	if payload["message_id"] != "msg-123" {
+		t.Errorf("message_id = %v, want %v", payload["message_id"], "msg-123")
+	}
+	if payload["status_code"] != float64(202) {
+		t.Errorf("status_code = %v, want %v", payload["status_code"], 202)
+	}
+}
+
+func TestSendGridResponseError(t *testing.T) {
+	tests := []struct {
+		name           string
+		response       *rest.Response
+		wantErr        bool
+		wantRetryable  bool
+		wantRetryAfter time.Duration
+	}{
+		{name: "accepted", response: &rest.Response{StatusCode: http.StatusAccepted}},
+		{
+			name:          "bad request",
+			response:      &rest.Response{StatusCode: http.StatusBadRequest, Body: "invalid"},
+			wantErr:       true,
+			wantRetryable: false,
+		},
+		{
+			name: "rate limited",
+			response: &rest.Response{
+				StatusCode: http.StatusTooManyRequests,
+				Headers:    map[string][]string{"Retry-After": {"7"}},
+			},
+			wantErr:        true,
+			wantRetryable:  true,
+			wantRetryAfter: 7 * time.Second,
+		},
+		{
+			name:          "server error",
+			response:      &rest.Response{StatusCode: http.StatusBadGateway},
+			wantErr:       true,
+			wantRetryable: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := sendGridResponseError(tt.response)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("sendGridResponseError() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := intf.IsRetryable(err); got != tt.wantRetryable {
+				t.Errorf("IsRetryable() = %v, want %v", got, tt.wantRetryable)
+			}
+			if got := intf.RetryAfter(err); got != tt.wantRetryAfter {
+				t.Errorf("RetryAfter() = %v, want %v", got, tt.wantRetryAfter)
+			}
+		})
+	}
+}
+
+func TestSendGridSendError(t *testing.T) {
+	err := sendGridSendError(errors.New("connection reset"))
+
+	var providerErr *intf.ProviderError
+	if !errors.As(err, &providerErr) || providerErr.Provider != SendGridProvider || providerErr.StatusCode != 0 {
+		t.Fatalf("sendGridSendError() = %v, want a sendgrid ProviderError without status", err)
+	}
+	if intf.IsRetryable(err) {
+		t.Error("IsRetryable() = true, want a send without response not to be retried")
+	}
+}
+
+func TestEmailAction_RateLimitKey(t *testing.T) {
+	emailAction := EmailAction{Input: EmailInput{ApiKey: "SG.key"}}
+	if got := emailAction.RateLimitKey(); got != "SG.key" {
+		t.Errorf("RateLimitKey() = %q, want the API key", got)
+	}
+}
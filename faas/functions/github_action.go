@@ -1,6 +1,8 @@
 package functions
 
 import (
+	"context"
+	"errors"
 	"fmt"
 
 	"github.com/gsarmaonline/faas/faas/helpers"
@@ -9,13 +11,26 @@ import (
 
 type (
 	GithubInput struct {
-		Repository string `json:"repository"`
-		Action     string `json:"action"`
-		Token      string `json:"token"`
+		Repository string `json:"repository" jsonschema:"required" description:"Repository in owner/name form"`
+		Action     string `json:"action" jsonschema:"required" description:"Repository action to run"`
+		Token      string `json:"token" jsonschema:"credential" description:"GitHub token, defaults to GITHUB_TOKEN"`
 	}
 	GithubAction struct {
+		helpers.Credentials
 		Input GithubInput
 	}
+
+	GithubOutput struct {
+		Repository string `json:"repository" description:"Repository the action ran on"`
+		Action     string `json:"action" description:"Repository action that was requested"`
+		Status     string `json:"status" description:"Outcome of the action"`
+	}
+)
+
+var (
+	// ErrNotImplemented is returned for GitHub actions, which are not
+	// carried out yet. It is not retryable.
+	ErrNotImplemented = errors.New("github actions are not implemented")
 )
 
 func NewGithubAction() (githubAction *GithubAction) {
@@ -23,20 +38,29 @@ func NewGithubAction() (githubAction *GithubAction) {
 }
 
 func (githubAction GithubAction) GetConfig() intf.FunctionConfig {
-	return intf.FunctionConfig{Name: "github"}
+	return intf.FunctionConfig{
+		Name:         "github",
+		Description:  "Run GitHub repository operations",
+		Version:      "0.1.0",
+		InputSchema:  helpers.GenerateSchema(GithubInput{}),
+		OutputSchema: helpers.GenerateSchema(GithubOutput{}),
+		Credentials:  []string{helpers.EnvGitHubToken},
+	}
 }
 
-func (githubAction *GithubAction) ParsePayload(payload intf.Payload) error {
-	credManager := helpers.NewCredentialManager()
-	
-	processedInput := GithubInput{
-		Repository: payload["repository"].(string),
-		Action:     payload["action"].(string),
-		Token:      credManager.GetCredential(payload["token"], helpers.EnvGitHubToken),
+func (githubAction *GithubAction) ParsePayload(payload intf.Payload) (err error) {
+	credManager := githubAction.CredentialManager()
+
+	processedInput := GithubInput{}
+	if err = helpers.DecodePayload(payload, &processedInput); err != nil {
+		return
+	}
+	if processedInput.Token, err = credManager.ResolveCredential(processedInput.Token, helpers.EnvGitHubToken); err != nil {
+		return
 	}
 
 	githubAction.Input = processedInput
-	return nil
+	return
 }
 
 func (githubAction GithubAction) Validate() (err error) {
@@ -49,8 +73,12 @@ func (githubAction GithubAction) Validate() (err error) {
 	return nil
 }
 
-func (githubAction GithubAction) Execute() (output intf.FunctionOutput, err error) {
+func (githubAction GithubAction) Execute(ctx context.Context) (output intf.FunctionOutput, err error) {
 	// TODO: Implement actual GitHub API calls here
-	// For now, this is a placeholder implementation
+	err = fmt.Errorf("%s on %s: %w", githubAction.Input.Action, githubAction.Input.Repository, ErrNotImplemented)
 	return
 }
+
+func (githubOutput GithubOutput) GetPayload() (intf.Payload, error) {
+	return helpers.ToPayload(githubOutput)
+}
@@ -1,6 +1,8 @@
 package functions
 
 import (
+	"context"
+	"errors"
 	"testing"
 
 	"github.com/gsarmaonline/faas/faas/intf"
@@ -63,6 +65,7 @@ func TestGithubAction_ParsePayload(t *testing.T) {
 			}
 
 			githubAction := NewGithubAction()
+			githubAction.SetCredentialResolver(envCredentialResolver())
 			err := githubAction.ParsePayload(tt.payload)
 
 			if err != nil {
@@ -135,3 +138,14 @@ func TestGithubAction_Validate(t *testing.T) {
 		})
 	}
 }
+
+func TestGithubAction_Execute(t *testing.T) {
+	githubAction := GithubAction{Input: GithubInput{Repository: "owner/repo", Action: "create_issue"}}
+	output, err := githubAction.Execute(context.Background())
+	if !errors.Is(err, ErrNotImplemented) || intf.IsRetryable(err) {
+		t.Errorf("Execute() error = %v, want non-retryable %v", err, ErrNotImplemented)
+	}
+	if output != nil {
+		t.Errorf("Execute() output = %v, want nil", output)
+	}
+}
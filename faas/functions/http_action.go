@@ -2,32 +2,49 @@ package functions
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 
+	"github.com/gsarmaonline/faas/faas/helpers"
 	"github.com/gsarmaonline/faas/faas/intf"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
 )
 
 const (
 	// Http Methods
 	GetHttpMethod  = HttpMethodT("GET")
 	PostHttpMethod = HttpMethodT("POST")
+
+	HttpProvider = "http"
+
+	// maxHttpResponseBodyBytes caps how much of a response body is kept in
+	// the output
+	maxHttpResponseBodyBytes = 10 << 20
 )
 
 type (
 	HttpMethodT string
 
 	HttpInput struct {
-		Url         string      `json:"url"`
-		Method      HttpMethodT `json:"method"`
-		RequestBody interface{} `json:"request_body"`
+		Url         string      `json:"url" jsonschema:"required,format=uri" description:"URL to request"`
+		Method      HttpMethodT `json:"method" jsonschema:"required" description:"HTTP method, such as GET or POST"`
+		RequestBody interface{} `json:"request_body" description:"Value sent as the JSON request body"`
 	}
 
 	HttpAction struct {
 		Input HttpInput
 	}
+
+	HttpOutput struct {
+		StatusCode int                 `json:"status_code" description:"HTTP status code of the response"`
+		Headers    map[string][]string `json:"headers" description:"Response headers"`
+		Body       string              `json:"body" description:"Response body"`
+	}
 )
 
 func NewHttpAction() (httpAction *HttpAction) {
@@ -35,22 +52,23 @@ func NewHttpAction() (httpAction *HttpAction) {
 }
 
 func (httpAction HttpAction) GetConfig() intf.FunctionConfig {
-	return intf.FunctionConfig{Name: "http"}
-}
-
-func (httpAction *HttpAction) ParsePayload(payload intf.Payload) error {
-	processedInput := HttpInput{
-		Url:    payload["url"].(string),
-		Method: HttpMethodT(payload["method"].(string)),
+	return intf.FunctionConfig{
+		Name:         "http",
+		Description:  "Make an HTTP request",
+		Version:      "1.0.0",
+		InputSchema:  helpers.GenerateSchema(HttpInput{}),
+		OutputSchema: helpers.GenerateSchema(HttpOutput{}),
 	}
+}
 
-	// Optional request body
-	if requestBody, exists := payload["request_body"]; exists {
-		processedInput.RequestBody = requestBody
+func (httpAction *HttpAction) ParsePayload(payload intf.Payload) (err error) {
+	processedInput := HttpInput{}
+	if err = helpers.DecodePayload(payload, &processedInput); err != nil {
+		return
 	}
 
 	httpAction.Input = processedInput
-	return nil
+	return
 }
 
 func (httpAction HttpAction) Validate() (err error) {
@@ -63,12 +81,37 @@ func (httpAction HttpAction) Validate() (err error) {
 	return nil
 }
 
-func (httpAction HttpAction) Execute() (output intf.FunctionOutput, err error) {
+// Endpoint gives every host its own circuit breaker
+func (httpAction HttpAction) Endpoint() string {
+	if parsed, err := url.Parse(httpAction.Input.Url); err == nil {
+		return HttpProvider + ":" + parsed.Host
+	}
+	return HttpProvider
+}
+
+// spanURL drops the query, fragment and user info of rawURL, which commonly
+// carry tokens, and masks known secrets in the rest
+func spanURL(ctx context.Context, rawURL string) string {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return helpers.RedactorFromContext(ctx).String(rawURL)
+	}
+	parsed.User = nil
+	parsed.RawQuery = ""
+	parsed.ForceQuery = false
+	parsed.Fragment = ""
+	parsed.RawFragment = ""
+	return helpers.RedactorFromContext(ctx).String(parsed.String())
+}
+
+func (httpAction HttpAction) Execute(ctx context.Context) (output intf.FunctionOutput, err error) {
 	var (
 		client   *http.Client
 		req      *http.Request
+		resp     *http.Response
 		reqBody  io.Reader
 		payloadB []byte
+		respB    []byte
 	)
 
 	client = &http.Client{}
@@ -76,12 +119,50 @@ func (httpAction HttpAction) Execute() (output intf.FunctionOutput, err error) {
 		return
 	}
 	reqBody = bytes.NewBuffer(payloadB)
-	if req, err = http.NewRequest(string(httpAction.Input.Method), httpAction.Input.Url, reqBody); err != nil {
+
+	ctx, span := helpers.StartProviderSpan(ctx, HttpProvider, "request")
+	span.SetAttributes(
+		attribute.String("http.request.method", string(httpAction.Input.Method)),
+		attribute.String("url.full", spanURL(ctx, httpAction.Input.Url)),
+	)
+	defer func() { helpers.EndSpan(ctx, span, err) }()
+
+	if req, err = http.NewRequestWithContext(ctx, string(httpAction.Input.Method), httpAction.Input.Url, reqBody); err != nil {
 		return
 	}
-	if _, err = client.Do(req); err != nil {
+	// Propagate the trace to the called service with W3C trace context
+	// headers
+	propagation.TraceContext{}.Inject(ctx, propagation.HeaderCarrier(req.Header))
+	if resp, err = client.Do(req); err != nil {
+		// Requests that may have reached the server are only retried
+		// when they are safe to repeat
+		providerErr := intf.NewProviderError(HttpProvider, 0, err)
+		providerErr.Retryable = httpAction.Input.Method == GetHttpMethod
+		err = providerErr
 		return
 	}
+	defer resp.Body.Close()
+	span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
 
+	if respB, err = io.ReadAll(io.LimitReader(resp.Body, maxHttpResponseBodyBytes)); err != nil {
+		return
+	}
+	output = HttpOutput{
+		StatusCode: resp.StatusCode,
+		Headers:    resp.Header,
+		Body:       string(respB),
+	}
+	if resp.StatusCode >= http.StatusInternalServerError {
+		// Server errors count against the circuit of the host and are
+		// only retried for requests that are safe to repeat
+		providerErr := intf.NewProviderError(HttpProvider, resp.StatusCode, fmt.Errorf("server responded with %s", resp.Status))
+		providerErr.Retryable = httpAction.Input.Method == GetHttpMethod
+		providerErr.RetryAfter = helpers.ParseRetryAfter(resp.Header.Get("Retry-After"))
+		err = providerErr
+	}
 	return
 }
+
+func (httpOutput HttpOutput) GetPayload() (intf.Payload, error) {
+	return helpers.ToPayload(httpOutput)
+}
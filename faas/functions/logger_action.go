@@ -1,18 +1,23 @@
 package functions
 
 import (
-	"log"
+	"context"
 
+	"github.com/gsarmaonline/faas/faas/helpers"
 	"github.com/gsarmaonline/faas/faas/intf"
 )
 
 type (
 	LoggerInput struct {
-		Message string `json:"message"`
+		Message string `json:"message" description:"Message to log"`
 	}
 	LoggerAction struct {
 		Input LoggerInput
 	}
+
+	LoggerOutput struct {
+		Message string `json:"message" description:"Message that was logged"`
+	}
 )
 
 func NewLoggerAction() (loggerAction *LoggerAction) {
@@ -20,19 +25,23 @@ func NewLoggerAction() (loggerAction *LoggerAction) {
 }
 
 func (loggerAction LoggerAction) GetConfig() intf.FunctionConfig {
-	return intf.FunctionConfig{Name: "logger"}
+	return intf.FunctionConfig{
+		Name:         "logger",
+		Description:  "Log a message",
+		Version:      "1.0.0",
+		InputSchema:  helpers.GenerateSchema(LoggerInput{}),
+		OutputSchema: helpers.GenerateSchema(LoggerOutput{}),
+	}
 }
 
-func (loggerAction *LoggerAction) ParsePayload(payload intf.Payload) error {
+func (loggerAction *LoggerAction) ParsePayload(payload intf.Payload) (err error) {
 	processedInput := LoggerInput{}
-
-	// Optional message field
-	if message, exists := payload["message"]; exists && message != nil {
-		processedInput.Message = message.(string)
+	if err = helpers.DecodePayload(payload, &processedInput); err != nil {
+		return
 	}
 
 	loggerAction.Input = processedInput
-	return nil
+	return
 }
 
 func (loggerAction LoggerAction) Validate() (err error) {
@@ -40,11 +49,16 @@ func (loggerAction LoggerAction) Validate() (err error) {
 	return nil
 }
 
-func (loggerAction LoggerAction) Execute() (output intf.FunctionOutput, err error) {
+func (loggerAction LoggerAction) Execute(ctx context.Context) (output intf.FunctionOutput, err error) {
 	if loggerAction.Input.Message != "" {
-		log.Println("From Logger action:", loggerAction.Input.Message)
+		helpers.LoggerFromContext(ctx).Info("From Logger action", "message", loggerAction.Input.Message)
 	} else {
-		log.Println("From Logger action: (no message provided)")
+		helpers.LoggerFromContext(ctx).Info("From Logger action: (no message provided)")
 	}
+	output = LoggerOutput{Message: loggerAction.Input.Message}
 	return
 }
+
+func (loggerOutput LoggerOutput) GetPayload() (intf.Payload, error) {
+	return helpers.ToPayload(loggerOutput)
+}
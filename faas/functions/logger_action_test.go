@@ -1,6 +1,7 @@
 package functions
 
 import (
+	"context"
 	"testing"
 
 	"github.com/gsarmaonline/faas/faas/intf"
@@ -89,3 +90,19 @@ func TestLoggerAction_Validate(t *testing.T) {
 		})
 	}
 }
+
+func TestLoggerAction_Execute(t *testing.T) {
+	loggerAction := LoggerAction{Input: LoggerInput{Message: "Hello from FAAS Logger!"}}
+
+	output, err := loggerAction.Execute(context.Background())
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	payload, err := output.GetPayload()
+	if err != nil {
+		t.Fatalf("GetPayload() error = %v", err)
+	}
+	if payload["message"] != "Hello from FAAS Logger!" {
+		t.Errorf("message = %v, want %v", payload["message"], "Hello from FAAS Logger!")
+	}
+}
@@ -2,8 +2,9 @@ package functions
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
+	"net/http"
 
 	"github.com/gsarmaonline/faas/faas/helpers"
 	"github.com/gsarmaonline/faas/faas/intf"
@@ -12,13 +13,23 @@ import (
 
 type (
 	SlackInput struct {
-		ApiToken  string `json:"api_token"`
-		Message   string `json:"message"`
-		ChannelID string `json:"channel_id"`
+		ApiToken  string `json:"api_token" jsonschema:"credential" description:"Slack bot token, defaults to SLACK_API_TOKEN"`
+		Message   string `json:"message" jsonschema:"required" description:"Message text"`
+		ChannelID string `json:"channel_id" jsonschema:"required" description:"ID of the channel to post to"`
 	}
 	Slack struct {
+		helpers.Credentials
 		Input SlackInput
 	}
+
+	SlackOutput struct {
+		ChannelID string `json:"channel_id" description:"ID of the channel the message was posted to"`
+		Timestamp string `json:"timestamp" description:"Slack timestamp of the posted message"`
+	}
+)
+
+const (
+	SlackProvider = "slack"
 )
 
 func NewSlack() (slackFunc *Slack) {
@@ -26,19 +37,29 @@ func NewSlack() (slackFunc *Slack) {
 }
 
 func (slackFunc Slack) GetConfig() intf.FunctionConfig {
-	return intf.FunctionConfig{Name: "slack"}
+	return intf.FunctionConfig{
+		Name:         "slack",
+		Description:  "Post a message to a Slack channel",
+		Version:      "1.0.0",
+		InputSchema:  helpers.GenerateSchema(SlackInput{}),
+		OutputSchema: helpers.GenerateSchema(SlackOutput{}),
+		Credentials:  []string{helpers.EnvSlackAPIToken},
+	}
 }
 
-func (slackFunc *Slack) ParsePayload(payload intf.Payload) error {
-	credManager := helpers.NewCredentialManager()
-	
-	processedSlackInput := SlackInput{
-		ApiToken:  credManager.GetCredential(payload["api_token"], helpers.EnvSlackAPIToken),
-		Message:   payload["message"].(string),
-		ChannelID: payload["channel_id"].(string),
+func (slackFunc *Slack) ParsePayload(payload intf.Payload) (err error) {
+	credManager := slackFunc.CredentialManager()
+
+	processedSlackInput := SlackInput{}
+	if err = helpers.DecodePayload(payload, &processedSlackInput); err != nil {
+		return
+	}
+	if processedSlackInput.ApiToken, err = credManager.ResolveCredential(processedSlackInput.ApiToken, helpers.EnvSlackAPIToken); err != nil {
+		return
 	}
+
 	slackFunc.Input = processedSlackInput
-	return nil
+	return
 }
 
 func (slackFunc Slack) Validate() (err error) {
@@ -49,14 +70,58 @@ func (slackFunc Slack) Validate() (err error) {
 	return
 }
 
-func (slackFunc Slack) Execute() (output intf.FunctionOutput, err error) {
+// Endpoint shares a circuit breaker between all Slack calls
+func (slackFunc Slack) Endpoint() string {
+	return SlackProvider
+}
+
+// RateLimitKey limits Slack calls per bot token
+func (slackFunc Slack) RateLimitKey() string {
+	return slackFunc.Input.ApiToken
+}
+
+func (slackFunc Slack) Execute(ctx context.Context) (output intf.FunctionOutput, err error) {
+	var channelID, timestamp string
+
 	client := slack.New(slackFunc.Input.ApiToken)
 
-	if _, _, err = client.PostMessageContext(context.Background(),
+	ctx, span := helpers.StartProviderSpan(ctx, SlackProvider, "post_message")
+	defer func() { helpers.EndSpan(ctx, span, err) }()
+
+	if channelID, timestamp, err = client.PostMessageContext(ctx,
 		slackFunc.Input.ChannelID,
 		slack.MsgOptionText(slackFunc.Input.Message, false),
 	); err != nil {
-		log.Println("Failed to post slack message", err)
+		helpers.LoggerFromContext(ctx).Error("Failed to post slack message", "error", err)
+		err = slackError(err)
+		return
+	}
+	output = SlackOutput{
+		ChannelID: channelID,
+		Timestamp: timestamp,
 	}
 	return
 }
+
+// slackError classifies errors of the Slack client. Rate limits and HTTP
+// failures become provider errors; Slack API errors such as
+// channel_not_found are returned as they are and never retried.
+func slackError(err error) error {
+	var (
+		rateLimitedErr *slack.RateLimitedError
+		statusCodeErr  slack.StatusCodeError
+	)
+	switch {
+	case errors.As(err, &rateLimitedErr):
+		providerErr := intf.NewProviderError(SlackProvider, http.StatusTooManyRequests, err)
+		providerErr.RetryAfter = rateLimitedErr.RetryAfter
+		return providerErr
+	case errors.As(err, &statusCodeErr):
+		return intf.NewProviderError(SlackProvider, statusCodeErr.Code, err)
+	}
+	return err
+}
+
+func (slackOutput SlackOutput) GetPayload() (intf.Payload, error) {
+	return helpers.ToPayload(slackOutput)
+}
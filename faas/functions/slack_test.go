@@ -1,9 +1,12 @@
 package functions
 
 import (
+	"errors"
 	"testing"
+	"time"
 
 	"github.com/gsarmaonline/faas/faas/intf"
+	"github.com/slack-go/slack"
 )
 
 func TestSlack_GetConfig(t *testing.T) {
@@ -63,6 +66,7 @@ func TestSlack_ParsePayload(t *testing.T) {
 			}
 
 			slack := NewSlack()
+			slack.SetCredentialResolver(envCredentialResolver())
 			err := slack.ParsePayload(tt.payload)
 
 			if err != nil {
@@ -135,3 +139,54 @@ func TestSlack_Validate(t *testing.T) {
 		})
 	}
 }
+
+func TestSlackOutput_GetPayload(t *testing.T) {
+	output := SlackOutput{ChannelID: "C1234567890", Timestamp: "1503435956.000247"}
+
+	payload, err := output.GetPayload()
+	if err != nil {
+		t.Fatalf("GetPayload() error = %v", err)
+	}
+	if payload["channel_id"] != "C1234567890" {
+		t.Errorf("channel_id = %v, want %v", payload["channel_id"], "C1234567890")
+	}
+	if payload["timestamp"] != "1503435956.000247" {
+		t.Errorf("timestamp = %v, want %v", payload["timestamp"], "1503435956.000247")
+	}
+}
+
+func TestSlackError(t *testing.T) {
+	tests := []struct {
+		name           string
+		err            error
+		wantRetryable  bool
+		wantRetryAfter time.Duration
+	}{
+		{name: "rate limited", err: &slack.RateLimitedError{RetryAfter: 3 * time.Second}, wantRetryable: true, wantRetryAfter: 3 * time.Second},
+		{name: "server error", err: slack.StatusCodeError{Code: 503, Status: "Service Unavailable"}, wantRetryable: true},
+		{name: "client error", err: slack.StatusCodeError{Code: 404, Status: "Not Found"}, wantRetryable: false},
+		{name: "api error", err: errors.New("channel_not_found"), wantRetryable: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := slackError(tt.err)
+			if got := intf.IsRetryable(err); got != tt.wantRetryable {
+				t.Errorf("IsRetryable() = %v, want %v", got, tt.wantRetryable)
+			}
+			if got := intf.RetryAfter(err); got != tt.wantRetryAfter {
+				t.Errorf("RetryAfter() = %v, want %v", got, tt.wantRetryAfter)
+			}
+			if !errors.Is(err, tt.err) {
+				t.Errorf("slackError() = %v, want wrapping %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestSlack_RateLimitKey(t *testing.T) {
+	slack := Slack{Input: SlackInput{ApiToken: "xoxb-token"}}
+	if got := slack.RateLimitKey(); got != "xoxb-token" {
+		t.Errorf("RateLimitKey() = %q, want the bot token", got)
+	}
+}
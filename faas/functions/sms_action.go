@@ -1,27 +1,43 @@
 package functions
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"time"
 
 	"github.com/gsarmaonline/faas/faas/helpers"
 	"github.com/gsarmaonline/faas/faas/intf"
 	"github.com/twilio/twilio-go"
+	twilioClient "github.com/twilio/twilio-go/client"
 	twilioApi "github.com/twilio/twilio-go/rest/api/v2010"
 )
 
 type (
 	SmsInput struct {
-		AccountSid string `json:"account_sid"`
-		AuthToken  string `json:"auth_token"`
-		From       string `json:"from"`
-		To         string `json:"to"`
-		Body       string `json:"body"`
-		MediaUrl   string `json:"media_url,omitempty"`
+		AccountSid string `json:"account_sid" jsonschema:"credential" description:"Twilio account SID, defaults to TWILIO_ACCOUNT_SID"`
+		AuthToken  string `json:"auth_token" jsonschema:"credential" description:"Twilio auth token, defaults to TWILIO_AUTH_TOKEN"`
+		From       string `json:"from" jsonschema:"required" description:"Sender phone number"`
+		To         string `json:"to" jsonschema:"required" description:"Recipient phone number"`
+		Body       string `json:"body" description:"Message text, required unless media_url is set"`
+		MediaUrl   string `json:"media_url,omitempty" jsonschema:"format=uri" description:"Media to attach as an MMS"`
 	}
 	SmsAction struct {
+		helpers.Credentials
 		Input SmsInput
 	}
+
+	SmsOutput struct {
+		Sid    string `json:"sid" description:"Twilio message SID"`
+		Status string `json:"status" description:"Twilio message status"`
+	}
+)
+
+const (
+	TwilioProvider = "twilio"
 )
 
 func NewSmsAction() (smsAction *SmsAction) {
@@ -29,27 +45,32 @@ func NewSmsAction() (smsAction *SmsAction) {
 }
 
 func (smsAction SmsAction) GetConfig() intf.FunctionConfig {
-	return intf.FunctionConfig{Name: "sms"}
+	return intf.FunctionConfig{
+		Name:         "sms",
+		Description:  "Send an SMS or MMS through Twilio",
+		Version:      "1.0.0",
+		InputSchema:  helpers.GenerateSchema(SmsInput{}),
+		OutputSchema: helpers.GenerateSchema(SmsOutput{}),
+		Credentials:  []string{helpers.EnvTwilioAccountSID, helpers.EnvTwilioAuthToken},
+	}
 }
 
-func (smsAction *SmsAction) ParsePayload(payload intf.Payload) error {
-	credManager := helpers.NewCredentialManager()
-	
-	processedInput := SmsInput{
-		AccountSid: credManager.GetCredential(payload["account_sid"], helpers.EnvTwilioAccountSID),
-		AuthToken:  credManager.GetCredential(payload["auth_token"], helpers.EnvTwilioAuthToken),
-		From:       payload["from"].(string),
-		To:         payload["to"].(string),
-		Body:       payload["body"].(string),
-	}
+func (smsAction *SmsAction) ParsePayload(payload intf.Payload) (err error) {
+	credManager := smsAction.CredentialManager()
 
-	// Optional media URL for MMS
-	if mediaUrl, exists := payload["media_url"]; exists && mediaUrl != nil {
-		processedInput.MediaUrl = mediaUrl.(string)
+	processedInput := SmsInput{}
+	if err = helpers.DecodePayload(payload, &processedInput); err != nil {
+		return
+	}
+	if processedInput.AccountSid, err = credManager.ResolveCredential(processedInput.AccountSid, helpers.EnvTwilioAccountSID); err != nil {
+		return
+	}
+	if processedInput.AuthToken, err = credManager.ResolveCredential(processedInput.AuthToken, helpers.EnvTwilioAuthToken); err != nil {
+		return
 	}
 
 	smsAction.Input = processedInput
-	return nil
+	return
 }
 
 func (smsAction SmsAction) Validate() (err error) {
@@ -71,11 +92,29 @@ func (smsAction SmsAction) Validate() (err error) {
 	return nil
 }
 
-func (smsAction SmsAction) Execute() (output intf.FunctionOutput, err error) {
-	// Create Twilio client
+// Endpoint shares a circuit breaker between all Twilio calls
+func (smsAction SmsAction) Endpoint() string {
+	return TwilioProvider
+}
+
+// RateLimitKey limits Twilio calls per account
+func (smsAction SmsAction) RateLimitKey() string {
+	return smsAction.Input.AccountSid
+}
+
+func (smsAction SmsAction) Execute(ctx context.Context) (output intf.FunctionOutput, err error) {
+	ctx, span := helpers.StartProviderSpan(ctx, TwilioProvider, "create_message")
+	defer func() { helpers.EndSpan(ctx, span, err) }()
+
+	// Create Twilio client. The Twilio SDK does not accept a context, so
+	// requests are bound to ctx through the HTTP client instead.
+	baseClient := &twilioClient.Client{
+		Credentials: twilioClient.NewCredentials(smsAction.Input.AccountSid, smsAction.Input.AuthToken),
+		HTTPClient:  helpers.NewContextHTTPClient(ctx, twilioHTTPClient()),
+	}
+	baseClient.SetAccountSid(smsAction.Input.AccountSid)
 	client := twilio.NewRestClientWithParams(twilio.ClientParams{
-		Username: smsAction.Input.AccountSid,
-		Password: smsAction.Input.AuthToken,
+		Client: baseClient,
 	})
 
 	// Prepare message parameters
@@ -96,16 +135,55 @@ func (smsAction SmsAction) Execute() (output intf.FunctionOutput, err error) {
 	// Send the message
 	resp, err := client.Api.CreateMessage(params)
 	if err != nil {
-		log.Printf("Failed to send SMS: %v", err)
-		return nil, err
+		helpers.LoggerFromContext(ctx).Error("Failed to send SMS", "error", err)
+		return nil, twilioError(err)
 	}
 
-	// Log successful send
+	smsOutput := SmsOutput{}
 	if resp.Sid != nil {
-		log.Printf("SMS sent successfully. SID: %s, Status: %s", *resp.Sid, *resp.Status)
-	} else {
-		log.Printf("SMS sent successfully. Status: %s", *resp.Status)
+		smsOutput.Sid = *resp.Sid
+	}
+	if resp.Status != nil {
+		smsOutput.Status = *resp.Status
 	}
 
-	return nil, nil
+	// Log successful send
+	helpers.LoggerFromContext(ctx).Info("SMS sent successfully", "sid", smsOutput.Sid, "status", smsOutput.Status)
+	return smsOutput, nil
+}
+
+// twilioStatusPattern matches the status code in the errors the Twilio SDK
+// returns for error responses whose body is not JSON, e.g. from a proxy
+var twilioStatusPattern = regexp.MustCompile(`HTTP error code: (\d{3})`)
+
+// twilioError classifies errors of the Twilio SDK, so that rate limits and
+// server errors are retried. Requests without a response are not retried
+// since Twilio may have sent the message.
+func twilioError(err error) error {
+	var restErr *twilioClient.TwilioRestError
+	if errors.As(err, &restErr) {
+		return intf.NewProviderError(TwilioProvider, restErr.Status, err)
+	}
+	if match := twilioStatusPattern.FindStringSubmatch(err.Error()); match != nil {
+		status, _ := strconv.Atoi(match[1])
+		return intf.NewProviderError(TwilioProvider, status, err)
+	}
+	providerErr := intf.NewProviderError(TwilioProvider, 0, err)
+	providerErr.Retryable = false
+	return providerErr
+}
+
+func (smsOutput SmsOutput) GetPayload() (intf.Payload, error) {
+	return helpers.ToPayload(smsOutput)
+}
+
+// twilioHTTPClient mirrors the default HTTP client of the Twilio SDK, which
+// does not follow redirects
+func twilioHTTPClient() *http.Client {
+	return &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+		Timeout: 10 * time.Second,
+	}
 }
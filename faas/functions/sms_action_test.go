@@ -1,9 +1,12 @@
 package functions
 
 import (
+	"errors"
 	"testing"
 
+	"github.com/gsarmaonline/faas/faas/helpers"
 	"github.com/gsarmaonline/faas/faas/intf"
+	twilioClient "github.com/twilio/twilio-go/client"
 )
 
 func TestSmsAction_GetConfig(t *testing.T) {
@@ -93,6 +96,7 @@ func TestSmsAction_ParsePayload(t *testing.T) {
 			}
 			
 			smsAction := NewSmsAction()
+			smsAction.SetCredentialResolver(envCredentialResolver())
 			err := smsAction.ParsePayload(tt.payload)
 
 			if err != nil {
@@ -274,9 +278,80 @@ func TestSmsAction_Execute_Integration(t *testing.T) {
 			return
 		}
 
-		_, err = smsAction.Execute()
+		_, err = smsAction.Execute(context.Background())
 		if err != nil {
 			t.Errorf("Execute() error = %v", err)
 		}
 	*/
 }
+
+func TestSmsOutput_GetPayload(t *testing.T) {
+	output := SmsOutput{Sid: "SM123", Status: "queued"}
+
+	payload, err := output.GetPayload()
+	if err != nil {
+		t.Fatalf("GetPayload() error = %v", err)
+	}
+	if payload["sid"] != "SM123" {
+		t.Errorf("sid = %v, want %v", payload["sid"], "SM123")
+	}
+	if payload["status"] != "queued" {
+		t.Errorf("status = %v, want %v", payload["status"], "queued")
+	}
+}
+
+func TestSmsAction_ParsePayload_InvalidTypes(t *testing.T) {
+	smsAction := NewSmsAction()
+	smsAction.SetCredentialResolver(envCredentialResolver())
+	err := smsAction.ParsePayload(intf.Payload{
+		"from": float64(1234567890),
+		"to":   "+0987654321",
+		"body": true,
+	})
+
+	var payloadErr *helpers.PayloadError
+	if !errors.As(err, &payloadErr) {
+		t.Fatalf("ParsePayload() error = %v, want *helpers.PayloadError", err)
+	}
+	if len(payloadErr.Errors) != 2 {
+		t.Errorf("Errors = %v, want errors for from and body", payloadErr.Errors)
+	}
+
+	// A missing body is reported by Validate instead of panicking
+	smsAction = NewSmsAction()
+	smsAction.SetCredentialResolver(envCredentialResolver())
+	if err = smsAction.ParsePayload(intf.Payload{"from": "+1234567890", "to": "+0987654321"}); err != nil {
+		t.Errorf("ParsePayload() error = %v, want nil", err)
+	}
+}
+
+func TestTwilioError(t *testing.T) {
+	tests := []struct {
+		name          string
+		err           error
+		wantRetryable bool
+	}{
+		{name: "rate limited", err: &twilioClient.TwilioRestError{Status: 429}, wantRetryable: true},
+		{name: "server error", err: &twilioClient.TwilioRestError{Status: 500}, wantRetryable: true},
+		{name: "invalid number", err: &twilioClient.TwilioRestError{Status: 400, Code: 21211}, wantRetryable: false},
+		{name: "transport error", err: errors.New("connection reset"), wantRetryable: false},
+		{name: "server error without JSON", err: errors.New("error decoding the response for an HTTP error code: 503: invalid character '<'"), wantRetryable: true},
+		{name: "rate limited without JSON", err: errors.New("error decoding the response for an HTTP error code: 429: EOF"), wantRetryable: true},
+		{name: "client error without JSON", err: errors.New("error decoding the response for an HTTP error code: 401: EOF"), wantRetryable: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := intf.IsRetryable(twilioError(tt.err)); got != tt.wantRetryable {
+				t.Errorf("IsRetryable() = %v, want %v", got, tt.wantRetryable)
+			}
+		})
+	}
+}
+
+func TestSmsAction_RateLimitKey(t *testing.T) {
+	smsAction := SmsAction{Input: SmsInput{AccountSid: "AC123", AuthToken: "token"}}
+	if got := smsAction.RateLimitKey(); got != "AC123" {
+		t.Errorf("RateLimitKey() = %q, want the account SID", got)
+	}
+}
@@ -1,35 +1,67 @@
 package helpers
 
 import (
-	"bufio"
+	"context"
+	"errors"
 	"fmt"
 	"os"
-	"strings"
+
+	"github.com/gsarmaonline/faas/faas/intf"
 )
 
-// CredentialManager handles reading credentials from environment variables
-// with optional payload overrides
-type CredentialManager struct{}
+// ErrNoCredentialResolver is returned for credentials that are not in the
+// payload when no CredentialResolver was injected
+var ErrNoCredentialResolver = errors.New("no credential resolver: invoke the function through Faas or inject a resolver")
+
+type credentialResolverKeyT struct{}
+
+// noCredentialResolver resolves nothing, so that credentials are only read
+// through the resolver Faas scopes and audits
+type noCredentialResolver struct{}
+
+// CredentialManager reads credentials from the payload, falling back to a
+// CredentialResolver
+type CredentialManager struct {
+	resolver intf.CredentialResolver
+}
+
+// Credentials lets Faas inject its secret providers into a function. Embed
+// it in a function and resolve credentials with its CredentialManager.
+type Credentials struct {
+	resolver intf.CredentialResolver
+}
 
 // GetCredential reads a credential value with the following priority:
 // 1. Payload value (if provided)
-// 2. Environment variable
+// 2. Value of envVarName in the resolver of the manager
 // 3. Empty string (if neither is available)
+// Errors of the resolver are treated as a missing value; use
+// ResolveCredential to handle them.
 func (cm *CredentialManager) GetCredential(payloadValue interface{}, envVarName string) string {
+	value, _ := cm.ResolveCredential(payloadValue, envVarName)
+	return value
+}
+
+// ResolveCredential is like GetCredential but returns the errors of the
+// resolver, e.g. when a secret store is unreachable
+func (cm *CredentialManager) ResolveCredential(payloadValue interface{}, envVarName string) (string, error) {
 	// First check if payload has the value
 	if payloadValue != nil {
 		if str, ok := payloadValue.(string); ok && str != "" {
-			return str
+			return str, nil
 		}
 	}
 
-	// Fall back to environment variable
-	return os.Getenv(envVarName)
+	// Fall back to the resolver
+	return cm.resolver.ResolveCredential(envVarName)
 }
 
-// GetRequiredCredential is like GetCredential but returns an error if no value is found
+// GetRequiredCredential is like ResolveCredential but returns an error if no value is found
 func (cm *CredentialManager) GetRequiredCredential(payloadValue interface{}, envVarName, fieldName string) (string, error) {
-	value := cm.GetCredential(payloadValue, envVarName)
+	value, err := cm.ResolveCredential(payloadValue, envVarName)
+	if err != nil {
+		return "", err
+	}
 	if value == "" {
 		return "", fmt.Errorf("missing required credential: %s (provide in payload or set %s environment variable)", fieldName, envVarName)
 	}
@@ -56,9 +88,52 @@ const (
 	EnvGitHubToken = "GITHUB_TOKEN"
 )
 
-// NewCredentialManager creates a new credential manager instance
+// NewCredentialManager creates a credential manager that only reads
+// payload values.
+//
+// Deprecated: embed Credentials or use CredentialManagerFromContext, which
+// resolve through the scoped and audited resolver of the invocation.
 func NewCredentialManager() *CredentialManager {
-	return &CredentialManager{}
+	return NewCredentialManagerWithResolver(nil)
+}
+
+// NewCredentialManagerWithResolver creates a credential manager that falls
+// back to resolver. A nil resolver resolves nothing and fails with
+// ErrNoCredentialResolver.
+func NewCredentialManagerWithResolver(resolver intf.CredentialResolver) *CredentialManager {
+	if resolver == nil {
+		resolver = noCredentialResolver{}
+	}
+	return &CredentialManager{resolver: resolver}
+}
+
+// WithCredentialResolver returns a context that carries the credential
+// resolver of an invocation
+func WithCredentialResolver(ctx context.Context, resolver intf.CredentialResolver) context.Context {
+	return context.WithValue(ctx, credentialResolverKeyT{}, resolver)
+}
+
+// CredentialManagerFromContext returns a manager that resolves through the
+// resolver Faas attaches to the context of an invocation, for functions that
+// read credentials in Execute instead of embedding Credentials
+func CredentialManagerFromContext(ctx context.Context) *CredentialManager {
+	resolver, _ := ctx.Value(credentialResolverKeyT{}).(intf.CredentialResolver)
+	return NewCredentialManagerWithResolver(resolver)
+}
+
+func (noCredentialResolver) ResolveCredential(key string) (string, error) {
+	return "", fmt.Errorf("%s: %w", key, ErrNoCredentialResolver)
+}
+
+// SetCredentialResolver implements intf.CredentialConsumer
+func (credentials *Credentials) SetCredentialResolver(resolver intf.CredentialResolver) {
+	credentials.resolver = resolver
+}
+
+// CredentialManager returns a manager that resolves through the injected
+// resolver. Without one, only payload values are read.
+func (credentials *Credentials) CredentialManager() *CredentialManager {
+	return NewCredentialManagerWithResolver(credentials.resolver)
 }
 
 // ValidateEnvironmentVars checks if required environment variables are set
@@ -72,38 +147,3 @@ func ValidateEnvironmentVars(requiredVars []string) []string {
 	}
 	return missing
 }
-
-// LoadEnvFile loads environment variables from a .env file (if it exists)
-// This is useful for development
-func LoadEnvFile(filename string) error {
-	file, err := os.Open(filename)
-	if err != nil {
-		// File doesn't exist, which is okay
-		return nil
-	}
-	defer file.Close()
-
-	// Simple .env file parser
-	// In production, you might want to use a library like godotenv
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		if line == "" || strings.HasPrefix(line, "#") {
-			continue
-		}
-
-		parts := strings.SplitN(line, "=", 2)
-		if len(parts) == 2 {
-			key := strings.TrimSpace(parts[0])
-			value := strings.TrimSpace(parts[1])
-			// Remove quotes if present
-			if (strings.HasPrefix(value, "\"") && strings.HasSuffix(value, "\"")) ||
-				(strings.HasPrefix(value, "'") && strings.HasSuffix(value, "'")) {
-				value = value[1 : len(value)-1]
-			}
-			os.Setenv(key, value)
-		}
-	}
-
-	return scanner.Err()
-}
@@ -1,12 +1,14 @@
 package helpers
 
 import (
+	"context"
+	"errors"
 	"os"
 	"testing"
 )
 
 func TestCredentialManager_GetCredential(t *testing.T) {
-	cm := NewCredentialManager()
+	cm := newEnvCredentialManager()
 
 	tests := []struct {
 		name         string
@@ -62,7 +64,7 @@ func TestCredentialManager_GetCredential(t *testing.T) {
 }
 
 func TestCredentialManager_GetRequiredCredential(t *testing.T) {
-	cm := NewCredentialManager()
+	cm := newEnvCredentialManager()
 
 	t.Run("returns value when available", func(t *testing.T) {
 		os.Setenv("TEST_REQUIRED_VAR", "test_value")
@@ -131,3 +133,58 @@ func TestValidateEnvironmentVars(t *testing.T) {
 		})
 	}
 }
+
+func TestCredentialManager_ResolveCredential(t *testing.T) {
+	outage := errors.New("vault unreachable")
+	cm := NewCredentialManagerWithResolver(BindSecretProvider(context.Background(), SecretProviderChain{
+		mapSecretProvider{EnvSlackAPIToken: "xoxb-provider"},
+		failingSecretProvider{err: outage},
+	}))
+
+	if got, err := cm.ResolveCredential("", EnvSlackAPIToken); got != "xoxb-provider" || err != nil {
+		t.Errorf("ResolveCredential() = %q, %v; want the provider value", got, err)
+	}
+	if got, err := cm.ResolveCredential("xoxb-payload", EnvSlackAPIToken); got != "xoxb-payload" || err != nil {
+		t.Errorf("ResolveCredential() = %q, %v; want the payload value", got, err)
+	}
+	if _, err := cm.ResolveCredential(nil, EnvGitHubToken); !errors.Is(err, outage) {
+		t.Errorf("ResolveCredential() error = %v, want %v", err, outage)
+	}
+	if got := cm.GetCredential(nil, EnvGitHubToken); got != "" {
+		t.Errorf("GetCredential() = %q, want empty on provider errors", got)
+	}
+}
+
+func TestCredentialManager_NoResolver(t *testing.T) {
+	t.Setenv("TEST_ENV_VAR", "env_value")
+
+	for name, cm := range map[string]*CredentialManager{
+		"NewCredentialManager":         NewCredentialManager(),
+		"Credentials without resolver": (&Credentials{}).CredentialManager(),
+		"context without resolver":     CredentialManagerFromContext(context.Background()),
+	} {
+		t.Run(name, func(t *testing.T) {
+			if got, err := cm.ResolveCredential(nil, "TEST_ENV_VAR"); got != "" || !errors.Is(err, ErrNoCredentialResolver) {
+				t.Errorf("ResolveCredential() = %q, %v; want ErrNoCredentialResolver", got, err)
+			}
+			if got, err := cm.ResolveCredential("payload_value", "TEST_ENV_VAR"); got != "payload_value" || err != nil {
+				t.Errorf("ResolveCredential() = %q, %v; want the payload value", got, err)
+			}
+		})
+	}
+}
+
+func TestCredentialManagerFromContext(t *testing.T) {
+	ctx := WithCredentialResolver(context.Background(), BindSecretProvider(context.Background(),
+		mapSecretProvider{EnvSlackAPIToken: "xoxb-provider"}))
+
+	if got, err := CredentialManagerFromContext(ctx).ResolveCredential(nil, EnvSlackAPIToken); got != "xoxb-provider" || err != nil {
+		t.Errorf("ResolveCredential() = %q, %v; want the provider value", got, err)
+	}
+}
+
+// newEnvCredentialManager resolves credentials from the secret providers
+// Faas uses by default
+func newEnvCredentialManager() *CredentialManager {
+	return NewCredentialManagerWithResolver(BindSecretProvider(context.Background(), DefaultSecretProvider()))
+}
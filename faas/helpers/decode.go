@@ -0,0 +1,266 @@
+package helpers
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+
+	"github.com/gsarmaonline/faas/faas/intf"
+)
+
+type (
+	// FieldError describes a single payload field that could not be decoded
+	// or does not match the input schema
+	FieldError struct {
+		Field    string
+		Expected string
+		Actual   string
+		// Message replaces the expected/actual description when set
+		Message string
+	}
+
+	// PayloadError collects every field error found while decoding a payload
+	PayloadError struct {
+		Errors []FieldError
+	}
+)
+
+func (fieldErr FieldError) Error() string {
+	if fieldErr.Message != "" {
+		return fmt.Sprintf("field %s: %s", fieldErr.Field, fieldErr.Message)
+	}
+	return fmt.Sprintf("field %s: expected %s, got %s", fieldErr.Field, fieldErr.Expected, fieldErr.Actual)
+}
+
+func (payloadErr *PayloadError) Error() string {
+	messages := make([]string, 0, len(payloadErr.Errors))
+	for _, fieldErr := range payloadErr.Errors {
+		messages = append(messages, fieldErr.Error())
+	}
+	return "invalid payload: " + strings.Join(messages, "; ")
+}
+
+// DecodePayload maps a payload onto the json-tagged fields of the struct
+// pointed to by target. Missing and nil fields are left untouched. Values
+// of the wrong type never panic; every mismatch is reported in a single
+// *PayloadError.
+func DecodePayload(payload intf.Payload, target interface{}) error {
+	targetValue := reflect.ValueOf(target)
+	if targetValue.Kind() != reflect.Ptr || targetValue.IsNil() || targetValue.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("decode target must be a non-nil pointer to a struct, got %T", target)
+	}
+
+	decoder := &payloadDecoder{}
+	decoder.decodeStruct("", map[string]interface{}(payload), targetValue.Elem())
+	if len(decoder.errors) > 0 {
+		return &PayloadError{Errors: decoder.errors}
+	}
+	return nil
+}
+
+// JSONFieldName returns the payload key of a struct field, or false if the
+// field is not part of the payload
+func JSONFieldName(field reflect.StructField) (string, bool) {
+	if field.PkgPath != "" {
+		return "", false
+	}
+	tag := field.Tag.Get("json")
+	if tag == "-" {
+		return "", false
+	}
+	name, _, _ := strings.Cut(tag, ",")
+	if name == "" {
+		name = field.Name
+	}
+	return name, true
+}
+
+type payloadDecoder struct {
+	errors []FieldError
+}
+
+func (decoder *payloadDecoder) fail(path string, expected string, value interface{}) {
+	decoder.errors = append(decoder.errors, FieldError{
+		Field:    path,
+		Expected: expected,
+		Actual:   describeValue(value),
+	})
+}
+
+func (decoder *payloadDecoder) decodeStruct(path string, values map[string]interface{}, target reflect.Value) {
+	targetType := target.Type()
+	for i := 0; i < targetType.NumField(); i++ {
+		name, ok := JSONFieldName(targetType.Field(i))
+		if !ok {
+			continue
+		}
+		value, exists := values[name]
+		if !exists || value == nil {
+			continue
+		}
+		decoder.decodeValue(joinPath(path, name), value, target.Field(i))
+	}
+}
+
+func (decoder *payloadDecoder) decodeValue(path string, value interface{}, target reflect.Value) {
+	source := reflect.ValueOf(value)
+	if !source.IsValid() {
+		// nil elements of arrays and objects decode to the zero value
+		return
+	}
+
+	switch target.Kind() {
+	case reflect.Interface:
+		if !source.Type().AssignableTo(target.Type()) {
+			decoder.fail(path, target.Type().String(), value)
+			return
+		}
+		target.Set(source)
+
+	case reflect.String:
+		if source.Kind() != reflect.String {
+			decoder.fail(path, "string", value)
+			return
+		}
+		target.SetString(source.String())
+
+	case reflect.Bool:
+		if source.Kind() != reflect.Bool {
+			decoder.fail(path, "boolean", value)
+			return
+		}
+		target.SetBool(source.Bool())
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		number, ok := toFloat(source)
+		if !ok || number != math.Trunc(number) || !fitsInt(number, target.Type().Bits()) {
+			decoder.fail(path, "integer", value)
+			return
+		}
+		target.SetInt(int64(number))
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		number, ok := toFloat(source)
+		if !ok || number != math.Trunc(number) || !fitsUint(number, target.Type().Bits()) {
+			decoder.fail(path, "non-negative integer", value)
+			return
+		}
+		target.SetUint(uint64(number))
+
+	case reflect.Float32, reflect.Float64:
+		number, ok := toFloat(source)
+		if !ok {
+			decoder.fail(path, "number", value)
+			return
+		}
+		target.SetFloat(number)
+
+	case reflect.Slice:
+		if source.Kind() != reflect.Slice && source.Kind() != reflect.Array {
+			decoder.fail(path, "array", value)
+			return
+		}
+		slice := reflect.MakeSlice(target.Type(), source.Len(), source.Len())
+		for i := 0; i < source.Len(); i++ {
+			decoder.decodeValue(fmt.Sprintf("%s[%d]", path, i), source.Index(i).Interface(), slice.Index(i))
+		}
+		target.Set(slice)
+
+	case reflect.Map:
+		if source.Kind() != reflect.Map || source.Type().Key().Kind() != reflect.String || target.Type().Key().Kind() != reflect.String {
+			decoder.fail(path, "object", value)
+			return
+		}
+		mapValue := reflect.MakeMapWithSize(target.Type(), source.Len())
+		iter := source.MapRange()
+		for iter.Next() {
+			key := iter.Key().String()
+			element := reflect.New(target.Type().Elem()).Elem()
+			decoder.decodeValue(joinPath(path, key), iter.Value().Interface(), element)
+			mapValue.SetMapIndex(reflect.ValueOf(key).Convert(target.Type().Key()), element)
+		}
+		target.Set(mapValue)
+
+	case reflect.Struct:
+		values, ok := toObject(source)
+		if !ok {
+			decoder.fail(path, "object", value)
+			return
+		}
+		decoder.decodeStruct(path, values, target)
+
+	case reflect.Ptr:
+		element := reflect.New(target.Type().Elem())
+		decoder.decodeValue(path, value, element.Elem())
+		target.Set(element)
+
+	default:
+		decoder.fail(path, target.Type().String(), value)
+	}
+}
+
+// fitsInt reports whether the integral number is within the range of a
+// signed integer of the given size. The bounds are powers of two, which
+// float64 represents exactly, so number is never converted out of range.
+func fitsInt(number float64, bits int) bool {
+	limit := math.Ldexp(1, bits-1)
+	return number >= -limit && number < limit
+}
+
+// fitsUint reports whether the integral number is within the range of an
+// unsigned integer of the given size
+func fitsUint(number float64, bits int) bool {
+	return number >= 0 && number < math.Ldexp(1, bits)
+}
+
+func toFloat(source reflect.Value) (float64, bool) {
+	switch source.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(source.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(source.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return source.Float(), true
+	}
+	return 0, false
+}
+
+func toObject(source reflect.Value) (map[string]interface{}, bool) {
+	if source.Kind() != reflect.Map || source.Type().Key().Kind() != reflect.String {
+		return nil, false
+	}
+	values := make(map[string]interface{}, source.Len())
+	iter := source.MapRange()
+	for iter.Next() {
+		values[iter.Key().String()] = iter.Value().Interface()
+	}
+	return values, true
+}
+
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+// describeValue names the JSON type of a payload value for error messages
+func describeValue(value interface{}) string {
+	source := reflect.ValueOf(value)
+	switch source.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	case reflect.Map:
+		return "object"
+	}
+	return fmt.Sprintf("%T", value)
+}
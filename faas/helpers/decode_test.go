@@ -0,0 +1,185 @@
+package helpers
+
+import (
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/gsarmaonline/faas/faas/intf"
+)
+
+type (
+	decodeMethodT string
+
+	decodeNested struct {
+		Name string `json:"name"`
+	}
+
+	decodeTarget struct {
+		Name     string                 `json:"name"`
+		Method   decodeMethodT          `json:"method"`
+		Count    int                    `json:"count"`
+		Ratio    float64                `json:"ratio"`
+		Enabled  bool                   `json:"enabled"`
+		Tags     []string               `json:"tags"`
+		Labels   map[string]string      `json:"labels"`
+		Nested   decodeNested           `json:"nested"`
+		Optional *string                `json:"optional,omitempty"`
+		Body     interface{}            `json:"body"`
+		Extra    map[string]interface{} `json:"extra"`
+		Ignored  string                 `json:"-"`
+	}
+)
+
+func TestDecodePayload(t *testing.T) {
+	payload := intf.Payload{
+		"name":     "faas",
+		"method":   "POST",
+		"count":    float64(3),
+		"ratio":    0.5,
+		"enabled":  true,
+		"tags":     []interface{}{"a", "b"},
+		"labels":   map[string]interface{}{"env": "dev"},
+		"nested":   map[string]interface{}{"name": "inner"},
+		"optional": "value",
+		"body":     map[string]interface{}{"key": "value"},
+		"extra":    intf.Payload{"nested": true},
+		"Ignored":  "should not be set",
+	}
+
+	var target decodeTarget
+	if err := DecodePayload(payload, &target); err != nil {
+		t.Fatalf("DecodePayload() error = %v", err)
+	}
+
+	if target.Name != "faas" || target.Method != "POST" || target.Count != 3 || target.Ratio != 0.5 || !target.Enabled {
+		t.Errorf("scalar fields decoded incorrectly: %+v", target)
+	}
+	if len(target.Tags) != 2 || target.Tags[1] != "b" {
+		t.Errorf("Tags = %v, want [a b]", target.Tags)
+	}
+	if target.Labels["env"] != "dev" {
+		t.Errorf("Labels = %v, want map[env:dev]", target.Labels)
+	}
+	if target.Nested.Name != "inner" {
+		t.Errorf("Nested.Name = %v, want inner", target.Nested.Name)
+	}
+	if target.Optional == nil || *target.Optional != "value" {
+		t.Errorf("Optional = %v, want value", target.Optional)
+	}
+	if body, ok := target.Body.(map[string]interface{}); !ok || body["key"] != "value" {
+		t.Errorf("Body = %v, want map[key:value]", target.Body)
+	}
+	if target.Extra["nested"] != true {
+		t.Errorf("Extra = %v, want map[nested:true]", target.Extra)
+	}
+	if target.Ignored != "" {
+		t.Errorf("Ignored = %v, want empty", target.Ignored)
+	}
+}
+
+func TestDecodePayload_MissingAndNilFields(t *testing.T) {
+	target := decodeTarget{Name: "default"}
+	if err := DecodePayload(intf.Payload{"method": nil}, &target); err != nil {
+		t.Fatalf("DecodePayload() error = %v", err)
+	}
+	if target.Name != "default" || target.Method != "" {
+		t.Errorf("missing and nil fields should be left untouched: %+v", target)
+	}
+
+	if err := DecodePayload(nil, &target); err != nil {
+		t.Errorf("DecodePayload(nil) error = %v", err)
+	}
+}
+
+func TestDecodePayload_CollectsFieldErrors(t *testing.T) {
+	payload := intf.Payload{
+		"name":    float64(42),
+		"count":   1.5,
+		"enabled": "yes",
+		"tags":    []interface{}{"a", float64(1)},
+		"nested":  "not an object",
+	}
+
+	var target decodeTarget
+	err := DecodePayload(payload, &target)
+
+	var payloadErr *PayloadError
+	if !errors.As(err, &payloadErr) {
+		t.Fatalf("DecodePayload() error = %v, want *PayloadError", err)
+	}
+
+	want := map[string]FieldError{
+		"name":    {Field: "name", Expected: "string", Actual: "number"},
+		"count":   {Field: "count", Expected: "integer", Actual: "number"},
+		"enabled": {Field: "enabled", Expected: "boolean", Actual: "string"},
+		"tags[1]": {Field: "tags[1]", Expected: "string", Actual: "number"},
+		"nested":  {Field: "nested", Expected: "object", Actual: "string"},
+	}
+	if len(payloadErr.Errors) != len(want) {
+		t.Fatalf("Errors = %v, want %d errors", payloadErr.Errors, len(want))
+	}
+	for _, fieldErr := range payloadErr.Errors {
+		if want[fieldErr.Field] != fieldErr {
+			t.Errorf("unexpected field error %+v", fieldErr)
+		}
+	}
+}
+
+func TestDecodePayload_IntegerRange(t *testing.T) {
+	type integers struct {
+		Int8   int8   `json:"int8"`
+		Int64  int64  `json:"int64"`
+		Uint8  uint8  `json:"uint8"`
+		Uint64 uint64 `json:"uint64"`
+	}
+
+	tests := []struct {
+		name    string
+		field   string
+		value   float64
+		wantErr bool
+	}{
+		{name: "int8 max", field: "int8", value: 127},
+		{name: "int8 min", field: "int8", value: -128},
+		{name: "int8 above max", field: "int8", value: 128, wantErr: true},
+		{name: "int8 below min", field: "int8", value: -129, wantErr: true},
+		{name: "int64 min", field: "int64", value: -math.Ldexp(1, 63)},
+		{name: "int64 at 2^63", field: "int64", value: math.Ldexp(1, 63), wantErr: true},
+		{name: "int64 far above max", field: "int64", value: 1e30, wantErr: true},
+		{name: "int64 infinity", field: "int64", value: math.Inf(1), wantErr: true},
+		{name: "uint8 max", field: "uint8", value: 255},
+		{name: "uint8 above max", field: "uint8", value: 256, wantErr: true},
+		{name: "uint8 negative", field: "uint8", value: -1, wantErr: true},
+		{name: "uint64 at 2^64", field: "uint64", value: math.Ldexp(1, 64), wantErr: true},
+		{name: "uint64 far above max", field: "uint64", value: 1e30, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var target integers
+			err := DecodePayload(intf.Payload{tt.field: tt.value}, &target)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("DecodePayload(%v) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDecodePayload_InvalidTarget(t *testing.T) {
+	var target decodeTarget
+	if err := DecodePayload(intf.Payload{}, target); err == nil {
+		t.Error("DecodePayload() error = nil, want error for non-pointer target")
+	}
+}
+
+func TestPayloadError_Error(t *testing.T) {
+	err := &PayloadError{Errors: []FieldError{
+		{Field: "to", Expected: "string", Actual: "number"},
+		{Field: "body", Expected: "string", Actual: "boolean"},
+	}}
+	want := "invalid payload: field to: expected string, got number; field body: expected string, got boolean"
+	if err.Error() != want {
+		t.Errorf("Error() = %v, want %v", err.Error(), want)
+	}
+}
@@ -1,15 +1,28 @@
 package helpers
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"fmt"
+	"io"
 	"time"
 
+	"github.com/gsarmaonline/faas/faas/metrics"
+	"github.com/moby/moby/api/pkg/stdcopy"
 	"github.com/moby/moby/api/types/container"
 	"github.com/moby/moby/api/types/registry"
 	"github.com/moby/moby/client"
 )
 
+type DockerExecutionResult struct {
+	ExitCode int64
+	Stdout   string
+	Stderr   string
+	// LogsTruncated is set when the logs exceeded maxDockerLogBytes
+	LogsTruncated bool
+}
+
 type DockerExecutor struct {
 	Image            string
 	Registry         string
@@ -17,9 +30,31 @@ type DockerExecutor struct {
 	RegistryPassword string
 	client           *client.Client
 	timeoutSec       int
-	ctx              context.Context
 }
 
+// IsDockerDaemonUnavailable reports whether err was caused by a failed
+// connection to the Docker daemon
+func IsDockerDaemonUnavailable(err error) bool {
+	return client.IsErrConnectionFailed(err)
+}
+
+const (
+	// DockerContainerStartMetric is the histogram of the time from the start
+	// of an execution until its container runs, including the image pull
+	DockerContainerStartMetric     = "faas_docker_container_start_seconds"
+	DockerContainerStartMetricHelp = "Time until a container runs, including image pull and create."
+)
+
+const (
+	// cleanupTimeout bounds the calls that stop and remove a container after
+	// the invocation context is already done
+	cleanupTimeout = 10 * time.Second
+
+	// maxDockerLogBytes caps how much of the stdout and stderr of a
+	// container is kept in the result
+	maxDockerLogBytes = 10 << 20
+)
+
 func NewDockerExecutor(image string, registry, username, password string) (dockerExecutor *DockerExecutor, err error) {
 	dockerExecutor = &DockerExecutor{
 		Image:            image,
@@ -27,7 +62,6 @@ func NewDockerExecutor(image string, registry, username, password string) (docke
 		RegistryUsername: username,
 		RegistryPassword: password,
 		timeoutSec:       15,
-		ctx:              context.Background(),
 	}
 	if dockerExecutor.client, err = client.NewClientWithOpts(client.FromEnv); err != nil {
 		return
@@ -35,7 +69,7 @@ func NewDockerExecutor(image string, registry, username, password string) (docke
 	return
 }
 
-func (dockerExecutor *DockerExecutor) Prepare() (resp container.CreateResponse, err error) {
+func (dockerExecutor *DockerExecutor) Prepare(ctx context.Context) (resp container.CreateResponse, err error) {
 	// Determine the full image name with registry if provided
 	imageName := dockerExecutor.Image
 	if dockerExecutor.Registry != "" {
@@ -63,13 +97,19 @@ func (dockerExecutor *DockerExecutor) Prepare() (resp container.CreateResponse,
 		}
 	}
 
-	// Pull the image with appropriate options
-	if _, err = dockerExecutor.client.ImagePull(dockerExecutor.ctx, imageName, pullOptions); err != nil {
+	// Pull the image with appropriate options. The pull only completes once
+	// the progress stream has been fully read.
+	var pullResp io.ReadCloser
+	if pullResp, err = dockerExecutor.client.ImagePull(ctx, imageName, pullOptions); err != nil {
+		return
+	}
+	defer pullResp.Close()
+	if _, err = io.Copy(io.Discard, pullResp); err != nil {
 		return
 	}
 
 	// Create the container
-	if resp, err = dockerExecutor.client.ContainerCreate(dockerExecutor.ctx, &container.Config{
+	if resp, err = dockerExecutor.client.ContainerCreate(ctx, &container.Config{
 		Image: imageName,
 		Cmd:   []string{"echo", "Hello from Docker!"},
 	}, nil, nil, nil, ""); err != nil {
@@ -78,39 +118,106 @@ func (dockerExecutor *DockerExecutor) Prepare() (resp container.CreateResponse,
 	return
 }
 
-func (dockerExecutor *DockerExecutor) WaitAfterExecuting(createResp container.CreateResponse) (err error) {
-	statusCh, errCh := dockerExecutor.client.ContainerWait(dockerExecutor.ctx, createResp.ID, container.WaitConditionNotRunning)
+// WaitAfterExecuting waits for the container to exit and returns its exit
+// code. The container is stopped when the executor timeout elapses or ctx
+// is done.
+func (dockerExecutor *DockerExecutor) WaitAfterExecuting(ctx context.Context, createResp container.CreateResponse) (exitCode int64, err error) {
+	statusCh, errCh := dockerExecutor.client.ContainerWait(ctx, createResp.ID, container.WaitConditionNotRunning)
 	timeout := time.After(time.Duration(dockerExecutor.timeoutSec) * time.Second)
 
 	select {
 	case err = <-errCh:
-		if err != nil {
-			break
+		if ctx.Err() != nil {
+			dockerExecutor.stopContainer(createResp.ID)
+		}
+	case status := <-statusCh:
+		exitCode = status.StatusCode
+		if status.Error != nil {
+			err = fmt.Errorf("error waiting for container: %s", status.Error.Message)
 		}
-	case <-statusCh:
-		break
 	case <-timeout:
-		if err = dockerExecutor.client.ContainerStop(dockerExecutor.ctx, createResp.ID, client.ContainerStopOptions{}); err != nil {
-			break
+		if err = dockerExecutor.stopContainer(createResp.ID); err == nil {
+			err = fmt.Errorf("container did not exit within %d seconds", dockerExecutor.timeoutSec)
 		}
+	case <-ctx.Done():
+		dockerExecutor.stopContainer(createResp.ID)
+		err = ctx.Err()
 	}
-	if err = dockerExecutor.client.ContainerRemove(dockerExecutor.ctx, createResp.ID, client.ContainerRemoveOptions{}); err != nil {
+	return
+}
+
+// CollectLogs reads the stdout and stderr of the container, up to
+// maxDockerLogBytes of logs
+func (dockerExecutor *DockerExecutor) CollectLogs(ctx context.Context, createResp container.CreateResponse) (stdout, stderr string, truncated bool, err error) {
+	var logs io.ReadCloser
+	if logs, err = dockerExecutor.client.ContainerLogs(ctx, createResp.ID, client.ContainerLogsOptions{
+		ShowStdout: true,
+		ShowStderr: true,
+	}); err != nil {
 		return
 	}
+	defer logs.Close()
+	return readDockerLogs(logs, maxDockerLogBytes)
+}
+
+// readDockerLogs splits the multiplexed log stream of a container created
+// without a TTY into stdout and stderr, reading at most limit bytes of it
+func readDockerLogs(logs io.Reader, limit int64) (stdout, stderr string, truncated bool, err error) {
+	var stdoutBuf, stderrBuf bytes.Buffer
+	if _, err = stdcopy.StdCopy(&stdoutBuf, &stderrBuf, io.LimitReader(logs, limit)); err != nil {
+		return
+	}
+	// Anything left means the logs were cut off
+	if n, _ := logs.Read(make([]byte, 1)); n > 0 {
+		truncated = true
+	}
+	stdout, stderr = stdoutBuf.String(), stderrBuf.String()
 	return
 }
 
-func (dockerExecutor *DockerExecutor) Execute() (output string, err error) {
+// Close releases the connection to the Docker daemon
+func (dockerExecutor *DockerExecutor) Close() error {
+	return dockerExecutor.client.Close()
+}
+
+func (dockerExecutor *DockerExecutor) stopContainer(containerID string) error {
+	stopCtx, cancel := context.WithTimeout(context.Background(), cleanupTimeout)
+	defer cancel()
+	return dockerExecutor.client.ContainerStop(stopCtx, containerID, client.ContainerStopOptions{})
+}
+
+// removeContainer removes the container even if the invocation context is
+// already done
+func (dockerExecutor *DockerExecutor) removeContainer(containerID string) error {
+	removeCtx, cancel := context.WithTimeout(context.Background(), cleanupTimeout)
+	defer cancel()
+	return dockerExecutor.client.ContainerRemove(removeCtx, containerID, client.ContainerRemoveOptions{Force: true})
+}
+
+func (dockerExecutor *DockerExecutor) Execute(ctx context.Context) (result DockerExecutionResult, err error) {
 	var (
 		createResp container.CreateResponse
 	)
-	if createResp, err = dockerExecutor.Prepare(); err != nil {
+	startedAt := time.Now()
+	if createResp, err = dockerExecutor.Prepare(ctx); err != nil {
+		return
+	}
+	defer func() {
+		if removeErr := dockerExecutor.removeContainer(createResp.ID); removeErr != nil && err == nil {
+			err = removeErr
+		}
+	}()
+
+	if err = dockerExecutor.client.ContainerStart(ctx, createResp.ID, client.ContainerStartOptions{}); err != nil {
 		return
 	}
-	if err = dockerExecutor.client.ContainerStart(dockerExecutor.ctx, createResp.ID, client.ContainerStartOptions{}); err != nil {
+	metrics.FromContext(ctx).
+		Histogram(DockerContainerStartMetric, DockerContainerStartMetricHelp, metrics.DefaultBuckets).
+		With().Observe(time.Since(startedAt).Seconds())
+	if result.ExitCode, err = dockerExecutor.WaitAfterExecuting(ctx, createResp); err != nil {
 		return
 	}
-	if err = dockerExecutor.WaitAfterExecuting(createResp); err != nil {
+	if result.Stdout, result.Stderr, result.LogsTruncated, err = dockerExecutor.CollectLogs(ctx, createResp); err != nil {
 		return
 	}
 
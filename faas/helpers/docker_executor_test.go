@@ -1,7 +1,11 @@
 package helpers
 
 import (
+	"bytes"
+	"strings"
 	"testing"
+
+	"github.com/moby/moby/api/pkg/stdcopy"
 )
 
 func TestNewDockerExecutor(t *testing.T) {
@@ -110,3 +114,31 @@ func TestDockerExecutor_PrepareImageName(t *testing.T) {
 		})
 	}
 }
+
+func TestReadDockerLogs(t *testing.T) {
+	var logs bytes.Buffer
+	stdcopy.NewStdWriter(&logs, stdcopy.Stdout).Write([]byte("hello\n"))
+	stdcopy.NewStdWriter(&logs, stdcopy.Stderr).Write([]byte("warning\n"))
+	size := int64(logs.Len())
+	stdcopy.NewStdWriter(&logs, stdcopy.Stdout).Write([]byte(strings.Repeat("x", 100)))
+
+	stdout, stderr, truncated, err := readDockerLogs(bytes.NewReader(logs.Bytes()), size)
+	if err != nil || stdout != "hello\n" || stderr != "warning\n" || !truncated {
+		t.Errorf("readDockerLogs() = %q, %q, %v, %v; want the first frames, truncated", stdout, stderr, truncated, err)
+	}
+
+	stdout, _, truncated, err = readDockerLogs(bytes.NewReader(logs.Bytes()), int64(logs.Len()))
+	if err != nil || len(stdout) != len("hello\n")+100 || truncated {
+		t.Errorf("readDockerLogs() = %q, %v, %v; want all logs", stdout, truncated, err)
+	}
+}
+
+func TestDockerExecutor_Close(t *testing.T) {
+	executor, err := NewDockerExecutor("nginx", "", "", "")
+	if err != nil {
+		t.Fatalf("NewDockerExecutor() error = %v", err)
+	}
+	if err = executor.Close(); err != nil {
+		t.Errorf("Close() error = %v", err)
+	}
+}
@@ -0,0 +1,416 @@
+package helpers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// DefaultEnvFile is the base file of the layered .env files
+const DefaultEnvFile = ".env"
+
+type (
+	// EnvLoadOptions configure LoadEnv
+	EnvLoadOptions struct {
+		// Dir holds the layered files; defaults to the working directory
+		Dir string
+		// Profile adds a .env.<Profile> layer, e.g. "test" or "production"
+		Profile string
+		// Files replaces the layered files with an explicit list, loaded in
+		// order
+		Files []string
+		// NoOverride keeps variables that were set before loading
+		NoOverride bool
+	}
+
+	// EnvLoadReport tells where the loaded variables came from
+	EnvLoadReport struct {
+		// Files are the files that were read, in load order. Missing files
+		// are skipped.
+		Files []string
+		// Sources maps every variable set by LoadEnv to the file its value
+		// came from
+		Sources map[string]string
+		// Kept are the variables that were already set and left alone
+		// because of NoOverride, sorted
+		Kept []string
+	}
+
+	// envParser reads the dotenv format: KEY=value assignments with an
+	// optional export prefix, single-quoted literal values, double-quoted
+	// values with escape sequences, ${VAR} interpolation and # comments.
+	// Quoted values may span lines.
+	envParser struct {
+		filename string
+		src      string
+		pos      int
+		line     int
+		values   map[string]string
+		lookup   func(key string) (string, bool)
+	}
+)
+
+// EnvFiles returns the layered files of dir in load order: .env, .env.local
+// and .env.<profile> if profile is set. Later files override earlier ones.
+func EnvFiles(dir, profile string) []string {
+	files := []string{DefaultEnvFile, DefaultEnvFile + ".local"}
+	if profile != "" {
+		files = append(files, DefaultEnvFile+"."+profile)
+	}
+	for idx, file := range files {
+		files[idx] = filepath.Join(dir, file)
+	}
+	return files
+}
+
+// LoadEnvFile loads environment variables from a .env file (if it exists),
+// overriding variables that are already set. This is useful for development.
+func LoadEnvFile(filename string) error {
+	_, err := LoadEnv(EnvLoadOptions{Files: []string{filename}})
+	return err
+}
+
+// LoadEnv sets the variables of the layered .env files, or of
+// options.Files, in the environment. Missing files are skipped; any other
+// error aborts before the environment is changed.
+func LoadEnv(options EnvLoadOptions) (report *EnvLoadReport, err error) {
+	files := options.Files
+	if files == nil {
+		files = EnvFiles(options.Dir, options.Profile)
+	}
+
+	report = &EnvLoadReport{Sources: make(map[string]string)}
+	loaded := make(map[string]string)
+	kept := make(map[string]bool)
+	// Later files interpolate the effective values of earlier ones
+	lookup := func(key string) (string, bool) {
+		if value, exists := loaded[key]; exists {
+			return value, true
+		}
+		return os.LookupEnv(key)
+	}
+
+	for _, file := range files {
+		var values map[string]string
+		if values, err = parseEnvFile(file, lookup); err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				err = nil
+				continue
+			}
+			return
+		}
+		report.Files = append(report.Files, file)
+		for key, value := range values {
+			if _, set := os.LookupEnv(key); set && options.NoOverride {
+				kept[key] = true
+				continue
+			}
+			loaded[key] = value
+			report.Sources[key] = file
+		}
+	}
+
+	for key, value := range loaded {
+		if err = os.Setenv(key, value); err != nil {
+			return
+		}
+	}
+	for key := range kept {
+		report.Kept = append(report.Kept, key)
+	}
+	sort.Strings(report.Kept)
+	return
+}
+
+// ParseEnvFile reads the variables of a .env file without setting them.
+// References to variables the file does not define are resolved from the
+// environment.
+func ParseEnvFile(filename string) (map[string]string, error) {
+	return parseEnvFile(filename, os.LookupEnv)
+}
+
+// ParseEnv reads variables in the dotenv format. References to variables
+// the input does not define are resolved with lookup, which may be nil.
+func ParseEnv(r io.Reader, lookup func(key string) (string, bool)) (map[string]string, error) {
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return parseEnv("", string(content), lookup)
+}
+
+func parseEnvFile(filename string, lookup func(key string) (string, bool)) (map[string]string, error) {
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return parseEnv(filename, string(content), lookup)
+}
+
+func parseEnv(filename, src string, lookup func(key string) (string, bool)) (values map[string]string, err error) {
+	parser := &envParser{
+		filename: filename,
+		src:      strings.ReplaceAll(strings.TrimPrefix(src, "\ufeff"), "\r\n", "\n"),
+		line:     1,
+		values:   make(map[string]string),
+		lookup:   lookup,
+	}
+	for {
+		parser.skipBlankLines()
+		if parser.done() {
+			return parser.values, nil
+		}
+		if err = parser.assignment(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (parser *envParser) assignment() (err error) {
+	var value string
+
+	key := parser.varName()
+	if key == "export" && isEnvSpace(parser.peek()) {
+		parser.skipSpaces()
+		if parser.peek() != '=' {
+			key = parser.varName()
+		}
+	}
+	if key == "" {
+		return parser.errorf(parser.line, "invalid variable name")
+	}
+	parser.skipSpaces()
+	if parser.peek() != '=' {
+		return parser.errorf(parser.line, "expected = after %s", key)
+	}
+	parser.pos++
+	parser.skipSpaces()
+
+	switch parser.peek() {
+	case '"':
+		value, err = parser.doubleQuoted()
+	case '\'':
+		value, err = parser.singleQuoted()
+	default:
+		value, err = parser.unquoted()
+	}
+	if err != nil {
+		return
+	}
+	if err = parser.endOfLine(); err != nil {
+		return
+	}
+	parser.values[key] = value
+	return
+}
+
+func (parser *envParser) doubleQuoted() (string, error) {
+	var value strings.Builder
+
+	startLine := parser.line
+	parser.pos++
+	for !parser.done() {
+		char := parser.src[parser.pos]
+		switch char {
+		case '"':
+			parser.pos++
+			return value.String(), nil
+		case '\\':
+			parser.pos++
+			if parser.done() {
+				continue
+			}
+			switch escaped := parser.src[parser.pos]; escaped {
+			case 'n':
+				value.WriteByte('\n')
+			case 'r':
+				value.WriteByte('\r')
+			case 't':
+				value.WriteByte('\t')
+			case '"', '\\', '$':
+				value.WriteByte(escaped)
+			default:
+				value.WriteByte('\\')
+				continue
+			}
+			parser.pos++
+		case '$':
+			if err := parser.expand(&value); err != nil {
+				return "", err
+			}
+		default:
+			if char == '\n' {
+				parser.line++
+			}
+			value.WriteByte(char)
+			parser.pos++
+		}
+	}
+	return "", parser.errorf(startLine, "unterminated double-quoted value")
+}
+
+func (parser *envParser) singleQuoted() (string, error) {
+	startLine := parser.line
+	parser.pos++
+	end := strings.IndexByte(parser.src[parser.pos:], '\'')
+	if end < 0 {
+		return "", parser.errorf(startLine, "unterminated single-quoted value")
+	}
+	value := parser.src[parser.pos : parser.pos+end]
+	parser.line += strings.Count(value, "\n")
+	parser.pos += end + 1
+	return value, nil
+}
+
+// unquoted reads up to the end of the line or an inline comment, which
+// starts with a # after whitespace
+func (parser *envParser) unquoted() (string, error) {
+	var value strings.Builder
+
+	for !parser.done() {
+		char := parser.src[parser.pos]
+		if char == '\n' || (char == '#' && isEnvSpace(parser.src[parser.pos-1])) {
+			break
+		}
+		if char == '$' {
+			if err := parser.expand(&value); err != nil {
+				return "", err
+			}
+			continue
+		}
+		value.WriteByte(char)
+		parser.pos++
+	}
+	return strings.TrimRight(value.String(), " \t"), nil
+}
+
+// expand writes the value of the $VAR, ${VAR} or ${VAR:-default} reference
+// at the current position. A $ that starts no reference is kept.
+func (parser *envParser) expand(value *strings.Builder) error {
+	parser.pos++
+	if parser.peek() != '{' {
+		if key := parser.varName(); key != "" {
+			resolved, _ := parser.resolve(key)
+			value.WriteString(resolved)
+		} else {
+			value.WriteByte('$')
+		}
+		return nil
+	}
+
+	parser.pos++
+	key := parser.varName()
+	end := strings.IndexByte(parser.src[parser.pos:], '}')
+	if key == "" || end < 0 {
+		return parser.errorf(parser.line, "invalid variable reference")
+	}
+	modifier := parser.src[parser.pos : parser.pos+end]
+	if modifier != "" && !strings.HasPrefix(modifier, ":-") {
+		return parser.errorf(parser.line, "invalid variable reference ${%s%s}", key, modifier)
+	}
+	parser.line += strings.Count(modifier, "\n")
+	parser.pos += end + 1
+
+	resolved, set := parser.resolve(key)
+	if modifier != "" && (!set || resolved == "") {
+		resolved = modifier[len(":-"):]
+	}
+	value.WriteString(resolved)
+	return nil
+}
+
+// resolve looks key up in the variables read so far, then with lookup
+func (parser *envParser) resolve(key string) (string, bool) {
+	if value, exists := parser.values[key]; exists {
+		return value, true
+	}
+	if parser.lookup != nil {
+		return parser.lookup(key)
+	}
+	return "", false
+}
+
+// endOfLine accepts trailing whitespace and a comment after a value
+func (parser *envParser) endOfLine() error {
+	parser.skipSpaces()
+	if parser.peek() == '#' {
+		parser.skipComment()
+	}
+	if !parser.done() && parser.peek() != '\n' {
+		return parser.errorf(parser.line, "unexpected %q after value", parser.src[parser.pos])
+	}
+	return nil
+}
+
+func (parser *envParser) skipBlankLines() {
+	for !parser.done() {
+		switch parser.peek() {
+		case ' ', '\t', '\r':
+			parser.pos++
+		case '\n':
+			parser.line++
+			parser.pos++
+		case '#':
+			parser.skipComment()
+		default:
+			return
+		}
+	}
+}
+
+func (parser *envParser) skipComment() {
+	if end := strings.IndexByte(parser.src[parser.pos:], '\n'); end >= 0 {
+		parser.pos += end
+	} else {
+		parser.pos = len(parser.src)
+	}
+}
+
+func (parser *envParser) skipSpaces() {
+	for isEnvSpace(parser.peek()) {
+		parser.pos++
+	}
+}
+
+// varName reads a variable name: a letter or underscore followed by letters,
+// digits and underscores
+func (parser *envParser) varName() string {
+	start := parser.pos
+	for !parser.done() {
+		char := parser.src[parser.pos]
+		if char == '_' || (char >= 'A' && char <= 'Z') || (char >= 'a' && char <= 'z') ||
+			(parser.pos > start && char >= '0' && char <= '9') {
+			parser.pos++
+			continue
+		}
+		break
+	}
+	return parser.src[start:parser.pos]
+}
+
+func (parser *envParser) peek() byte {
+	if parser.done() {
+		return 0
+	}
+	return parser.src[parser.pos]
+}
+
+func (parser *envParser) done() bool {
+	return parser.pos >= len(parser.src)
+}
+
+func (parser *envParser) errorf(line int, format string, args ...interface{}) error {
+	location := fmt.Sprintf("line %d", line)
+	if parser.filename != "" {
+		location = fmt.Sprintf("%s:%d", parser.filename, line)
+	}
+	return fmt.Errorf("%s: %s", location, fmt.Sprintf(format, args...))
+}
+
+func isEnvSpace(char byte) bool {
+	return char == ' ' || char == '\t' || char == '\r'
+}
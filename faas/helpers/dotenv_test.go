@@ -0,0 +1,283 @@
+package helpers
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseEnv(t *testing.T) {
+	lookup := func(key string) (string, bool) {
+		value, exists := map[string]string{"HOME": "/home/faas", "EMPTY": ""}[key]
+		return value, exists
+	}
+
+	tests := []struct {
+		name    string
+		input   string
+		want    map[string]string
+		wantErr string
+	}{
+		{
+			name:  "plain assignments, comments and blank lines",
+			input: "# comment\n\nA=1\n  B = two words  \r\nC=\n",
+			want:  map[string]string{"A": "1", "B": "two words", "C": ""},
+		},
+		{
+			name:  "export prefix",
+			input: "export A=1\nexport\tB=2\nexport=3\n",
+			want:  map[string]string{"A": "1", "B": "2", "export": "3"},
+		},
+		{
+			name:  "inline comments",
+			input: "A=1 # comment\nB=\"2\" # comment\nC='3'# comment\nD=a#b\nE= # empty\n",
+			want:  map[string]string{"A": "1", "B": "2", "C": "3", "D": "a#b", "E": ""},
+		},
+		{
+			name:  "escape sequences in double quotes",
+			input: `A="line1\nline2\ttab \"quoted\" \\ \$HOME \x"` + "\n",
+			want:  map[string]string{"A": "line1\nline2\ttab \"quoted\" \\ $HOME \\x"},
+		},
+		{
+			name:  "single quotes are literal",
+			input: `A='raw \n $HOME "x"'` + "\n",
+			want:  map[string]string{"A": `raw \n $HOME "x"`},
+		},
+		{
+			name:  "multiline quoted values",
+			input: "KEY=\"-----BEGIN KEY-----\nabc\n-----END KEY-----\"\nB='one\ntwo'\nC=3\n",
+			want: map[string]string{
+				"KEY": "-----BEGIN KEY-----\nabc\n-----END KEY-----",
+				"B":   "one\ntwo",
+				"C":   "3",
+			},
+		},
+		{
+			name:  "interpolation",
+			input: "DIR=${HOME}/app\nLOGS=\"$DIR/logs\"\nRAW='${DIR}'\nPRICE=5$\nMISSING=${NOPE}x\n",
+			want: map[string]string{
+				"DIR":     "/home/faas/app",
+				"LOGS":    "/home/faas/app/logs",
+				"RAW":     "${DIR}",
+				"PRICE":   "5$",
+				"MISSING": "x",
+			},
+		},
+		{
+			name:  "interpolation defaults",
+			input: "A=${NOPE:-fallback}\nB=${EMPTY:-fallback}\nC=${HOME:-fallback}\n",
+			want:  map[string]string{"A": "fallback", "B": "fallback", "C": "/home/faas"},
+		},
+		{
+			name:  "later assignments win",
+			input: "A=1\nA=2\n",
+			want:  map[string]string{"A": "2"},
+		},
+		{
+			name:    "unterminated double quote",
+			input:   "A=1\nB=\"open\nC=3\n",
+			wantErr: "line 2: unterminated double-quoted value",
+		},
+		{
+			name:    "unterminated single quote",
+			input:   "A='open\n",
+			wantErr: "line 1: unterminated single-quoted value",
+		},
+		{
+			name:    "missing equals sign",
+			input:   "A=1\nB\n",
+			wantErr: "line 2: expected = after B",
+		},
+		{
+			name:    "invalid name",
+			input:   "1A=1\n",
+			wantErr: "line 1: invalid variable name",
+		},
+		{
+			name:    "text after closing quote",
+			input:   "A=\"1\"2\n",
+			wantErr: "line 1: unexpected '2' after value",
+		},
+		{
+			name:    "invalid reference",
+			input:   "A=${HOME:=x}\n",
+			wantErr: "line 1: invalid variable reference ${HOME:=x}",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseEnv(strings.NewReader(tt.input), lookup)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("ParseEnv() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseEnv() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseEnv() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseEnvFile(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("TEST_DOTENV_HOST", "db.internal")
+
+	path := writeEnvFile(t, dir, ".env", "URL=postgres://${TEST_DOTENV_HOST}/app\nBROKEN=\"\n")
+	if _, err := ParseEnvFile(path); err == nil || !strings.HasPrefix(err.Error(), path+":2: ") {
+		t.Errorf("ParseEnvFile() error = %v, want the file and line", err)
+	}
+
+	writeEnvFile(t, dir, ".env", "URL=postgres://${TEST_DOTENV_HOST}/app\n")
+	values, err := ParseEnvFile(path)
+	if err != nil {
+		t.Fatalf("ParseEnvFile() error = %v", err)
+	}
+	if values["URL"] != "postgres://db.internal/app" {
+		t.Errorf("URL = %q", values["URL"])
+	}
+	if _, set := os.LookupEnv("URL"); set {
+		t.Error("ParseEnvFile() set the environment")
+	}
+}
+
+func TestLoadEnv(t *testing.T) {
+	dir := t.TempDir()
+	unsetEnv(t, "TEST_DOTENV_A", "TEST_DOTENV_B", "TEST_DOTENV_C", "TEST_DOTENV_D", "TEST_DOTENV_URL")
+	t.Setenv("TEST_DOTENV_PRESET", "from-env")
+
+	base := writeEnvFile(t, dir, ".env",
+		"TEST_DOTENV_A=base\nTEST_DOTENV_B=base\nTEST_DOTENV_C=base\nTEST_DOTENV_PRESET=base\n")
+	local := writeEnvFile(t, dir, ".env.local", "TEST_DOTENV_B=local\n")
+	profile := writeEnvFile(t, dir, ".env.test",
+		"export TEST_DOTENV_C=test\nTEST_DOTENV_URL=${TEST_DOTENV_B}/${TEST_DOTENV_PRESET}\n")
+	writeEnvFile(t, dir, ".env.production", "TEST_DOTENV_D=production\n")
+
+	t.Run("layers override in order", func(t *testing.T) {
+		report, err := LoadEnv(EnvLoadOptions{Dir: dir, Profile: "test"})
+		if err != nil {
+			t.Fatalf("LoadEnv() error = %v", err)
+		}
+
+		wantEnv := map[string]string{
+			"TEST_DOTENV_A":      "base",
+			"TEST_DOTENV_B":      "local",
+			"TEST_DOTENV_C":      "test",
+			"TEST_DOTENV_PRESET": "base",
+			"TEST_DOTENV_URL":    "local/base",
+		}
+		for key, want := range wantEnv {
+			if got := os.Getenv(key); got != want {
+				t.Errorf("%s = %q, want %q", key, got, want)
+			}
+		}
+		if _, set := os.LookupEnv("TEST_DOTENV_D"); set {
+			t.Error("loaded the file of another profile")
+		}
+
+		wantReport := &EnvLoadReport{
+			Files: []string{base, local, profile},
+			Sources: map[string]string{
+				"TEST_DOTENV_A":      base,
+				"TEST_DOTENV_B":      local,
+				"TEST_DOTENV_C":      profile,
+				"TEST_DOTENV_PRESET": base,
+				"TEST_DOTENV_URL":    profile,
+			},
+		}
+		if !reflect.DeepEqual(report, wantReport) {
+			t.Errorf("LoadEnv() report = %+v, want %+v", report, wantReport)
+		}
+	})
+
+	t.Run("no override keeps set variables", func(t *testing.T) {
+		unsetEnv(t, "TEST_DOTENV_A", "TEST_DOTENV_B", "TEST_DOTENV_C", "TEST_DOTENV_URL")
+		t.Setenv("TEST_DOTENV_PRESET", "from-env")
+		t.Setenv("TEST_DOTENV_C", "from-env")
+
+		report, err := LoadEnv(EnvLoadOptions{Dir: dir, Profile: "test", NoOverride: true})
+		if err != nil {
+			t.Fatalf("LoadEnv() error = %v", err)
+		}
+		for key, want := range map[string]string{
+			"TEST_DOTENV_B":      "local",
+			"TEST_DOTENV_C":      "from-env",
+			"TEST_DOTENV_PRESET": "from-env",
+			"TEST_DOTENV_URL":    "local/from-env",
+		} {
+			if got := os.Getenv(key); got != want {
+				t.Errorf("%s = %q, want %q", key, got, want)
+			}
+		}
+		if want := []string{"TEST_DOTENV_C", "TEST_DOTENV_PRESET"}; !reflect.DeepEqual(report.Kept, want) {
+			t.Errorf("Kept = %v, want %v", report.Kept, want)
+		}
+		if _, exists := report.Sources["TEST_DOTENV_PRESET"]; exists {
+			t.Error("Sources lists a kept variable")
+		}
+	})
+
+	t.Run("missing files are skipped", func(t *testing.T) {
+		report, err := LoadEnv(EnvLoadOptions{Dir: filepath.Join(dir, "missing")})
+		if err != nil {
+			t.Fatalf("LoadEnv() error = %v", err)
+		}
+		if len(report.Files) != 0 || len(report.Sources) != 0 {
+			t.Errorf("LoadEnv() report = %+v, want empty", report)
+		}
+	})
+
+	t.Run("other errors are returned before setting anything", func(t *testing.T) {
+		unsetEnv(t, "TEST_DOTENV_A")
+		if _, err := LoadEnv(EnvLoadOptions{Files: []string{base, dir}}); err == nil {
+			t.Error("LoadEnv() of a directory succeeded")
+		}
+		broken := writeEnvFile(t, dir, "broken.env", "TEST_DOTENV_D='open\n")
+		if _, err := LoadEnv(EnvLoadOptions{Files: []string{base, broken}}); err == nil {
+			t.Error("LoadEnv() of a malformed file succeeded")
+		}
+		if _, set := os.LookupEnv("TEST_DOTENV_A"); set {
+			t.Error("LoadEnv() changed the environment after an error")
+		}
+	})
+}
+
+func TestLoadEnvFile(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("TEST_DOTENV_A", "from-env")
+
+	if err := LoadEnvFile(filepath.Join(dir, ".env")); err != nil {
+		t.Errorf("LoadEnvFile() of a missing file error = %v", err)
+	}
+	if err := LoadEnvFile(writeEnvFile(t, dir, ".env", "TEST_DOTENV_A=from-file\n")); err != nil {
+		t.Fatalf("LoadEnvFile() error = %v", err)
+	}
+	if got := os.Getenv("TEST_DOTENV_A"); got != "from-file" {
+		t.Errorf("TEST_DOTENV_A = %q, want the file to override", got)
+	}
+}
+
+func writeEnvFile(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// unsetEnv unsets keys for the rest of the test
+func unsetEnv(t *testing.T, keys ...string) {
+	t.Helper()
+	for _, key := range keys {
+		t.Setenv(key, "")
+		os.Unsetenv(key)
+	}
+}
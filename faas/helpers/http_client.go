@@ -0,0 +1,32 @@
+package helpers
+
+import (
+	"context"
+	"net/http"
+)
+
+// contextTransport binds every outgoing request to a context. It is used
+// for SDKs that build their own requests without accepting a context.
+type contextTransport struct {
+	ctx  context.Context
+	base http.RoundTripper
+}
+
+func (transport contextTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return transport.base.RoundTrip(req.WithContext(transport.ctx))
+}
+
+// NewContextHTTPClient returns a copy of base whose requests are cancelled
+// when ctx is done. A nil base uses http.DefaultClient settings.
+func NewContextHTTPClient(ctx context.Context, base *http.Client) *http.Client {
+	client := &http.Client{}
+	if base != nil {
+		*client = *base
+	}
+	roundTripper := client.Transport
+	if roundTripper == nil {
+		roundTripper = http.DefaultTransport
+	}
+	client.Transport = contextTransport{ctx: ctx, base: roundTripper}
+	return client
+}
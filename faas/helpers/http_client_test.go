@@ -0,0 +1,52 @@
+package helpers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestNewContextHTTPClient(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	t.Run("request is cancelled with the bound context", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		client := NewContextHTTPClient(ctx, nil)
+		// The request itself carries no context of its own
+		req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+		if err != nil {
+			t.Fatalf("NewRequest() error = %v", err)
+		}
+
+		start := time.Now()
+		_, err = client.Do(req)
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("Do() error = %v, want %v", err, context.DeadlineExceeded)
+		}
+		if time.Since(start) > 2*time.Second {
+			t.Error("Do() did not return promptly after the context deadline")
+		}
+	})
+
+	t.Run("base client settings are preserved", func(t *testing.T) {
+		base := &http.Client{Timeout: 3 * time.Second}
+		client := NewContextHTTPClient(context.Background(), base)
+
+		if client.Timeout != base.Timeout {
+			t.Errorf("Timeout = %v, want %v", client.Timeout, base.Timeout)
+		}
+		if base.Transport != nil {
+			t.Error("NewContextHTTPClient() should not modify the base client")
+		}
+	})
+}
@@ -0,0 +1,22 @@
+package helpers
+
+import (
+	"context"
+	"log/slog"
+)
+
+type loggerKeyT struct{}
+
+// WithLogger returns a copy of ctx that carries logger, so that functions
+// log with the fields of their invocation
+func WithLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKeyT{}, logger)
+}
+
+// LoggerFromContext returns the logger set by WithLogger, or slog.Default()
+func LoggerFromContext(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(loggerKeyT{}).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
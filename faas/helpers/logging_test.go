@@ -0,0 +1,19 @@
+package helpers
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+)
+
+func TestLoggerFromContext(t *testing.T) {
+	if got := LoggerFromContext(context.Background()); got != slog.Default() {
+		t.Errorf("LoggerFromContext() without a logger = %p, want slog.Default()", got)
+	}
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	if got := LoggerFromContext(WithLogger(context.Background(), logger)); got != logger {
+		t.Errorf("LoggerFromContext() = %p, want %p", got, logger)
+	}
+}
@@ -0,0 +1,21 @@
+package helpers
+
+import (
+	"encoding/json"
+
+	"github.com/gsarmaonline/faas/faas/intf"
+)
+
+// ToPayload converts a json-tagged struct, such as a function output, into
+// a Payload. Numbers are decoded as float64, as with any JSON payload.
+func ToPayload(value interface{}) (payload intf.Payload, err error) {
+	var encoded []byte
+
+	if encoded, err = json.Marshal(value); err != nil {
+		return
+	}
+	if err = json.Unmarshal(encoded, &payload); err != nil {
+		return
+	}
+	return
+}
@@ -0,0 +1,32 @@
+package helpers
+
+import (
+	"testing"
+)
+
+func TestToPayload(t *testing.T) {
+	type output struct {
+		StatusCode int               `json:"status_code"`
+		Body       string            `json:"body"`
+		Headers    map[string]string `json:"headers,omitempty"`
+	}
+
+	payload, err := ToPayload(output{StatusCode: 200, Body: "ok"})
+	if err != nil {
+		t.Fatalf("ToPayload() error = %v", err)
+	}
+
+	if payload["status_code"] != float64(200) {
+		t.Errorf("status_code = %v, want %v", payload["status_code"], 200)
+	}
+	if payload["body"] != "ok" {
+		t.Errorf("body = %v, want %v", payload["body"], "ok")
+	}
+	if _, exists := payload["headers"]; exists {
+		t.Error("omitempty fields should not be present in the payload")
+	}
+
+	if _, err = ToPayload(make(chan int)); err == nil {
+		t.Error("ToPayload() error = nil, want error for unsupported type")
+	}
+}
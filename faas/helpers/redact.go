@@ -0,0 +1,328 @@
+package helpers
+
+import (
+	"context"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/gsarmaonline/faas/faas/intf"
+)
+
+const (
+	// RedactedValue replaces the value of redacted payload fields
+	RedactedValue = "[REDACTED]"
+
+	// minSecretLength keeps very short values, which would mask unrelated
+	// text, from being redacted wherever they appear
+	minSecretLength = 4
+)
+
+var (
+	// CredentialFields are payload fields that hold credentials in every
+	// function, whether or not their schema marks them WriteOnly
+	CredentialFields = []string{"api_key", "auth_token", "api_token", "registry_password", "token"}
+
+	// CredentialEnvVars are the environment variables whose values are
+	// masked wherever they appear
+	CredentialEnvVars = []string{
+		EnvSendGridAPIKey,
+		EnvSlackAPIToken,
+		EnvTwilioAuthToken,
+		EnvDockerRegistryPassword,
+		EnvGitHubToken,
+	}
+)
+
+type (
+	// Redactor masks credentials in payloads, strings and errors. It knows
+	// credential fields by name and credential values by the environment
+	// variables they came from or because they were added explicitly.
+	// Redactors are immutable; the With methods return extended copies.
+	Redactor struct {
+		fields  map[string]bool
+		envVars []string
+		values  []string
+		sources []func() []string
+	}
+
+	// redactedError masks the message of an error while keeping it
+	// available to errors.Is and errors.As
+	redactedError struct {
+		err     error
+		message string
+	}
+
+	redactorKeyT struct{}
+)
+
+// NewRedactor returns a Redactor for CredentialFields and the values of
+// CredentialEnvVars
+func NewRedactor() *Redactor {
+	redactor := &Redactor{fields: make(map[string]bool)}
+	return redactor.WithFields(CredentialFields...).WithEnvVars(CredentialEnvVars...)
+}
+
+// WithFields returns a copy of redactor that also treats the named payload
+// fields as credentials
+func (redactor *Redactor) WithFields(names ...string) *Redactor {
+	extended := redactor.copy()
+	for _, name := range names {
+		extended.fields[name] = true
+	}
+	return extended
+}
+
+// WithEnvVars returns a copy of redactor that also masks the values of the
+// named environment variables. Values are read on every use, so variables
+// loaded later are covered too.
+func (redactor *Redactor) WithEnvVars(names ...string) *Redactor {
+	extended := redactor.copy()
+	extended.envVars = append(extended.envVars, names...)
+	return extended
+}
+
+// WithValues returns a copy of redactor that also masks the given secret
+// values
+func (redactor *Redactor) WithValues(values ...string) *Redactor {
+	extended := redactor.copy()
+	for _, value := range values {
+		if len(value) >= minSecretLength {
+			extended.values = append(extended.values, value)
+		}
+	}
+	return extended
+}
+
+// WithSecrets returns a copy of redactor that also masks the values returned
+// by source, which is called on every use. It covers secrets that are only
+// known once they are resolved, e.g. from a SecretProvider.
+func (redactor *Redactor) WithSecrets(source func() []string) *Redactor {
+	extended := redactor.copy()
+	extended.sources = append(extended.sources, source)
+	return extended
+}
+
+// WithPayloadCredentials returns a copy of redactor that also masks the
+// values of the credential fields of payload
+func (redactor *Redactor) WithPayloadCredentials(schema *intf.Schema, payload intf.Payload) *Redactor {
+	var values []string
+	redactor.walk(schema, payload, func(value interface{}) {
+		if str, ok := value.(string); ok {
+			values = append(values, str)
+		}
+	})
+	return redactor.WithValues(values...)
+}
+
+// IsCredential reports whether the field name, described by property, holds
+// a credential
+func (redactor *Redactor) IsCredential(name string, property *intf.Schema) bool {
+	return redactor.fields[name] || (property != nil && property.WriteOnly)
+}
+
+// Payload returns a copy of payload in which credential fields, by name or
+// marked WriteOnly in schema, are replaced by RedactedValue and known
+// secret values are masked in all other strings. Nested objects are
+// redacted according to their own properties. payload itself is never
+// modified.
+func (redactor *Redactor) Payload(schema *intf.Schema, payload intf.Payload) intf.Payload {
+	if payload == nil {
+		return nil
+	}
+
+	redacted := make(intf.Payload, len(payload))
+	for key, value := range payload {
+		var property *intf.Schema
+		if schema != nil {
+			property = schema.Properties[key]
+		}
+
+		if redactor.IsCredential(key, property) {
+			redacted[key] = RedactedValue
+			continue
+		}
+		redacted[key] = redactor.value(property, value)
+	}
+	return redacted
+}
+
+// String masks every known secret value in str
+func (redactor *Redactor) String(str string) string {
+	for _, secret := range redactor.secrets() {
+		str = strings.ReplaceAll(str, secret, RedactedValue)
+	}
+	return str
+}
+
+// Error returns err with known secret values masked in its message. The
+// original error stays reachable through errors.Is and errors.As. Errors
+// without secrets are returned as they are.
+func (redactor *Redactor) Error(err error) error {
+	if err == nil {
+		return nil
+	}
+	message := err.Error()
+	if masked := redactor.String(message); masked != message {
+		return &redactedError{err: err, message: masked}
+	}
+	return err
+}
+
+func (redactor *Redactor) value(property *intf.Schema, value interface{}) interface{} {
+	switch typed := value.(type) {
+	case string:
+		return redactor.String(typed)
+	case map[string]interface{}:
+		return map[string]interface{}(redactor.Payload(property, typed))
+	case intf.Payload:
+		return redactor.Payload(property, typed)
+	case []interface{}:
+		var items *intf.Schema
+		if property != nil {
+			items = property.Items
+		}
+		redacted := make([]interface{}, len(typed))
+		for idx, item := range typed {
+			redacted[idx] = redactor.value(items, item)
+		}
+		return redacted
+	}
+	return value
+}
+
+// walk calls fn with the value of every credential field in payload
+func (redactor *Redactor) walk(schema *intf.Schema, payload map[string]interface{}, fn func(interface{})) {
+	for key, value := range payload {
+		var property *intf.Schema
+		if schema != nil {
+			property = schema.Properties[key]
+		}
+
+		if redactor.IsCredential(key, property) {
+			fn(value)
+			continue
+		}
+		switch object := value.(type) {
+		case map[string]interface{}:
+			redactor.walk(property, object, fn)
+		case intf.Payload:
+			redactor.walk(property, object, fn)
+		}
+	}
+}
+
+// secrets returns the known secret values, longest first so that secrets
+// containing other secrets are masked whole
+func (redactor *Redactor) secrets() []string {
+	secrets := append([]string(nil), redactor.values...)
+	for _, envVar := range redactor.envVars {
+		if value := os.Getenv(envVar); len(value) >= minSecretLength {
+			secrets = append(secrets, value)
+		}
+	}
+	for _, source := range redactor.sources {
+		for _, value := range source() {
+			if len(value) >= minSecretLength {
+				secrets = append(secrets, value)
+			}
+		}
+	}
+	sort.Slice(secrets, func(i, j int) bool {
+		return len(secrets[i]) > len(secrets[j])
+	})
+	return secrets
+}
+
+func (redactor *Redactor) copy() *Redactor {
+	extended := &Redactor{
+		fields:  make(map[string]bool, len(redactor.fields)),
+		envVars: append([]string(nil), redactor.envVars...),
+		values:  append([]string(nil), redactor.values...),
+		sources: append([]func() []string(nil), redactor.sources...),
+	}
+	for name := range redactor.fields {
+		extended.fields[name] = true
+	}
+	return extended
+}
+
+func (redactedErr *redactedError) Error() string {
+	return redactedErr.message
+}
+
+func (redactedErr *redactedError) Unwrap() error {
+	return redactedErr.err
+}
+
+// WithRedactor returns a copy of ctx that carries the Redactor of an
+// invocation
+func WithRedactor(ctx context.Context, redactor *Redactor) context.Context {
+	return context.WithValue(ctx, redactorKeyT{}, redactor)
+}
+
+// RedactorFromContext returns the Redactor set by WithRedactor, or a new
+// default Redactor
+func RedactorFromContext(ctx context.Context) *Redactor {
+	if redactor, ok := ctx.Value(redactorKeyT{}).(*Redactor); ok {
+		return redactor
+	}
+	return NewRedactor()
+}
+
+// RedactPayload redacts payload with the default Redactor; see
+// Redactor.Payload
+func RedactPayload(schema *intf.Schema, payload intf.Payload) intf.Payload {
+	return NewRedactor().Payload(schema, payload)
+}
+
+// StripRedacted returns a copy of payload without the fields that
+// RedactPayload replaced, so that functions fall back to their default
+// credentials when a redacted payload is sent again
+func StripRedacted(payload intf.Payload) intf.Payload {
+	if payload == nil {
+		return nil
+	}
+
+	stripped := make(intf.Payload, len(payload))
+	for key, value := range payload {
+		switch object := value.(type) {
+		case string:
+			if object == RedactedValue {
+				continue
+			}
+			stripped[key] = value
+		case map[string]interface{}:
+			stripped[key] = map[string]interface{}(StripRedacted(object))
+		case intf.Payload:
+			stripped[key] = StripRedacted(object)
+		default:
+			stripped[key] = value
+		}
+	}
+	return stripped
+}
+
+// RedactedFields returns the sorted paths of the fields of payload that
+// RedactPayload replaced, with nested fields joined by dots, e.g.
+// auth.token
+func RedactedFields(payload intf.Payload) (fields []string) {
+	for key, value := range payload {
+		switch object := value.(type) {
+		case string:
+			if object == RedactedValue {
+				fields = append(fields, key)
+			}
+		case map[string]interface{}:
+			for _, field := range RedactedFields(object) {
+				fields = append(fields, key+"."+field)
+			}
+		case intf.Payload:
+			for _, field := range RedactedFields(object) {
+				fields = append(fields, key+"."+field)
+			}
+		}
+	}
+	sort.Strings(fields)
+	return
+}
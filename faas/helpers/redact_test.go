@@ -0,0 +1,173 @@
+package helpers
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gsarmaonline/faas/faas/intf"
+)
+
+func TestRedactPayload(t *testing.T) {
+	type (
+		nested struct {
+			Token string `json:"token" jsonschema:"credential"`
+			Label string `json:"label"`
+		}
+		input struct {
+			Message string `json:"message"`
+			ApiKey  string `json:"api_key" jsonschema:"credential"`
+			Auth    nested `json:"auth"`
+		}
+	)
+	schema := GenerateSchema(input{})
+
+	tests := []struct {
+		name    string
+		payload intf.Payload
+		want    intf.Payload
+	}{
+		{name: "nil payload", payload: nil, want: nil},
+		{
+			name:    "credential redacted",
+			payload: intf.Payload{"message": "hi", "api_key": "secret"},
+			want:    intf.Payload{"message": "hi", "api_key": RedactedValue},
+		},
+		{
+			name: "nested credential redacted",
+			payload: intf.Payload{
+				"auth": map[string]interface{}{"token": "secret", "label": "prod"},
+			},
+			want: intf.Payload{
+				"auth": map[string]interface{}{"token": RedactedValue, "label": "prod"},
+			},
+		},
+		{
+			name:    "unknown fields kept",
+			payload: intf.Payload{"extra": "value"},
+			want:    intf.Payload{"extra": "value"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := RedactPayload(schema, tt.payload); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("RedactPayload() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	payload := intf.Payload{"api_key": "secret"}
+	RedactPayload(schema, payload)
+	if payload["api_key"] != "secret" {
+		t.Errorf("RedactPayload() modified its input: %v", payload)
+	}
+}
+
+func TestStripRedacted(t *testing.T) {
+	payload := intf.Payload{
+		"message": "hi",
+		"api_key": RedactedValue,
+		"auth":    map[string]interface{}{"token": RedactedValue, "label": "prod"},
+	}
+	want := intf.Payload{
+		"message": "hi",
+		"auth":    map[string]interface{}{"label": "prod"},
+	}
+
+	if got := StripRedacted(payload); !reflect.DeepEqual(got, want) {
+		t.Errorf("StripRedacted() = %v, want %v", got, want)
+	}
+	if payload["api_key"] != RedactedValue {
+		t.Errorf("StripRedacted() modified its input: %v", payload)
+	}
+}
+
+func TestRedactedFields(t *testing.T) {
+	payload := intf.Payload{
+		"message": "hi",
+		"api_key": RedactedValue,
+		"auth":    map[string]interface{}{"token": RedactedValue, "label": "prod"},
+	}
+	if got, want := RedactedFields(payload), []string{"api_key", "auth.token"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("RedactedFields() = %v, want %v", got, want)
+	}
+	if got := RedactedFields(intf.Payload{"message": "hi"}); got != nil {
+		t.Errorf("RedactedFields() = %v, want none", got)
+	}
+}
+
+func TestRedactor(t *testing.T) {
+	t.Setenv(EnvSlackAPIToken, "xoxb-env-token")
+	redactor := NewRedactor().WithValues("sk-payload", "abc")
+
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{name: "env credential", in: "auth failed for xoxb-env-token", want: "auth failed for " + RedactedValue},
+		{name: "added value", in: "key sk-payload rejected", want: "key " + RedactedValue + " rejected"},
+		{name: "short values ignored", in: "abc", want: "abc"},
+		{name: "no secrets", in: "channel_not_found", want: "channel_not_found"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := redactor.String(tt.in); got != tt.want {
+				t.Errorf("String(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+
+	// Credential fields are known by name even without a schema
+	payload := intf.Payload{
+		"token":   "ghp_x",
+		"message": "sent with xoxb-env-token",
+		"list":    []interface{}{"sk-payload", 1},
+	}
+	want := intf.Payload{
+		"token":   RedactedValue,
+		"message": "sent with " + RedactedValue,
+		"list":    []interface{}{RedactedValue, 1},
+	}
+	if got := redactor.Payload(nil, payload); !reflect.DeepEqual(got, want) {
+		t.Errorf("Payload() = %v, want %v", got, want)
+	}
+}
+
+func TestRedactor_Error(t *testing.T) {
+	redactor := NewRedactor().WithValues("SG.secret")
+	cause := errors.New("unauthorized")
+	err := fmt.Errorf("SendGrid API error: key SG.secret: %w", cause)
+
+	redacted := redactor.Error(err)
+	if strings.Contains(redacted.Error(), "SG.secret") {
+		t.Errorf("Error() = %q, want the key masked", redacted.Error())
+	}
+	if !errors.Is(redacted, cause) {
+		t.Error("redacted error does not wrap its cause")
+	}
+	if redactor.Error(cause) != cause {
+		t.Error("Error() wrapped an error without secrets")
+	}
+}
+
+func TestRedactor_WithPayloadCredentials(t *testing.T) {
+	schema := &intf.Schema{Properties: map[string]*intf.Schema{
+		"password": {Type: intf.StringSchemaType, WriteOnly: true},
+		"auth":     {Type: intf.ObjectSchemaType},
+	}}
+	payload := intf.Payload{
+		"password": "hunter22",
+		"auth":     map[string]interface{}{"api_key": "nested-key"},
+		"message":  "not a secret",
+	}
+
+	redactor := NewRedactor().WithPayloadCredentials(schema, payload)
+	got := redactor.String("hunter22 nested-key not a secret")
+	if want := RedactedValue + " " + RedactedValue + " not a secret"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+}
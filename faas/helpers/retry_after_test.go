@@ -0,0 +1,43 @@
+package helpers
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		min   time.Duration
+		max   time.Duration
+	}{
+		{name: "empty", value: "", min: 0, max: 0},
+		{name: "seconds", value: "30", min: 30 * time.Second, max: 30 * time.Second},
+		{name: "padded seconds", value: " 5 ", min: 5 * time.Second, max: 5 * time.Second},
+		{name: "negative seconds", value: "-1", min: 0, max: 0},
+		{name: "garbage", value: "soon", min: 0, max: 0},
+		{
+			name:  "http date",
+			value: time.Now().Add(time.Minute).UTC().Format(http.TimeFormat),
+			min:   50 * time.Second,
+			max:   time.Minute,
+		},
+		{
+			name:  "past http date",
+			value: time.Now().Add(-time.Minute).UTC().Format(http.TimeFormat),
+			min:   0,
+			max:   0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ParseRetryAfter(tt.value)
+			if got < tt.min || got > tt.max {
+				t.Errorf("ParseRetryAfter(%q) = %v, want between %v and %v", tt.value, got, tt.min, tt.max)
+			}
+		})
+	}
+}
@@ -0,0 +1,269 @@
+package helpers
+
+import (
+	"fmt"
+	"math"
+	"net/mail"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gsarmaonline/faas/faas/intf"
+)
+
+// Schema generation reads two struct tags next to the json tag:
+//
+//	description:"Text shown to users of the function"
+//	jsonschema:"required,credential,format=uri,enum=GET|POST"
+//
+// "credential" marks fields that fall back to an environment variable. They
+// are never required and are flagged writeOnly in the schema.
+const (
+	descriptionTag = "description"
+	jsonSchemaTag  = "jsonschema"
+)
+
+// Formats checked by ValidateSchema. Other formats are only descriptive.
+const (
+	EmailSchemaFormat    = "email"
+	URISchemaFormat      = "uri"
+	DateTimeSchemaFormat = "date-time"
+)
+
+// schemaCache holds generated schemas per type. Callers get copies, so the
+// cached schemas are never modified.
+var schemaCache sync.Map
+
+// GenerateSchema returns the JSON Schema of the type of value, derived from
+// its json, description and jsonschema struct tags. Every call returns a
+// new copy that the caller may modify.
+func GenerateSchema(value interface{}) *intf.Schema {
+	valueType := reflect.TypeOf(value)
+	if cached, exists := schemaCache.Load(valueType); exists {
+		return cached.(*intf.Schema).Copy()
+	}
+	schema := schemaForType(valueType, make(map[reflect.Type]bool))
+	schemaCache.Store(valueType, schema)
+	return schema.Copy()
+}
+
+// schemaForType builds the schema of valueType. visiting holds the structs
+// being expanded; a struct that refers back to one of them gets an empty
+// schema, which accepts any value, instead of recursing forever.
+func schemaForType(valueType reflect.Type, visiting map[reflect.Type]bool) *intf.Schema {
+	if valueType == nil {
+		return &intf.Schema{}
+	}
+	for valueType.Kind() == reflect.Ptr {
+		valueType = valueType.Elem()
+	}
+
+	switch valueType.Kind() {
+	case reflect.String:
+		return &intf.Schema{Type: intf.StringSchemaType}
+	case reflect.Bool:
+		return &intf.Schema{Type: intf.BooleanSchemaType}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &intf.Schema{Type: intf.IntegerSchemaType}
+	case reflect.Float32, reflect.Float64:
+		return &intf.Schema{Type: intf.NumberSchemaType}
+	case reflect.Slice, reflect.Array:
+		return &intf.Schema{Type: intf.ArraySchemaType, Items: schemaForType(valueType.Elem(), visiting)}
+	case reflect.Map:
+		return &intf.Schema{Type: intf.ObjectSchemaType, AdditionalProperties: schemaForType(valueType.Elem(), visiting)}
+	case reflect.Struct:
+		if visiting[valueType] {
+			return &intf.Schema{}
+		}
+		visiting[valueType] = true
+		defer delete(visiting, valueType)
+		return schemaForStruct(valueType, visiting)
+	}
+	// Interfaces accept any value
+	return &intf.Schema{}
+}
+
+func schemaForStruct(structType reflect.Type, visiting map[reflect.Type]bool) *intf.Schema {
+	schema := &intf.Schema{
+		Type:       intf.ObjectSchemaType,
+		Properties: make(map[string]*intf.Schema),
+	}
+	for i := 0; i < structType.NumField(); i++ {
+		field := structType.Field(i)
+		name, ok := JSONFieldName(field)
+		if !ok {
+			continue
+		}
+
+		property := schemaForType(field.Type, visiting)
+		property.Description = field.Tag.Get(descriptionTag)
+
+		for _, option := range strings.Split(field.Tag.Get(jsonSchemaTag), ",") {
+			key, value, _ := strings.Cut(option, "=")
+			switch key {
+			case "required":
+				schema.Required = append(schema.Required, name)
+			case "credential":
+				property.WriteOnly = true
+			case "format":
+				property.Format = value
+			case "enum":
+				for _, enumValue := range strings.Split(value, "|") {
+					property.Enum = append(property.Enum, enumValue)
+				}
+			}
+		}
+		schema.Properties[name] = property
+	}
+	return schema
+}
+
+// ValidateSchema checks a payload against an object schema. A nil schema
+// accepts every payload. Non-empty strings are checked against the email,
+// uri and date-time formats. All violations are reported in one
+// *PayloadError.
+func ValidateSchema(schema *intf.Schema, payload intf.Payload) error {
+	if schema == nil {
+		return nil
+	}
+	validator := &schemaValidator{}
+	validator.validate("", schema, map[string]interface{}(payload))
+	if len(validator.errors) > 0 {
+		return &PayloadError{Errors: validator.errors}
+	}
+	return nil
+}
+
+type schemaValidator struct {
+	errors []FieldError
+}
+
+func (validator *schemaValidator) fail(path string, expected string, value interface{}) {
+	validator.errors = append(validator.errors, FieldError{
+		Field:    path,
+		Expected: expected,
+		Actual:   describeValue(value),
+	})
+}
+
+func (validator *schemaValidator) validate(path string, schema *intf.Schema, value interface{}) {
+	source := reflect.ValueOf(value)
+
+	switch schema.Type {
+	case intf.StringSchemaType:
+		if source.Kind() != reflect.String {
+			validator.fail(path, "string", value)
+			return
+		}
+		if message := checkFormat(schema.Format, source.String()); message != "" {
+			validator.errors = append(validator.errors, FieldError{Field: path, Message: message})
+			return
+		}
+	case intf.BooleanSchemaType:
+		if source.Kind() != reflect.Bool {
+			validator.fail(path, "boolean", value)
+			return
+		}
+	case intf.IntegerSchemaType:
+		if number, ok := toFloat(source); !ok || number != math.Trunc(number) {
+			validator.fail(path, "integer", value)
+			return
+		}
+	case intf.NumberSchemaType:
+		if _, ok := toFloat(source); !ok {
+			validator.fail(path, "number", value)
+			return
+		}
+	case intf.ArraySchemaType:
+		if source.Kind() != reflect.Slice && source.Kind() != reflect.Array {
+			validator.fail(path, "array", value)
+			return
+		}
+		if schema.Items != nil {
+			for i := 0; i < source.Len(); i++ {
+				if element := source.Index(i).Interface(); element != nil {
+					validator.validate(fmt.Sprintf("%s[%d]", path, i), schema.Items, element)
+				}
+			}
+		}
+	case intf.ObjectSchemaType:
+		values, ok := toObject(source)
+		if !ok {
+			validator.fail(path, "object", value)
+			return
+		}
+		validator.validateObject(path, schema, values)
+	}
+
+	if len(schema.Enum) > 0 && !enumContains(schema.Enum, value) {
+		validator.errors = append(validator.errors, FieldError{
+			Field:   path,
+			Message: fmt.Sprintf("must be one of %v", schema.Enum),
+		})
+	}
+}
+
+func (validator *schemaValidator) validateObject(path string, schema *intf.Schema, values map[string]interface{}) {
+	for _, name := range schema.Required {
+		if value, exists := values[name]; !exists || value == nil {
+			validator.errors = append(validator.errors, FieldError{
+				Field:   joinPath(path, name),
+				Message: "is required",
+			})
+		}
+	}
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		value := values[name]
+		if value == nil {
+			continue
+		}
+		property, exists := schema.Properties[name]
+		if !exists {
+			property = schema.AdditionalProperties
+		}
+		if property != nil {
+			validator.validate(joinPath(path, name), property, value)
+		}
+	}
+}
+
+// checkFormat returns why value does not match format, or an empty string
+func checkFormat(format, value string) string {
+	if value == "" {
+		return ""
+	}
+	switch format {
+	case EmailSchemaFormat:
+		if address, err := mail.ParseAddress(value); err != nil || address.Address != value {
+			return "must be an email address"
+		}
+	case URISchemaFormat:
+		if parsed, err := url.Parse(value); err != nil || parsed.Scheme == "" {
+			return "must be an absolute URI"
+		}
+	case DateTimeSchemaFormat:
+		if _, err := time.Parse(time.RFC3339, value); err != nil {
+			return "must be an RFC 3339 date-time"
+		}
+	}
+	return ""
+}
+
+func enumContains(enum []interface{}, value interface{}) bool {
+	for _, enumValue := range enum {
+		if reflect.DeepEqual(enumValue, value) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,196 @@
+package helpers
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/gsarmaonline/faas/faas/intf"
+)
+
+type formatTarget struct {
+	Email   string `json:"email" jsonschema:"format=email"`
+	Url     string `json:"url" jsonschema:"format=uri"`
+	Created string `json:"created" jsonschema:"format=date-time"`
+	Color   string `json:"color" jsonschema:"format=color"`
+}
+
+type schemaTarget struct {
+	Url      string            `json:"url" jsonschema:"required,format=uri" description:"URL to call"`
+	Method   string            `json:"method" jsonschema:"required,enum=GET|POST"`
+	Token    string            `json:"token" jsonschema:"credential"`
+	Retries  int               `json:"retries"`
+	Tags     []string          `json:"tags"`
+	Headers  map[string]string `json:"headers"`
+	Body     interface{}       `json:"body"`
+	internal string
+}
+
+func TestGenerateSchema(t *testing.T) {
+	schema := GenerateSchema(schemaTarget{})
+
+	if schema.Type != intf.ObjectSchemaType {
+		t.Fatalf("Type = %v, want %v", schema.Type, intf.ObjectSchemaType)
+	}
+	if !reflect.DeepEqual(schema.Required, []string{"url", "method"}) {
+		t.Errorf("Required = %v, want [url method]", schema.Required)
+	}
+	if len(schema.Properties) != 7 {
+		t.Errorf("Properties = %v, want 7 exported json fields", schema.Properties)
+	}
+
+	url := schema.Properties["url"]
+	if url.Type != intf.StringSchemaType || url.Format != "uri" || url.Description != "URL to call" {
+		t.Errorf("url property = %+v", url)
+	}
+	if !reflect.DeepEqual(schema.Properties["method"].Enum, []interface{}{"GET", "POST"}) {
+		t.Errorf("method enum = %v, want [GET POST]", schema.Properties["method"].Enum)
+	}
+	if !schema.Properties["token"].WriteOnly {
+		t.Error("credential fields should be writeOnly")
+	}
+	if schema.Properties["retries"].Type != intf.IntegerSchemaType {
+		t.Errorf("retries type = %v, want integer", schema.Properties["retries"].Type)
+	}
+	if tags := schema.Properties["tags"]; tags.Type != intf.ArraySchemaType || tags.Items.Type != intf.StringSchemaType {
+		t.Errorf("tags property = %+v", tags)
+	}
+	if headers := schema.Properties["headers"]; headers.Type != intf.ObjectSchemaType || headers.AdditionalProperties.Type != intf.StringSchemaType {
+		t.Errorf("headers property = %+v", headers)
+	}
+	if schema.Properties["body"].Type != "" {
+		t.Errorf("body type = %v, want any", schema.Properties["body"].Type)
+	}
+
+	// Callers get copies of the cached schema
+	schema.Properties["url"].Format = "changed"
+	schema.Required = append(schema.Required[:0], "changed")
+	if again := GenerateSchema(schemaTarget{}); again.Properties["url"].Format != "uri" || again.Required[0] != "url" {
+		t.Errorf("GenerateSchema() after modifying a copy = %+v", again)
+	}
+}
+
+type treeTarget struct {
+	Name     string       `json:"name"`
+	Parent   *treeTarget  `json:"parent"`
+	Children []treeTarget `json:"children"`
+}
+
+func TestGenerateSchema_SelfReferential(t *testing.T) {
+	schema := GenerateSchema(treeTarget{})
+
+	if schema.Properties["name"].Type != intf.StringSchemaType {
+		t.Errorf("name type = %v, want string", schema.Properties["name"].Type)
+	}
+	if parent := schema.Properties["parent"]; parent.Type != "" || parent.Properties != nil {
+		t.Errorf("parent property = %+v, want an empty schema", parent)
+	}
+	children := schema.Properties["children"]
+	if children.Type != intf.ArraySchemaType || children.Items.Type != "" {
+		t.Errorf("children property = %+v, want an array of empty schemas", children)
+	}
+}
+
+func TestValidateSchema(t *testing.T) {
+	schema := GenerateSchema(schemaTarget{})
+
+	tests := []struct {
+		name       string
+		payload    intf.Payload
+		wantFields []string
+	}{
+		{
+			name: "valid payload",
+			payload: intf.Payload{
+				"url":     "https://example.com",
+				"method":  "GET",
+				"retries": float64(2),
+				"tags":    []interface{}{"a"},
+				"headers": map[string]interface{}{"X-Test": "1"},
+				"body":    map[string]interface{}{"any": true},
+				"unknown": "allowed",
+			},
+		},
+		{
+			name:       "missing required fields",
+			payload:    intf.Payload{"method": nil},
+			wantFields: []string{"url", "method"},
+		},
+		{
+			name: "wrong types and enum",
+			payload: intf.Payload{
+				"url":     float64(1),
+				"method":  "DELETE",
+				"retries": 1.5,
+				"tags":    []interface{}{true},
+				"headers": map[string]interface{}{"X-Test": float64(1)},
+			},
+			wantFields: []string{"headers.X-Test", "method", "retries", "tags[0]", "url"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateSchema(schema, tt.payload)
+			if len(tt.wantFields) == 0 {
+				if err != nil {
+					t.Errorf("ValidateSchema() error = %v, want nil", err)
+				}
+				return
+			}
+
+			var payloadErr *PayloadError
+			if !errors.As(err, &payloadErr) {
+				t.Fatalf("ValidateSchema() error = %v, want *PayloadError", err)
+			}
+			var fields []string
+			for _, fieldErr := range payloadErr.Errors {
+				fields = append(fields, fieldErr.Field)
+			}
+			if !reflect.DeepEqual(fields, tt.wantFields) {
+				t.Errorf("error fields = %v, want %v", fields, tt.wantFields)
+			}
+		})
+	}
+
+	if err := ValidateSchema(nil, intf.Payload{"anything": 1}); err != nil {
+		t.Errorf("ValidateSchema(nil) error = %v, want nil", err)
+	}
+}
+
+func TestValidateSchema_Formats(t *testing.T) {
+	schema := GenerateSchema(formatTarget{})
+
+	tests := []struct {
+		name      string
+		payload   intf.Payload
+		wantField string
+	}{
+		{name: "valid email", payload: intf.Payload{"email": "ops@example.com"}},
+		{name: "email without domain", payload: intf.Payload{"email": "ops"}, wantField: "email"},
+		{name: "email with display name", payload: intf.Payload{"email": "Ops <ops@example.com>"}, wantField: "email"},
+		{name: "valid uri", payload: intf.Payload{"url": "https://example.com/path?q=1"}},
+		{name: "relative uri", payload: intf.Payload{"url": "/path"}, wantField: "url"},
+		{name: "malformed uri", payload: intf.Payload{"url": "http://[::1"}, wantField: "url"},
+		{name: "valid date-time", payload: intf.Payload{"created": "2026-10-17T20:00:00+02:00"}},
+		{name: "date without time", payload: intf.Payload{"created": "2026-10-17"}, wantField: "created"},
+		{name: "empty values are not checked", payload: intf.Payload{"email": "", "url": "", "created": ""}},
+		{name: "unknown formats are descriptive", payload: intf.Payload{"color": "not a color"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateSchema(schema, tt.payload)
+			if tt.wantField == "" {
+				if err != nil {
+					t.Errorf("ValidateSchema() error = %v, want nil", err)
+				}
+				return
+			}
+			var payloadErr *PayloadError
+			if !errors.As(err, &payloadErr) || len(payloadErr.Errors) != 1 || payloadErr.Errors[0].Field != tt.wantField {
+				t.Errorf("ValidateSchema() error = %v, want a format error for %s", err, tt.wantField)
+			}
+		})
+	}
+}
@@ -0,0 +1,362 @@
+package helpers
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	// Environment variables that configure the encrypted secrets store of
+	// DefaultSecretProvider and the faas-secrets command
+	EnvSecretsFile      = "FAAS_SECRETS_FILE"
+	EnvMasterKeyFile    = "FAAS_MASTER_KEY_FILE"
+	EnvMasterPassphrase = "FAAS_MASTER_PASSPHRASE"
+
+	// DefaultKeyDerivationIterations is the PBKDF2-SHA256 work factor of
+	// new store files
+	DefaultKeyDerivationIterations = 600000
+	// MaxKeyDerivationIterations bounds the work factor, which is read from
+	// the file before it is authenticated
+	MaxKeyDerivationIterations = 10 * DefaultKeyDerivationIterations
+
+	secretStoreVersion = 1
+	secretStoreKDF     = "pbkdf2-sha256"
+	saltSize           = 16
+	keySize            = 32
+)
+
+var (
+	ErrWrongMasterKey = errors.New("wrong master key or corrupted secrets file")
+	ErrNoMasterKey    = errors.New("no master key: set " + EnvMasterKeyFile + " or " + EnvMasterPassphrase)
+)
+
+type (
+	// EncryptedSecretStore keeps secrets in a file encrypted with AES-256-GCM
+	// under a key derived from a master key, which is a passphrase or the
+	// content of a key file. A missing file is an empty store; it is
+	// created on the first write with mode 0600.
+	EncryptedSecretStore struct {
+		path      string
+		masterKey []byte
+		// Iterations is the key derivation work factor used when the file
+		// is written; reads use the factor stored in the file
+		Iterations int
+
+		mu sync.Mutex
+		// key is the derived key of the current salt of the file
+		key derivedKey
+	}
+
+	derivedKey struct {
+		salt       []byte
+		iterations int
+		key        []byte
+	}
+
+	// secretStoreFile is the on-disk format. The header fields are
+	// authenticated as additional data of the ciphertext.
+	secretStoreFile struct {
+		Version    int    `json:"version"`
+		KDF        string `json:"kdf"`
+		Iterations int    `json:"iterations"`
+		Salt       []byte `json:"salt"`
+		Nonce      []byte `json:"nonce"`
+		Ciphertext []byte `json:"ciphertext"`
+	}
+)
+
+// NewEncryptedSecretStore returns the store of the file at path, encrypted
+// with masterKey
+func NewEncryptedSecretStore(path string, masterKey []byte) *EncryptedSecretStore {
+	return &EncryptedSecretStore{
+		path:       path,
+		masterKey:  masterKey,
+		Iterations: DefaultKeyDerivationIterations,
+	}
+}
+
+// MasterKeyFromEnv reads the master key from the file named by
+// EnvMasterKeyFile, or else from EnvMasterPassphrase
+func MasterKeyFromEnv() ([]byte, error) {
+	if path := os.Getenv(EnvMasterKeyFile); path != "" {
+		return MasterKeyFromFile(path)
+	}
+	if passphrase := os.Getenv(EnvMasterPassphrase); passphrase != "" {
+		return []byte(passphrase), nil
+	}
+	return nil, ErrNoMasterKey
+}
+
+// MasterKeyFromFile reads a master key file without its trailing newline
+func MasterKeyFromFile(path string) ([]byte, error) {
+	key, err := readSecretFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if key == "" {
+		return nil, fmt.Errorf("master key file %s is empty", path)
+	}
+	return []byte(key), nil
+}
+
+// GetSecret implements SecretProvider
+func (store *EncryptedSecretStore) GetSecret(ctx context.Context, key string) (string, error) {
+	return store.Get(key)
+}
+
+// Get returns the secret stored under key
+func (store *EncryptedSecretStore) Get(key string) (value string, err error) {
+	var secrets map[string]string
+	if secrets, err = store.read(); err != nil {
+		return
+	}
+	value, exists := secrets[key]
+	if !exists {
+		err = fmt.Errorf("%s: %w", key, ErrSecretNotFound)
+	}
+	return
+}
+
+// List returns the stored keys, sorted
+func (store *EncryptedSecretStore) List() (keys []string, err error) {
+	var secrets map[string]string
+	if secrets, err = store.read(); err != nil {
+		return
+	}
+	for key := range secrets {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return
+}
+
+// Set stores value under key
+func (store *EncryptedSecretStore) Set(key, value string) error {
+	return store.Import(map[string]string{key: value})
+}
+
+// Import stores all values, replacing secrets with the same keys
+func (store *EncryptedSecretStore) Import(values map[string]string) error {
+	return store.update(func(secrets map[string]string) error {
+		for key, value := range values {
+			if key == "" {
+				return errors.New("empty secret key")
+			}
+			secrets[key] = value
+		}
+		return nil
+	})
+}
+
+// Delete removes the secret stored under key
+func (store *EncryptedSecretStore) Delete(key string) error {
+	return store.update(func(secrets map[string]string) error {
+		if _, exists := secrets[key]; !exists {
+			return fmt.Errorf("%s: %w", key, ErrSecretNotFound)
+		}
+		delete(secrets, key)
+		return nil
+	})
+}
+
+// Rotate encrypts the store with newMasterKey under a fresh salt. The store
+// uses newMasterKey from then on.
+func (store *EncryptedSecretStore) Rotate(newMasterKey []byte) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	secrets, err := store.readLocked()
+	if err != nil {
+		return err
+	}
+	store.masterKey = newMasterKey
+	store.key = derivedKey{}
+	return store.writeLocked(secrets)
+}
+
+func (store *EncryptedSecretStore) update(fn func(secrets map[string]string) error) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	secrets, err := store.readLocked()
+	if err != nil {
+		return err
+	}
+	if err = fn(secrets); err != nil {
+		return err
+	}
+	return store.writeLocked(secrets)
+}
+
+func (store *EncryptedSecretStore) read() (map[string]string, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	return store.readLocked()
+}
+
+func (store *EncryptedSecretStore) readLocked() (secrets map[string]string, err error) {
+	var (
+		content   []byte
+		file      secretStoreFile
+		key       []byte
+		gcm       cipher.AEAD
+		plaintext []byte
+	)
+
+	secrets = make(map[string]string)
+	if content, err = os.ReadFile(store.path); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			err = nil
+		}
+		return
+	}
+	if err = json.Unmarshal(content, &file); err != nil {
+		err = fmt.Errorf("reading secrets file %s: %w", store.path, err)
+		return
+	}
+	if file.Version != secretStoreVersion || file.KDF != secretStoreKDF {
+		err = fmt.Errorf("unsupported secrets file %s: version %d, kdf %s", store.path, file.Version, file.KDF)
+		return
+	}
+
+	if key, err = store.deriveKey(file.Salt, file.Iterations); err != nil {
+		return
+	}
+	if gcm, err = newGCM(key); err != nil {
+		return
+	}
+	if len(file.Nonce) != gcm.NonceSize() {
+		err = ErrWrongMasterKey
+		return
+	}
+	if plaintext, err = gcm.Open(nil, file.Nonce, file.Ciphertext, file.additionalData()); err != nil {
+		err = ErrWrongMasterKey
+		return
+	}
+	err = json.Unmarshal(plaintext, &secrets)
+	return
+}
+
+func (store *EncryptedSecretStore) writeLocked(secrets map[string]string) (err error) {
+	var (
+		plaintext []byte
+		key       []byte
+		gcm       cipher.AEAD
+		content   []byte
+	)
+
+	file := secretStoreFile{
+		Version:    secretStoreVersion,
+		KDF:        secretStoreKDF,
+		Iterations: store.Iterations,
+		Salt:       make([]byte, saltSize),
+	}
+	if _, err = rand.Read(file.Salt); err != nil {
+		return
+	}
+	if key, err = store.deriveKey(file.Salt, file.Iterations); err != nil {
+		return
+	}
+	if gcm, err = newGCM(key); err != nil {
+		return
+	}
+	file.Nonce = make([]byte, gcm.NonceSize())
+	if _, err = rand.Read(file.Nonce); err != nil {
+		return
+	}
+	if plaintext, err = json.Marshal(secrets); err != nil {
+		return
+	}
+	file.Ciphertext = gcm.Seal(nil, file.Nonce, plaintext, file.additionalData())
+	if content, err = json.MarshalIndent(file, "", "  "); err != nil {
+		return
+	}
+	return writeFileAtomic(store.path, content, 0600)
+}
+
+// deriveKey derives the encryption key of a salt. The key of the last salt
+// is cached since PBKDF2 is deliberately slow; every write uses a fresh salt,
+// so older keys are never needed again.
+func (store *EncryptedSecretStore) deriveKey(salt []byte, iterations int) (key []byte, err error) {
+	if len(store.masterKey) == 0 {
+		err = ErrNoMasterKey
+		return
+	}
+	if iterations <= 0 || iterations > MaxKeyDerivationIterations {
+		err = fmt.Errorf("invalid key derivation iterations %d, want 1 to %d", iterations, MaxKeyDerivationIterations)
+		return
+	}
+
+	if store.key.iterations == iterations && bytes.Equal(store.key.salt, salt) {
+		return store.key.key, nil
+	}
+	if key, err = pbkdf2.Key(sha256.New, string(store.masterKey), salt, iterations, keySize); err != nil {
+		return
+	}
+	store.key = derivedKey{salt: salt, iterations: iterations, key: key}
+	return
+}
+
+func (file secretStoreFile) additionalData() []byte {
+	return []byte(fmt.Sprintf("%d:%s:%d:%x", file.Version, file.KDF, file.Iterations, file.Salt))
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// writeFileAtomic replaces the file at path, so that readers never see a
+// partially written file
+func writeFileAtomic(path string, content []byte, perm os.FileMode) (err error) {
+	var tmp *os.File
+	if tmp, err = os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*"); err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	if err = tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return
+	}
+	if _, err = tmp.Write(content); err != nil {
+		tmp.Close()
+		return
+	}
+	if err = tmp.Close(); err != nil {
+		return
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// envSecretStore returns the store configured by EnvSecretsFile, if any.
+// A missing master key is reported when a secret is looked up.
+func envSecretStore() (store *EncryptedSecretStore, configured bool) {
+	path := strings.TrimSpace(os.Getenv(EnvSecretsFile))
+	if path == "" {
+		return nil, false
+	}
+	masterKey, _ := MasterKeyFromEnv()
+	return NewEncryptedSecretStore(path, masterKey), true
+}
@@ -0,0 +1,166 @@
+package helpers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func newTestSecretStore(t *testing.T, path string, masterKey string) *EncryptedSecretStore {
+	store := NewEncryptedSecretStore(path, []byte(masterKey))
+	store.Iterations = 1000
+	return store
+}
+
+func TestEncryptedSecretStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secrets.enc")
+	store := newTestSecretStore(t, path, "correct horse")
+
+	if keys, err := store.List(); err != nil || len(keys) != 0 {
+		t.Fatalf("List() of a missing file = %v, %v; want an empty store", keys, err)
+	}
+	if err := store.Import(map[string]string{EnvSlackAPIToken: "xoxb-1", EnvGitHubToken: "ghp-1"}); err != nil {
+		t.Fatalf("Import() error = %v", err)
+	}
+	if err := store.Set(EnvSlackAPIToken, "xoxb-2"); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+	if err := store.Delete(EnvGitHubToken); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+
+	// A second store reads what the first wrote
+	reopened := newTestSecretStore(t, path, "correct horse")
+	if got, err := reopened.GetSecret(context.Background(), EnvSlackAPIToken); got != "xoxb-2" || err != nil {
+		t.Errorf("GetSecret() = %q, %v; want xoxb-2", got, err)
+	}
+	if _, err := reopened.Get(EnvGitHubToken); !errors.Is(err, ErrSecretNotFound) {
+		t.Errorf("Get() of a deleted key error = %v, want %v", err, ErrSecretNotFound)
+	}
+	if keys, _ := reopened.List(); !reflect.DeepEqual(keys, []string{EnvSlackAPIToken}) {
+		t.Errorf("List() = %v, want [%s]", keys, EnvSlackAPIToken)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("secrets file mode = %v, %v; want 0600", info.Mode().Perm(), err)
+	}
+	content, _ := os.ReadFile(path)
+	if strings.Contains(string(content), "xoxb") || strings.Contains(string(content), EnvSlackAPIToken) {
+		t.Errorf("secrets file is not encrypted: %s", content)
+	}
+}
+
+func TestEncryptedSecretStore_WrongKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secrets.enc")
+	if err := newTestSecretStore(t, path, "correct horse").Set("KEY", "value"); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+
+	if _, err := newTestSecretStore(t, path, "battery staple").Get("KEY"); !errors.Is(err, ErrWrongMasterKey) {
+		t.Errorf("Get() with the wrong key error = %v, want %v", err, ErrWrongMasterKey)
+	}
+	if _, err := NewEncryptedSecretStore(path, nil).Get("KEY"); !errors.Is(err, ErrNoMasterKey) {
+		t.Errorf("Get() without a key error = %v, want %v", err, ErrNoMasterKey)
+	}
+
+	// The header is authenticated
+	content, _ := os.ReadFile(path)
+	tampered := strings.Replace(string(content), `"iterations": 1000`, `"iterations": 1001`, 1)
+	os.WriteFile(path, []byte(tampered), 0600)
+	if _, err := newTestSecretStore(t, path, "correct horse").Get("KEY"); !errors.Is(err, ErrWrongMasterKey) {
+		t.Errorf("Get() of a tampered file error = %v, want %v", err, ErrWrongMasterKey)
+	}
+}
+
+func TestEncryptedSecretStore_IterationsBound(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secrets.enc")
+	if err := newTestSecretStore(t, path, "correct horse").Set("KEY", "value"); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+
+	// The work factor is checked before the slow key derivation
+	content, _ := os.ReadFile(path)
+	tampered := strings.Replace(string(content), `"iterations": 1000`, `"iterations": 2000000000`, 1)
+	os.WriteFile(path, []byte(tampered), 0600)
+	if _, err := newTestSecretStore(t, path, "correct horse").Get("KEY"); err == nil || !strings.Contains(err.Error(), "iterations") {
+		t.Errorf("Get() of a file with too many iterations error = %v, want the iterations rejected", err)
+	}
+}
+
+func TestEncryptedSecretStore_CachesCurrentKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secrets.enc")
+	store := newTestSecretStore(t, path, "correct horse")
+	for _, key := range []string{"A", "B", "C"} {
+		if err := store.Set(key, "value"); err != nil {
+			t.Fatalf("Set() error = %v", err)
+		}
+	}
+
+	content, _ := os.ReadFile(path)
+	var file secretStoreFile
+	if err := json.Unmarshal(content, &file); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(store.key.salt, file.Salt) {
+		t.Errorf("cached key salt = %x, want the salt of the file %x", store.key.salt, file.Salt)
+	}
+}
+
+func TestEncryptedSecretStore_Rotate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secrets.enc")
+	store := newTestSecretStore(t, path, "old key")
+	store.Set("KEY", "value")
+
+	if err := store.Rotate([]byte("new key")); err != nil {
+		t.Fatalf("Rotate() error = %v", err)
+	}
+	if _, err := newTestSecretStore(t, path, "old key").Get("KEY"); !errors.Is(err, ErrWrongMasterKey) {
+		t.Errorf("Get() with the old key error = %v, want %v", err, ErrWrongMasterKey)
+	}
+	if got, err := newTestSecretStore(t, path, "new key").Get("KEY"); got != "value" || err != nil {
+		t.Errorf("Get() with the new key = %q, %v; want value", got, err)
+	}
+}
+
+func TestDefaultSecretProvider_EncryptedStore(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "secrets.enc")
+	keyFile := filepath.Join(dir, "master.key")
+	os.WriteFile(keyFile, []byte("key file content\n"), 0600)
+	store := newTestSecretStore(t, path, "key file content")
+	store.Set(EnvTwilioAuthToken, "twilio-from-store")
+
+	t.Setenv(EnvSecretsFile, path)
+	t.Setenv(EnvMasterKeyFile, keyFile)
+	provider := newDefaultSecretProvider()
+	if got, err := provider.GetSecret(context.Background(), EnvTwilioAuthToken); got != "twilio-from-store" || err != nil {
+		t.Errorf("GetSecret() = %q, %v; want the stored secret", got, err)
+	}
+
+	// Environment variables take precedence
+	t.Setenv(EnvTwilioAuthToken, "twilio-from-env")
+	cm := NewCredentialManagerWithResolver(BindSecretProvider(context.Background(), provider))
+	if got, _ := cm.ResolveCredential(nil, EnvTwilioAuthToken); got != "twilio-from-env" {
+		t.Errorf("ResolveCredential() = %q, want the environment value", got)
+	}
+}
+
+func TestDefaultSecretProvider_SharesStore(t *testing.T) {
+	defaultSecretProviderOnce = sync.Once{}
+	t.Cleanup(func() { defaultSecretProviderOnce = sync.Once{} })
+	t.Setenv(EnvSecretsFile, filepath.Join(t.TempDir(), "secrets.enc"))
+	t.Setenv(EnvMasterPassphrase, "passphrase")
+
+	first, second := DefaultSecretProvider().(SecretProviderChain), DefaultSecretProvider().(SecretProviderChain)
+	if len(first) != 3 || first[2] != second[2] {
+		t.Errorf("DefaultSecretProvider() = %v and %v, want the same encrypted store", first, second)
+	}
+}
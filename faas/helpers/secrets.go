@@ -0,0 +1,237 @@
+package helpers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// FileEnvSuffix marks environment variables that hold the path of a file
+	// with the secret, e.g. SLACK_API_TOKEN_FILE for mounted secrets
+	FileEnvSuffix = "_FILE"
+
+	// DefaultVaultMount is the mount of the KV v2 secrets engine
+	DefaultVaultMount = "secret"
+
+	// vaultTimeout bounds a single Vault request
+	vaultTimeout = 10 * time.Second
+)
+
+var (
+	ErrSecretNotFound = errors.New("secret not found")
+)
+
+type (
+	// SecretProvider looks up secrets by key, such as SLACK_API_TOKEN. It
+	// returns ErrSecretNotFound for keys it does not know.
+	SecretProvider interface {
+		GetSecret(ctx context.Context, key string) (string, error)
+	}
+
+	// SecretProviderChain asks its providers in order and returns the first
+	// secret found. Errors other than ErrSecretNotFound stop the lookup.
+	SecretProviderChain []SecretProvider
+
+	// EnvSecretProvider reads secrets from environment variables
+	EnvSecretProvider struct{}
+
+	// EnvFileSecretProvider reads secrets from the file named by the
+	// environment variable of the key with FileEnvSuffix, as used for
+	// Docker and Kubernetes mounted secrets
+	EnvFileSecretProvider struct{}
+
+	// FileSecretProvider reads secrets from the files of a directory, such
+	// as /run/secrets. A key is read from the file of the same name, or of
+	// its lower case name.
+	FileSecretProvider struct {
+		Dir string
+	}
+
+	// VaultSecretProvider reads secrets from a single secret of a Vault
+	// compatible KV v2 engine; each key is a field of that secret
+	VaultSecretProvider struct {
+		// Address is the base URL of the server, e.g. https://vault:8200
+		Address string
+		Token   string
+		// Mount of the KV v2 engine, DefaultVaultMount if empty
+		Mount string
+		// Path of the secret under the mount, e.g. faas/prod
+		Path   string
+		Client *http.Client
+	}
+
+	// BoundCredentialResolver resolves credentials through a SecretProvider
+	// with the context of an invocation. It remembers the values it
+	// resolved so that they can be redacted.
+	BoundCredentialResolver struct {
+		ctx      context.Context
+		provider SecretProvider
+
+		mu       sync.Mutex
+		resolved []string
+	}
+)
+
+var (
+	defaultSecretProvider     SecretProvider
+	defaultSecretProviderOnce sync.Once
+)
+
+// DefaultSecretProvider reads environment variables, then the files named
+// by their FileEnvSuffix variables, then the encrypted store named by
+// EnvSecretsFile if it is set. It is built on the first call, so that every
+// caller shares the key cache of the encrypted store; EnvSecretsFile and the
+// master key variables must be set before.
+func DefaultSecretProvider() SecretProvider {
+	defaultSecretProviderOnce.Do(func() {
+		defaultSecretProvider = newDefaultSecretProvider()
+	})
+	return defaultSecretProvider
+}
+
+func newDefaultSecretProvider() SecretProvider {
+	chain := SecretProviderChain{EnvSecretProvider{}, EnvFileSecretProvider{}}
+	if store, configured := envSecretStore(); configured {
+		chain = append(chain, store)
+	}
+	return chain
+}
+
+func (chain SecretProviderChain) GetSecret(ctx context.Context, key string) (value string, err error) {
+	for _, provider := range chain {
+		if value, err = provider.GetSecret(ctx, key); !errors.Is(err, ErrSecretNotFound) {
+			return
+		}
+	}
+	return "", fmt.Errorf("%s: %w", key, ErrSecretNotFound)
+}
+
+func (provider EnvSecretProvider) GetSecret(ctx context.Context, key string) (string, error) {
+	if value := os.Getenv(key); value != "" {
+		return value, nil
+	}
+	return "", fmt.Errorf("%s: %w", key, ErrSecretNotFound)
+}
+
+func (provider EnvFileSecretProvider) GetSecret(ctx context.Context, key string) (string, error) {
+	path := os.Getenv(key + FileEnvSuffix)
+	if path == "" {
+		return "", fmt.Errorf("%s: %w", key, ErrSecretNotFound)
+	}
+	return readSecretFile(path)
+}
+
+func (provider FileSecretProvider) GetSecret(ctx context.Context, key string) (value string, err error) {
+	if key == "" || strings.ContainsAny(key, `/\`) || key == "." || key == ".." {
+		return "", fmt.Errorf("invalid secret key %q", key)
+	}
+	for _, name := range []string{key, strings.ToLower(key)} {
+		if value, err = readSecretFile(filepath.Join(provider.Dir, name)); !errors.Is(err, os.ErrNotExist) {
+			return
+		}
+	}
+	return "", fmt.Errorf("%s: %w", key, ErrSecretNotFound)
+}
+
+// readSecretFile reads a secret without the trailing newline most tools
+// write
+func readSecretFile(path string) (string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(content), "\r\n"), nil
+}
+
+func (provider VaultSecretProvider) GetSecret(ctx context.Context, key string) (value string, err error) {
+	var (
+		req  *http.Request
+		resp *http.Response
+		body struct {
+			Data struct {
+				Data map[string]interface{} `json:"data"`
+			} `json:"data"`
+		}
+	)
+
+	mount := provider.Mount
+	if mount == "" {
+		mount = DefaultVaultMount
+	}
+	client := provider.Client
+	if client == nil {
+		client = &http.Client{Timeout: vaultTimeout}
+	}
+
+	endpoint := strings.TrimRight(provider.Address, "/") + "/v1/" + url.PathEscape(mount) + "/data/" + strings.TrimLeft(provider.Path, "/")
+	if req, err = http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil); err != nil {
+		return
+	}
+	req.Header.Set("X-Vault-Token", provider.Token)
+	if resp, err = client.Do(req); err != nil {
+		err = fmt.Errorf("vault: %w", err)
+		return
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return "", fmt.Errorf("%s: %w", key, ErrSecretNotFound)
+	case resp.StatusCode != http.StatusOK:
+		// Vault error bodies never contain secret data
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<10))
+		return "", fmt.Errorf("vault: %s: %s", resp.Status, strings.TrimSpace(string(message)))
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		err = fmt.Errorf("vault: decoding secret: %w", err)
+		return
+	}
+
+	raw, exists := body.Data.Data[key]
+	if !exists {
+		return "", fmt.Errorf("%s: %w", key, ErrSecretNotFound)
+	}
+	if value, exists = raw.(string); !exists {
+		return "", fmt.Errorf("vault: field %s of %s is not a string", key, provider.Path)
+	}
+	return
+}
+
+// BindSecretProvider returns a resolver that looks up credentials through
+// provider with ctx
+func BindSecretProvider(ctx context.Context, provider SecretProvider) *BoundCredentialResolver {
+	return &BoundCredentialResolver{ctx: ctx, provider: provider}
+}
+
+// ResolveCredential implements intf.CredentialResolver
+func (resolver *BoundCredentialResolver) ResolveCredential(key string) (value string, err error) {
+	if value, err = resolver.provider.GetSecret(resolver.ctx, key); err != nil {
+		if errors.Is(err, ErrSecretNotFound) {
+			err = nil
+		}
+		return
+	}
+
+	resolver.mu.Lock()
+	defer resolver.mu.Unlock()
+	resolver.resolved = append(resolver.resolved, value)
+	return
+}
+
+// Resolved returns the values resolved so far
+func (resolver *BoundCredentialResolver) Resolved() []string {
+	resolver.mu.Lock()
+	defer resolver.mu.Unlock()
+
+	return append([]string(nil), resolver.resolved...)
+}
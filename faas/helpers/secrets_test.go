@@ -0,0 +1,160 @@
+package helpers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// mapSecretProvider serves secrets from a map
+type mapSecretProvider map[string]string
+
+func (provider mapSecretProvider) GetSecret(ctx context.Context, key string) (string, error) {
+	if value, exists := provider[key]; exists {
+		return value, nil
+	}
+	return "", ErrSecretNotFound
+}
+
+// failingSecretProvider fails every lookup
+type failingSecretProvider struct{ err error }
+
+func (provider failingSecretProvider) GetSecret(ctx context.Context, key string) (string, error) {
+	return "", provider.err
+}
+
+func TestEnvSecretProviders(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "token")
+	if err := os.WriteFile(path, []byte("file-token\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("TEST_ENV_SECRET", "env-token")
+	t.Setenv("TEST_FILE_SECRET"+FileEnvSuffix, path)
+	t.Setenv("TEST_MISSING_SECRET"+FileEnvSuffix, filepath.Join(dir, "missing"))
+	provider := newDefaultSecretProvider()
+
+	tests := []struct {
+		key     string
+		want    string
+		wantErr error
+	}{
+		{key: "TEST_ENV_SECRET", want: "env-token"},
+		{key: "TEST_FILE_SECRET", want: "file-token"},
+		{key: "TEST_UNSET_SECRET", wantErr: ErrSecretNotFound},
+		{key: "TEST_MISSING_SECRET", wantErr: os.ErrNotExist},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			got, err := provider.GetSecret(context.Background(), tt.key)
+			if got != tt.want || !errors.Is(err, tt.wantErr) {
+				t.Errorf("GetSecret() = %q, %v; want %q, %v", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestFileSecretProvider(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "slack_api_token"), []byte("xoxb-mounted"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	provider := FileSecretProvider{Dir: dir}
+
+	if got, err := provider.GetSecret(context.Background(), EnvSlackAPIToken); got != "xoxb-mounted" || err != nil {
+		t.Errorf("GetSecret(%s) = %q, %v; want the mounted secret", EnvSlackAPIToken, got, err)
+	}
+	if _, err := provider.GetSecret(context.Background(), EnvGitHubToken); !errors.Is(err, ErrSecretNotFound) {
+		t.Errorf("GetSecret(%s) error = %v, want %v", EnvGitHubToken, err, ErrSecretNotFound)
+	}
+	if _, err := provider.GetSecret(context.Background(), "../etc/passwd"); err == nil || errors.Is(err, ErrSecretNotFound) {
+		t.Errorf("GetSecret() of a path error = %v, want an invalid key error", err)
+	}
+}
+
+func TestVaultSecretProvider(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Header.Get("X-Vault-Token") != "root":
+			http.Error(w, `{"errors":["permission denied"]}`, http.StatusForbidden)
+		case r.URL.Path == "/v1/kv/data/faas/prod":
+			w.Write([]byte(`{"data":{"data":{"SLACK_API_TOKEN":"xoxb-vault","RETRIES":3},"metadata":{"version":2}}}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	provider := VaultSecretProvider{Address: server.URL + "/", Token: "root", Mount: "kv", Path: "faas/prod"}
+
+	tests := []struct {
+		name     string
+		provider VaultSecretProvider
+		key      string
+		want     string
+		wantErr  error
+	}{
+		{name: "field", provider: provider, key: EnvSlackAPIToken, want: "xoxb-vault"},
+		{name: "missing field", provider: provider, key: EnvGitHubToken, wantErr: ErrSecretNotFound},
+		{name: "missing secret", provider: VaultSecretProvider{Address: server.URL, Token: "root", Path: "other"}, key: EnvSlackAPIToken, wantErr: ErrSecretNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.provider.GetSecret(context.Background(), tt.key)
+			if got != tt.want || !errors.Is(err, tt.wantErr) {
+				t.Errorf("GetSecret() = %q, %v; want %q, %v", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+
+	for name, failing := range map[string]VaultSecretProvider{
+		"denied":     {Address: server.URL, Token: "wrong", Mount: "kv", Path: "faas/prod"},
+		"not string": provider,
+	} {
+		key := EnvSlackAPIToken
+		if name == "not string" {
+			key = "RETRIES"
+		}
+		if _, err := failing.GetSecret(context.Background(), key); err == nil || errors.Is(err, ErrSecretNotFound) {
+			t.Errorf("%s: GetSecret() error = %v, want a failure", name, err)
+		}
+	}
+}
+
+func TestSecretProviderChain(t *testing.T) {
+	outage := errors.New("vault unreachable")
+	chain := SecretProviderChain{
+		mapSecretProvider{"A": "from-first"},
+		mapSecretProvider{"A": "shadowed", "B": "from-second"},
+		failingSecretProvider{err: outage},
+	}
+
+	for key, want := range map[string]string{"A": "from-first", "B": "from-second"} {
+		if got, err := chain.GetSecret(context.Background(), key); got != want || err != nil {
+			t.Errorf("GetSecret(%s) = %q, %v; want %q", key, got, err, want)
+		}
+	}
+	if _, err := chain.GetSecret(context.Background(), "C"); !errors.Is(err, outage) {
+		t.Errorf("GetSecret(C) error = %v, want %v", err, outage)
+	}
+	if _, err := (SecretProviderChain{}).GetSecret(context.Background(), "C"); !errors.Is(err, ErrSecretNotFound) {
+		t.Errorf("empty chain error = %v, want %v", err, ErrSecretNotFound)
+	}
+}
+
+func TestBindSecretProvider(t *testing.T) {
+	resolver := BindSecretProvider(context.Background(), mapSecretProvider{"A": "secret-a"})
+
+	if got, err := resolver.ResolveCredential("A"); got != "secret-a" || err != nil {
+		t.Errorf("ResolveCredential(A) = %q, %v", got, err)
+	}
+	if got, err := resolver.ResolveCredential("B"); got != "" || err != nil {
+		t.Errorf("ResolveCredential(B) = %q, %v; want an empty value without error", got, err)
+	}
+	if got := resolver.Resolved(); len(got) != 1 || got[0] != "secret-a" {
+		t.Errorf("Resolved() = %v, want [secret-a]", got)
+	}
+}
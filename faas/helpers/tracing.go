@@ -0,0 +1,49 @@
+package helpers
+
+import (
+	"context"
+	"errors"
+
+	"github.com/gsarmaonline/faas/faas/intf"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// TracerName is the instrumentation scope of all faas spans
+	TracerName = "github.com/gsarmaonline/faas"
+
+	// Span attributes
+	FunctionAttribute   = attribute.Key("faas.function")
+	StageAttribute      = attribute.Key("faas.stage")
+	AttemptsAttribute   = attribute.Key("faas.attempts")
+	ProviderAttribute   = attribute.Key("faas.provider")
+	StatusCodeAttribute = attribute.Key("faas.provider.status_code")
+)
+
+// StartSpan starts a child span of the span in ctx with the tracer provider
+// of that span. Without a span in ctx the returned span records nothing.
+func StartSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	tracer := trace.SpanFromContext(ctx).TracerProvider().Tracer(TracerName)
+	return tracer.Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// StartProviderSpan starts the span of a call to an external provider
+func StartProviderSpan(ctx context.Context, provider, operation string) (context.Context, trace.Span) {
+	return StartSpan(ctx, provider+"."+operation, ProviderAttribute.String(provider))
+}
+
+// EndSpan records err, if any, on span and ends it. Secrets known to the
+// Redactor of ctx are masked in the recorded error.
+func EndSpan(ctx context.Context, span trace.Span, err error) {
+	if err = RedactorFromContext(ctx).Error(err); err != nil {
+		var providerErr *intf.ProviderError
+		if errors.As(err, &providerErr) && providerErr.StatusCode != 0 {
+			span.SetAttributes(StatusCodeAttribute.Int(providerErr.StatusCode))
+		}
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
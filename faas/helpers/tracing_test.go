@@ -0,0 +1,45 @@
+package helpers
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/gsarmaonline/faas/faas/intf"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestStartSpan_WithoutParent(t *testing.T) {
+	_, span := StartSpan(context.Background(), "orphan")
+	if span.IsRecording() {
+		t.Error("span without a parent is recording")
+	}
+	EndSpan(context.Background(), span, nil)
+}
+
+func TestEndSpan(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	ctx, parent := provider.Tracer("test").Start(context.Background(), "parent")
+
+	_, span := StartProviderSpan(ctx, "slack", "post_message")
+	EndSpan(context.Background(), span, intf.NewProviderError("slack", 503, errors.New("unavailable")))
+	parent.End()
+
+	got := exporter.GetSpans()[0]
+	if got.Name != "slack.post_message" || got.Parent.SpanID() != parent.SpanContext().SpanID() {
+		t.Fatalf("span = %s with parent %s, want slack.post_message under parent", got.Name, got.Parent.SpanID())
+	}
+	if got.Status.Code != codes.Error {
+		t.Errorf("status = %v, want %v", got.Status.Code, codes.Error)
+	}
+	attrs := make(map[string]string)
+	for _, attr := range got.Attributes {
+		attrs[string(attr.Key)] = attr.Value.Emit()
+	}
+	if attrs[string(ProviderAttribute)] != "slack" || attrs[string(StatusCodeAttribute)] != "503" {
+		t.Errorf("attributes = %v, want provider slack and status code 503", attrs)
+	}
+}
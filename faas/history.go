@@ -0,0 +1,288 @@
+package faas
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gsarmaonline/faas/faas/helpers"
+	"github.com/gsarmaonline/faas/faas/intf"
+)
+
+const (
+	// DefaultMaxHistoryRecords is how many records the default history store
+	// keeps before it drops the oldest ones
+	DefaultMaxHistoryRecords = 10000
+
+	// maxHistoryLineSize bounds a single record of a FileHistoryStore
+	maxHistoryLineSize = 64 * 1024 * 1024
+)
+
+var (
+	ErrHistoryRecordNotFound = errors.New("history record not found")
+)
+
+type (
+	callerKeyT struct{}
+
+	// HistoryRecord is the audit record of a finished invocation. Credential
+	// fields of the payload are redacted.
+	HistoryRecord struct {
+		ID           string            `json:"id"`
+		FunctionName string            `json:"function_name"`
+		Caller       string            `json:"caller,omitempty"`
+		Payload      intf.Payload      `json:"payload"`
+		Output       intf.Payload      `json:"output,omitempty"`
+		Status       InvocationStatusT `json:"status"`
+		Error        string            `json:"error,omitempty"`
+		StartedAt    time.Time         `json:"started_at"`
+		FinishedAt   time.Time         `json:"finished_at"`
+		Duration     time.Duration     `json:"duration"`
+		// ReplayOf is the ID of the record this invocation replayed
+		ReplayOf string `json:"replay_of,omitempty"`
+	}
+
+	// HistoryQuery filters history records. Zero fields match everything.
+	// Since is inclusive and Until exclusive, both compared to StartedAt.
+	// Limit keeps the most recent matching records.
+	HistoryQuery struct {
+		FunctionName string
+		Status       InvocationStatusT
+		Since        time.Time
+		Until        time.Time
+		Limit        int
+	}
+
+	// HistoryStore records finished invocations. Query returns matching
+	// records oldest first.
+	HistoryStore interface {
+		Record(record HistoryRecord) error
+		Get(id string) (HistoryRecord, error)
+		Query(query HistoryQuery) ([]HistoryRecord, error)
+	}
+
+	// MemoryHistoryStore is a HistoryStore that keeps up to maxSize records
+	// in memory
+	MemoryHistoryStore struct {
+		mu      sync.Mutex
+		maxSize int
+		// records is a ring buffer once it holds maxSize records; oldest is
+		// the index of the oldest record
+		records []HistoryRecord
+		oldest  int
+	}
+
+	// FileHistoryStore is an append-only HistoryStore that writes one JSON
+	// record per line
+	FileHistoryStore struct {
+		mu   sync.Mutex
+		path string
+		file *os.File
+	}
+)
+
+// WithCaller returns a context that attributes invocations made with it to
+// caller in the invocation history
+func WithCaller(ctx context.Context, caller string) context.Context {
+	return context.WithValue(ctx, callerKeyT{}, caller)
+}
+
+// CallerFromContext returns the caller set by WithCaller
+func CallerFromContext(ctx context.Context) string {
+	caller, _ := ctx.Value(callerKeyT{}).(string)
+	return caller
+}
+
+// Matches reports whether record passes the filters of query
+func (query HistoryQuery) Matches(record HistoryRecord) bool {
+	if query.FunctionName != "" && record.FunctionName != query.FunctionName {
+		return false
+	}
+	if query.Status != "" && record.Status != query.Status {
+		return false
+	}
+	if !query.Since.IsZero() && record.StartedAt.Before(query.Since) {
+		return false
+	}
+	if !query.Until.IsZero() && !record.StartedAt.Before(query.Until) {
+		return false
+	}
+	return true
+}
+
+func (query HistoryQuery) limit(records []HistoryRecord) []HistoryRecord {
+	if query.Limit > 0 && len(records) > query.Limit {
+		return records[len(records)-query.Limit:]
+	}
+	return records
+}
+
+func NewMemoryHistoryStore(maxSize int) *MemoryHistoryStore {
+	return &MemoryHistoryStore{maxSize: maxSize}
+}
+
+func (store *MemoryHistoryStore) Record(record HistoryRecord) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if store.maxSize <= 0 || len(store.records) < store.maxSize {
+		store.records = append(store.records, record)
+		return nil
+	}
+	// Overwrite the oldest record
+	store.records[store.oldest] = record
+	store.oldest = (store.oldest + 1) % len(store.records)
+	return nil
+}
+
+func (store *MemoryHistoryStore) Get(id string) (HistoryRecord, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	for _, record := range store.records {
+		if record.ID == id {
+			return record, nil
+		}
+	}
+	return HistoryRecord{}, ErrHistoryRecordNotFound
+}
+
+func (store *MemoryHistoryStore) Query(query HistoryQuery) (records []HistoryRecord, err error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	for idx := range store.records {
+		record := store.records[(store.oldest+idx)%len(store.records)]
+		if query.Matches(record) {
+			records = append(records, record)
+		}
+	}
+	records = query.limit(records)
+	return
+}
+
+// NewFileHistoryStore opens the history file at path, creating it if needed.
+// Records are appended to existing history.
+func NewFileHistoryStore(path string) (store *FileHistoryStore, err error) {
+	var file *os.File
+	if file, err = os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600); err != nil {
+		return
+	}
+	store = &FileHistoryStore{path: path, file: file}
+	return
+}
+
+func (store *FileHistoryStore) Record(record HistoryRecord) (err error) {
+	var line []byte
+	if line, err = json.Marshal(record); err != nil {
+		return
+	}
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	_, err = store.file.Write(append(line, '\n'))
+	return
+}
+
+// Get scans the whole file for the record with the given ID
+func (store *FileHistoryStore) Get(id string) (record HistoryRecord, err error) {
+	found := false
+	if err = store.scan(func(candidate HistoryRecord) {
+		if candidate.ID == id {
+			record, found = candidate, true
+		}
+	}); err != nil {
+		return
+	}
+	if !found {
+		err = ErrHistoryRecordNotFound
+	}
+	return
+}
+
+// Query scans the whole file for matching records
+func (store *FileHistoryStore) Query(query HistoryQuery) (records []HistoryRecord, err error) {
+	if err = store.scan(func(record HistoryRecord) {
+		if query.Matches(record) {
+			records = append(records, record)
+		}
+	}); err != nil {
+		return
+	}
+	records = query.limit(records)
+	return
+}
+
+// scan calls visit for every record of the file, oldest first. Lines that
+// cannot be decoded, such as a record torn by a crash, are skipped.
+func (store *FileHistoryStore) scan(visit func(record HistoryRecord)) (err error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	var file *os.File
+	if file, err = os.Open(store.path); err != nil {
+		return
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxHistoryLineSize)
+	for scanner.Scan() {
+		var record HistoryRecord
+		if json.Unmarshal(scanner.Bytes(), &record) != nil {
+			continue
+		}
+		visit(record)
+	}
+	return scanner.Err()
+}
+
+// Close closes the history file
+func (store *FileHistoryStore) Close() error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	return store.file.Close()
+}
+
+// QueryHistory returns the recorded invocations that match query, oldest
+// first
+func (faas *Faas) QueryHistory(query HistoryQuery) ([]HistoryRecord, error) {
+	return faas.history.Query(query)
+}
+
+// recordHistory records a finished invocation with its credential fields
+// redacted. replayOf is the ID of the record the invocation replayed, if any.
+func (faas *Faas) recordHistory(ctx context.Context, id, replayOf string, request InvocationRequest, output intf.FunctionOutput, err error, startedAt time.Time) {
+	finishedAt := time.Now()
+	redactor := helpers.RedactorFromContext(ctx)
+	record := HistoryRecord{
+		ID:           id,
+		FunctionName: request.FunctionName,
+		Caller:       CallerFromContext(ctx),
+		ReplayOf:     replayOf,
+		Payload:      redactor.Payload(request.Config.InputSchema, request.Payload),
+		Status:       SucceededInvocationStatus,
+		StartedAt:    startedAt,
+		FinishedAt:   finishedAt,
+		Duration:     finishedAt.Sub(startedAt),
+	}
+	if err == nil && output != nil {
+		if record.Output, err = output.GetPayload(); err == nil {
+			record.Output = redactor.Payload(request.Config.OutputSchema, record.Output)
+		}
+	}
+	if err != nil {
+		record.Status = FailedInvocationStatus
+		record.Error = redactor.String(err.Error())
+	}
+
+	if storeErr := faas.history.Record(record); storeErr != nil {
+		faas.logger.Error("Failed to record history", FunctionLogKey, request.FunctionName, InvocationIDLogKey, id, "error", storeErr)
+	}
+}
@@ -0,0 +1,189 @@
+package faas
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gsarmaonline/faas/faas/helpers"
+	"github.com/gsarmaonline/faas/faas/intf"
+)
+
+// CredentialFunction echoes its payload, declares api_key a credential
+// and requires a message
+type CredentialFunction struct {
+	EchoFunction
+}
+
+func (c *CredentialFunction) GetConfig() intf.FunctionConfig {
+	return intf.FunctionConfig{
+		Name: "credential",
+		InputSchema: &intf.Schema{
+			Type: intf.ObjectSchemaType,
+			Properties: map[string]*intf.Schema{
+				"api_key": {Type: intf.StringSchemaType, WriteOnly: true},
+				"message": {Type: intf.StringSchemaType},
+			},
+			Required: []string{"message"},
+		},
+	}
+}
+
+func newCredentialFunction() *CredentialFunction {
+	return &CredentialFunction{}
+}
+
+func historyRecords() []HistoryRecord {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	return []HistoryRecord{
+		{ID: "1", FunctionName: "slack", Status: SucceededInvocationStatus, StartedAt: start},
+		{ID: "2", FunctionName: "sms", Status: FailedInvocationStatus, StartedAt: start.Add(time.Hour)},
+		{ID: "3", FunctionName: "slack", Status: FailedInvocationStatus, StartedAt: start.Add(2 * time.Hour)},
+		{ID: "4", FunctionName: "slack", Status: SucceededInvocationStatus, StartedAt: start.Add(3 * time.Hour)},
+	}
+}
+
+func testHistoryStore(t *testing.T, store HistoryStore) {
+	for _, record := range historyRecords() {
+		if err := store.Record(record); err != nil {
+			t.Fatalf("Record() error = %v", err)
+		}
+	}
+
+	if record, err := store.Get("3"); err != nil || record.FunctionName != "slack" {
+		t.Errorf("Get() = %+v, %v; want record 3", record, err)
+	}
+	if _, err := store.Get("missing"); !errors.Is(err, ErrHistoryRecordNotFound) {
+		t.Errorf("Get() of unknown record error = %v, want %v", err, ErrHistoryRecordNotFound)
+	}
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name  string
+		query HistoryQuery
+		want  []string
+	}{
+		{name: "everything", query: HistoryQuery{}, want: []string{"1", "2", "3", "4"}},
+		{name: "by function", query: HistoryQuery{FunctionName: "slack"}, want: []string{"1", "3", "4"}},
+		{name: "by status", query: HistoryQuery{Status: FailedInvocationStatus}, want: []string{"2", "3"}},
+		{
+			name:  "by time range",
+			query: HistoryQuery{Since: start.Add(time.Hour), Until: start.Add(3 * time.Hour)},
+			want:  []string{"2", "3"},
+		},
+		{name: "most recent", query: HistoryQuery{FunctionName: "slack", Limit: 2}, want: []string{"3", "4"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			records, err := store.Query(tt.query)
+			if err != nil {
+				t.Fatalf("Query() error = %v", err)
+			}
+			var ids []string
+			for _, record := range records {
+				ids = append(ids, record.ID)
+			}
+			if !reflect.DeepEqual(ids, tt.want) {
+				t.Errorf("Query() = %v, want %v", ids, tt.want)
+			}
+		})
+	}
+}
+
+func TestMemoryHistoryStore(t *testing.T) {
+	testHistoryStore(t, NewMemoryHistoryStore(0))
+
+	store := NewMemoryHistoryStore(2)
+	for _, record := range historyRecords() {
+		store.Record(record)
+	}
+	if records, _ := store.Query(HistoryQuery{}); len(records) != 2 || records[0].ID != "3" {
+		t.Errorf("Query() = %+v, want the two newest records", records)
+	}
+
+	// The oldest record is overwritten in place, and queries stay in order
+	for _, id := range []string{"a", "b", "c"} {
+		store.Record(HistoryRecord{ID: id})
+	}
+	records, _ := store.Query(HistoryQuery{})
+	if len(records) != 2 || records[0].ID != "b" || records[1].ID != "c" {
+		t.Errorf("Query() = %+v, want b and c", records)
+	}
+	if _, err := store.Get("a"); !errors.Is(err, ErrHistoryRecordNotFound) {
+		t.Errorf("Get() of an overwritten record error = %v, want %v", err, ErrHistoryRecordNotFound)
+	}
+	if cap(store.records) != 2 {
+		t.Errorf("records capacity = %d, want 2", cap(store.records))
+	}
+}
+
+func TestFileHistoryStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	store, err := NewFileHistoryStore(path)
+	if err != nil {
+		t.Fatalf("NewFileHistoryStore() error = %v", err)
+	}
+	testHistoryStore(t, store)
+	store.Close()
+
+	// A torn record is skipped and reopening appends to the history
+	file, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0600)
+	file.WriteString(`{"id":"torn`)
+	file.Close()
+
+	if store, err = NewFileHistoryStore(path); err != nil {
+		t.Fatalf("NewFileHistoryStore() error = %v", err)
+	}
+	defer store.Close()
+	if records, err := store.Query(HistoryQuery{}); err != nil || len(records) != 4 {
+		t.Errorf("Query() after reopen = %d records, %v; want 4", len(records), err)
+	}
+}
+
+func TestFaas_History(t *testing.T) {
+	faas := newFaas(context.Background())
+	if err := faas.RegisterFunctions([]intf.FunctionFactory{intf.FactoryOf(newCredentialFunction)}); err != nil {
+		t.Fatalf("RegisterFunctions() error = %v", err)
+	}
+	if err := faas.RegisterFunctions(mockFactories(&MockFunction{name: "failing", executeErr: true})); err != nil {
+		t.Fatalf("RegisterFunctions() error = %v", err)
+	}
+
+	ctx := WithCaller(context.Background(), "billing-service")
+	payload := intf.Payload{"api_key": "secret", "message": "hello"}
+	if _, err := faas.InvokeFunction(ctx, "credential", payload); err != nil {
+		t.Fatalf("InvokeFunction() error = %v", err)
+	}
+	faas.InvokeFunction(context.Background(), "failing", intf.Payload{})
+
+	records, err := faas.QueryHistory(HistoryQuery{FunctionName: "credential"})
+	if err != nil || len(records) != 1 {
+		t.Fatalf("QueryHistory() = %+v, %v; want one record", records, err)
+	}
+	record := records[0]
+	if record.Caller != "billing-service" || record.Status != SucceededInvocationStatus {
+		t.Errorf("record = %+v, want a succeeded invocation by billing-service", record)
+	}
+	if record.Payload["api_key"] != helpers.RedactedValue || record.Payload["message"] != "hello" {
+		t.Errorf("record payload = %v, want api_key redacted", record.Payload)
+	}
+	if record.Output["api_key"] != helpers.RedactedValue || record.Output["message"] != "hello" {
+		t.Errorf("record output = %v, want the echoed payload with api_key redacted", record.Output)
+	}
+	if payload["api_key"] != "secret" {
+		t.Error("recording history modified the invocation payload")
+	}
+	if record.FinishedAt.Before(record.StartedAt) || record.Duration != record.FinishedAt.Sub(record.StartedAt) {
+		t.Errorf("record timing = %v..%v (%v)", record.StartedAt, record.FinishedAt, record.Duration)
+	}
+
+	failed, _ := faas.QueryHistory(HistoryQuery{Status: FailedInvocationStatus})
+	if len(failed) != 1 || failed[0].FunctionName != "failing" || failed[0].Error == "" {
+		t.Errorf("failed records = %+v, want the failing invocation with its error", failed)
+	}
+}
@@ -0,0 +1,198 @@
+package faas
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/gsarmaonline/faas/faas/intf"
+)
+
+const (
+	// DefaultIdempotencyWindow is how long the result of an invocation with
+	// an idempotency key is returned for duplicates
+	DefaultIdempotencyWindow = 24 * time.Hour
+	// DefaultIdempotencyCapacity is how many keys are remembered at most;
+	// once it is reached, the successful invocations closest to expiry are
+	// forgotten first
+	DefaultIdempotencyCapacity = 100000
+)
+
+var (
+	ErrIdempotencyKeyReused = errors.New("idempotency key reused with a different payload")
+)
+
+type (
+	idempotencyKeyT struct{}
+
+	// idempotencyCache deduplicates invocations that carry the same
+	// idempotency key for the same function
+	idempotencyCache struct {
+		mu        sync.Mutex
+		window    time.Duration
+		capacity  int
+		calls     map[idempotencyCacheKey]*idempotentCall
+		lastSweep time.Time
+		now       func() time.Time
+	}
+
+	idempotencyCacheKey struct {
+		functionName string
+		key          string
+	}
+
+	// idempotentCall is an invocation in flight or a successful one that
+	// has not expired yet. done is closed once output and err are set.
+	idempotentCall struct {
+		// digest is the sha256 of the JSON payload, so that payloads are
+		// not kept for the whole window
+		digest [sha256.Size]byte
+		done   chan struct{}
+		output intf.FunctionOutput
+		err    error
+		// abandoned is set when the call failed because the context of its
+		// caller was done, which says nothing about the duplicates
+		abandoned bool
+		expiresAt time.Time
+	}
+)
+
+// WithIdempotencyKey returns a context that makes invocations carry key.
+// While the window of a successful invocation with the same function and key
+// lasts, InvokeFunction returns its output instead of running the function
+// again; concurrent duplicates wait for the invocation in flight and share its
+// result. Failed invocations are forgotten once they finish, so they can be
+// retried with the same key.
+func WithIdempotencyKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, idempotencyKeyT{}, key)
+}
+
+// IdempotencyKeyFromContext returns the key set by WithIdempotencyKey
+func IdempotencyKeyFromContext(ctx context.Context) string {
+	key, _ := ctx.Value(idempotencyKeyT{}).(string)
+	return key
+}
+
+func newIdempotencyCache(window time.Duration) *idempotencyCache {
+	return &idempotencyCache{
+		window:   window,
+		capacity: DefaultIdempotencyCapacity,
+		calls:    make(map[idempotencyCacheKey]*idempotentCall),
+		now:      time.Now,
+	}
+}
+
+// do runs invoke once per function and key. Duplicates share the result of
+// the call in flight or of the last successful one, and fail with
+// ErrIdempotencyKeyReused if their payload differs from it. If the call in
+// flight fails because its caller went away, a duplicate whose ctx is still
+// live runs invoke itself.
+func (cache *idempotencyCache) do(ctx context.Context, name, key string, payload intf.Payload, invoke func() (intf.FunctionOutput, error)) (output intf.FunctionOutput, err error) {
+	var encoded []byte
+	if encoded, err = json.Marshal(payload); err != nil {
+		return
+	}
+	digest := sha256.Sum256(encoded)
+	cacheKey := idempotencyCacheKey{functionName: name, key: key}
+
+	for {
+		cache.mu.Lock()
+		now := cache.now()
+		if now.Sub(cache.lastSweep) >= cache.window/2 {
+			cache.sweep(now)
+		}
+
+		call, exists := cache.calls[cacheKey]
+		if !exists || call.expired(now) {
+			if !exists {
+				cache.makeRoom(now)
+			}
+			call = &idempotentCall{digest: digest, done: make(chan struct{})}
+			cache.calls[cacheKey] = call
+			cache.mu.Unlock()
+			return cache.run(ctx, cacheKey, call, invoke)
+		}
+		cache.mu.Unlock()
+
+		if call.digest != digest {
+			err = ErrIdempotencyKeyReused
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			err = ctx.Err()
+			return
+		case <-call.done:
+		}
+		if !call.abandoned || ctx.Err() != nil {
+			return call.output, call.err
+		}
+	}
+}
+
+func (cache *idempotencyCache) run(ctx context.Context, cacheKey idempotencyCacheKey, call *idempotentCall, invoke func() (intf.FunctionOutput, error)) (intf.FunctionOutput, error) {
+	call.output, call.err = invoke()
+
+	cache.mu.Lock()
+	if call.err != nil {
+		call.abandoned = ctx.Err() != nil
+		delete(cache.calls, cacheKey)
+	} else {
+		call.expiresAt = cache.now().Add(cache.window)
+	}
+	cache.mu.Unlock()
+
+	close(call.done)
+	return call.output, call.err
+}
+
+func (cache *idempotencyCache) sweep(now time.Time) {
+	for cacheKey, call := range cache.calls {
+		if call.expired(now) {
+			delete(cache.calls, cacheKey)
+		}
+	}
+	cache.lastSweep = now
+}
+
+// makeRoom evicts expired calls and, if the cache is still full, the
+// successful call closest to expiry. Calls in flight are never evicted.
+func (cache *idempotencyCache) makeRoom(now time.Time) {
+	if cache.capacity <= 0 || len(cache.calls) < cache.capacity {
+		return
+	}
+	cache.sweep(now)
+	for len(cache.calls) >= cache.capacity {
+		var (
+			oldestKey idempotencyCacheKey
+			oldest    *idempotentCall
+		)
+		for cacheKey, call := range cache.calls {
+			if !call.expiresAt.IsZero() && (oldest == nil || call.expiresAt.Before(oldest.expiresAt)) {
+				oldestKey, oldest = cacheKey, call
+			}
+		}
+		if oldest == nil {
+			return
+		}
+		delete(cache.calls, oldestKey)
+	}
+}
+
+// withoutIdempotencyKey returns a copy of ctx without the idempotency key, so
+// that invocations made by the function are not deduplicated against the
+// invocation that runs it
+func withoutIdempotencyKey(ctx context.Context) context.Context {
+	if IdempotencyKeyFromContext(ctx) == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, idempotencyKeyT{}, "")
+}
+
+func (call *idempotentCall) expired(now time.Time) bool {
+	return !call.expiresAt.IsZero() && !now.Before(call.expiresAt)
+}
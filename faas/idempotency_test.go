@@ -0,0 +1,262 @@
+package faas
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gsarmaonline/faas/faas/intf"
+)
+
+// CountingFunction counts its executions, signals started and blocks on
+// release, if set
+type CountingFunction struct {
+	calls   *atomic.Int32
+	started chan struct{}
+	release chan struct{}
+	fail    bool
+}
+
+func (c *CountingFunction) GetConfig() intf.FunctionConfig {
+	return intf.FunctionConfig{Name: "counting"}
+}
+
+func (c *CountingFunction) ParsePayload(payload intf.Payload) error {
+	return nil
+}
+
+func (c *CountingFunction) Validate() error {
+	return nil
+}
+
+func (c *CountingFunction) Execute(ctx context.Context) (intf.FunctionOutput, error) {
+	call := c.calls.Add(1)
+	if c.started != nil {
+		c.started <- struct{}{}
+	}
+	if c.release != nil {
+		<-c.release
+	}
+	if c.fail {
+		return nil, errors.New("send failed")
+	}
+	return EchoOutput{Payload: intf.Payload{"call": call}}, nil
+}
+
+func newCountingFaas(t *testing.T, function CountingFunction, opts ...Option) (*Faas, *atomic.Int32) {
+	calls := &atomic.Int32{}
+	function.calls = calls
+	faas := newFaas(context.Background(), opts...)
+	if err := faas.RegisterFunctions([]intf.FunctionFactory{func() intf.Function {
+		instance := function
+		return &instance
+	}}); err != nil {
+		t.Fatalf("RegisterFunctions() error = %v", err)
+	}
+	return faas, calls
+}
+
+func TestFaas_IdempotencyKey(t *testing.T) {
+	faas, calls := newCountingFaas(t, CountingFunction{})
+	ctx := WithIdempotencyKey(context.Background(), "order-1")
+	payload := intf.Payload{"to": "alice"}
+
+	first, err := faas.InvokeFunction(ctx, "counting", payload)
+	if err != nil {
+		t.Fatalf("InvokeFunction() error = %v", err)
+	}
+	second, err := faas.InvokeFunction(ctx, "counting", intf.Payload{"to": "alice"})
+	if err != nil {
+		t.Fatalf("InvokeFunction() duplicate error = %v", err)
+	}
+	if calls.Load() != 1 || second.(EchoOutput).Payload["call"] != first.(EchoOutput).Payload["call"] {
+		t.Errorf("duplicate ran the function: %d calls", calls.Load())
+	}
+
+	if _, err := faas.InvokeFunction(ctx, "counting", intf.Payload{"to": "bob"}); !errors.Is(err, ErrIdempotencyKeyReused) {
+		t.Errorf("InvokeFunction() with a different payload error = %v, want %v", err, ErrIdempotencyKeyReused)
+	}
+
+	faas.InvokeFunction(WithIdempotencyKey(context.Background(), "order-2"), "counting", payload)
+	faas.InvokeFunction(context.Background(), "counting", payload)
+	if got := calls.Load(); got != 3 {
+		t.Errorf("Execute called %d times, want 3", got)
+	}
+}
+
+func TestFaas_IdempotencyKey_Window(t *testing.T) {
+	faas, calls := newCountingFaas(t, CountingFunction{}, WithIdempotencyWindow(time.Minute))
+	now := time.Now()
+	faas.idempotency.now = func() time.Time { return now }
+	ctx := WithIdempotencyKey(context.Background(), "order-1")
+
+	faas.InvokeFunction(ctx, "counting", intf.Payload{})
+	now = now.Add(30 * time.Second)
+	faas.InvokeFunction(ctx, "counting", intf.Payload{})
+	if got := calls.Load(); got != 1 {
+		t.Fatalf("Execute called %d times within the window, want 1", got)
+	}
+
+	now = now.Add(time.Minute)
+	faas.InvokeFunction(ctx, "counting", intf.Payload{})
+	if got := calls.Load(); got != 2 {
+		t.Errorf("Execute called %d times after the window, want 2", got)
+	}
+}
+
+func TestFaas_IdempotencyKey_FailuresAreRetried(t *testing.T) {
+	faas, calls := newCountingFaas(t, CountingFunction{fail: true})
+	ctx := WithIdempotencyKey(context.Background(), "order-1")
+
+	for i := 0; i < 2; i++ {
+		if _, err := faas.InvokeFunction(ctx, "counting", intf.Payload{}); err == nil {
+			t.Fatal("InvokeFunction() error = nil, want error")
+		}
+	}
+	if got := calls.Load(); got != 2 {
+		t.Errorf("Execute called %d times, want 2", got)
+	}
+}
+
+func TestFaas_IdempotencyKey_ConcurrentDuplicates(t *testing.T) {
+	started, release := make(chan struct{}, 1), make(chan struct{})
+	faas, calls := newCountingFaas(t, CountingFunction{started: started, release: release})
+	ctx := WithIdempotencyKey(context.Background(), "order-1")
+
+	var (
+		wg      sync.WaitGroup
+		outputs = make([]intf.FunctionOutput, 10)
+		errs    = make([]error, 10)
+	)
+	for idx := range outputs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			outputs[idx], errs[idx] = faas.InvokeFunction(ctx, "counting", intf.Payload{})
+		}()
+	}
+
+	<-started
+	close(release)
+	wg.Wait()
+
+	if got := calls.Load(); got != 1 {
+		t.Errorf("Execute called %d times, want 1", got)
+	}
+	for idx := range outputs {
+		if errs[idx] != nil || outputs[idx].(EchoOutput).Payload["call"] != int32(1) {
+			t.Errorf("duplicate %d = %v, %v; want the output of the first call", idx, outputs[idx], errs[idx])
+		}
+	}
+}
+
+func TestFaas_IdempotencyKey_WaiterCancelled(t *testing.T) {
+	started, release := make(chan struct{}, 1), make(chan struct{})
+	defer close(release)
+	faas, _ := newCountingFaas(t, CountingFunction{started: started, release: release})
+
+	go faas.InvokeFunction(WithIdempotencyKey(context.Background(), "order-1"), "counting", intf.Payload{})
+	<-started
+
+	ctx, cancel := context.WithTimeout(WithIdempotencyKey(context.Background(), "order-1"), 10*time.Millisecond)
+	defer cancel()
+	if _, err := faas.InvokeFunction(ctx, "counting", intf.Payload{}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("InvokeFunction() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestFaas_IdempotencyKey_NotPassedToNestedInvocations(t *testing.T) {
+	faas, calls := newCountingFaas(t, CountingFunction{})
+	if err := faas.RegisterFunctions([]intf.FunctionFactory{func() intf.Function {
+		return &NestedFunction{faas: faas, target: "counting"}
+	}}); err != nil {
+		t.Fatalf("RegisterFunctions() error = %v", err)
+	}
+	ctx := WithIdempotencyKey(context.Background(), "order-1")
+
+	if _, err := faas.InvokeFunction(ctx, "nested", intf.Payload{}); err != nil {
+		t.Fatalf("InvokeFunction() error = %v", err)
+	}
+	if _, err := faas.InvokeFunction(ctx, "counting", intf.Payload{}); err != nil {
+		t.Fatalf("InvokeFunction() error = %v", err)
+	}
+	if got := calls.Load(); got != 2 {
+		t.Errorf("Execute called %d times, want the nested invocation not to be deduplicated", got)
+	}
+}
+
+func TestIdempotencyCache_Capacity(t *testing.T) {
+	cache := newIdempotencyCache(time.Hour)
+	cache.capacity = 2
+	now := time.Now()
+	cache.now = func() time.Time { return now }
+
+	for _, key := range []string{"order-1", "order-2", "order-3"} {
+		cache.do(context.Background(), "counting", key, intf.Payload{}, func() (intf.FunctionOutput, error) {
+			return EchoOutput{}, nil
+		})
+		now = now.Add(time.Second)
+	}
+
+	if len(cache.calls) != 2 {
+		t.Errorf("cache holds %d calls, want 2", len(cache.calls))
+	}
+	if _, exists := cache.calls[idempotencyCacheKey{functionName: "counting", key: "order-1"}]; exists {
+		t.Error("the call closest to expiry was not evicted")
+	}
+}
+
+func TestIdempotencyCache_LeaderCancelled(t *testing.T) {
+	cache := newIdempotencyCache(time.Hour)
+	leaderCtx, cancel := context.WithCancel(context.Background())
+	running := make(chan struct{})
+	leaderErr := make(chan error, 1)
+	go func() {
+		_, err := cache.do(leaderCtx, "counting", "order-1", intf.Payload{}, func() (intf.FunctionOutput, error) {
+			close(running)
+			<-leaderCtx.Done()
+			return nil, leaderCtx.Err()
+		})
+		leaderErr <- err
+	}()
+	<-running
+
+	type result struct {
+		output intf.FunctionOutput
+		err    error
+	}
+	waiter := make(chan result, 1)
+	go func() {
+		output, err := cache.do(context.Background(), "counting", "order-1", intf.Payload{}, func() (intf.FunctionOutput, error) {
+			return EchoOutput{Payload: intf.Payload{"call": "waiter"}}, nil
+		})
+		waiter <- result{output, err}
+	}()
+	cancel()
+
+	if err := <-leaderErr; !errors.Is(err, context.Canceled) {
+		t.Errorf("leader error = %v, want %v", err, context.Canceled)
+	}
+	if got := <-waiter; got.err != nil || got.output.(EchoOutput).Payload["call"] != "waiter" {
+		t.Errorf("waiter = %v, %v; want its own run", got.output, got.err)
+	}
+}
+
+func TestIdempotencyCache_StoresPayloadDigest(t *testing.T) {
+	cache := newIdempotencyCache(time.Hour)
+	payload := intf.Payload{"api_key": "SG.secret"}
+	cache.do(context.Background(), "counting", "order-1", payload, func() (intf.FunctionOutput, error) {
+		return EchoOutput{}, nil
+	})
+
+	encoded, _ := json.Marshal(payload)
+	call := cache.calls[idempotencyCacheKey{functionName: "counting", key: "order-1"}]
+	if call == nil || call.digest != sha256.Sum256(encoded) {
+		t.Errorf("cached call = %+v, want the payload digest", call)
+	}
+}
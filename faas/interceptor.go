@@ -0,0 +1,49 @@
+package faas
+
+import (
+	"context"
+
+	"github.com/gsarmaonline/faas/faas/intf"
+)
+
+type (
+	// InvocationRequest describes the invocation passed down an interceptor
+	// chain. Interceptors may replace the payload before calling the next
+	// handler; the function that runs is fixed when the invocation starts.
+	InvocationRequest struct {
+		FunctionName string
+		Config       intf.FunctionConfig
+		Payload      intf.Payload
+	}
+
+	// Handler runs an invocation and returns its output
+	Handler func(ctx context.Context, request InvocationRequest) (intf.FunctionOutput, error)
+
+	// Interceptor wraps a Handler, e.g. to log, authorize or modify
+	// invocations. It sees the output and error of the handler it wraps.
+	Interceptor func(next Handler) Handler
+)
+
+// Use appends interceptors to the chain around the schema, parse, validate
+// and execute stages of every invocation. Interceptors run in the order they
+// were added: the first one is the outermost and sees the request first and
+// the output last. Invocations already running keep the chain they started
+// with.
+func (faas *Faas) Use(interceptors ...Interceptor) {
+	faas.mu.Lock()
+	defer faas.mu.Unlock()
+
+	faas.interceptors = append(faas.interceptors, interceptors...)
+}
+
+// chain wraps handler in the registered interceptors
+func (faas *Faas) chain(handler Handler) Handler {
+	faas.mu.RLock()
+	interceptors := faas.interceptors
+	faas.mu.RUnlock()
+
+	for idx := len(interceptors) - 1; idx >= 0; idx-- {
+		handler = interceptors[idx](handler)
+	}
+	return handler
+}
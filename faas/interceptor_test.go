@@ -0,0 +1,158 @@
+package faas
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/gsarmaonline/faas/faas/helpers"
+	"github.com/gsarmaonline/faas/faas/intf"
+)
+
+// recordingInterceptor appends "<label>:before" and "<label>:after" to
+// events around the next handler
+func recordingInterceptor(label string, mu *sync.Mutex, events *[]string) Interceptor {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, request InvocationRequest) (intf.FunctionOutput, error) {
+			mu.Lock()
+			*events = append(*events, label+":before")
+			mu.Unlock()
+
+			output, err := next(ctx, request)
+
+			mu.Lock()
+			*events = append(*events, label+":after")
+			mu.Unlock()
+			return output, err
+		}
+	}
+}
+
+func newEchoFaas(t *testing.T, opts ...Option) *Faas {
+	faas := newFaas(context.Background(), opts...)
+	if err := faas.RegisterFunctions([]intf.FunctionFactory{intf.FactoryOf(newEchoFunction)}); err != nil {
+		t.Fatalf("RegisterFunctions() error = %v", err)
+	}
+	return faas
+}
+
+func TestFaas_Use_Order(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		events []string
+	)
+	faas := newEchoFaas(t, WithInterceptors(recordingInterceptor("first", &mu, &events)))
+	faas.Use(recordingInterceptor("second", &mu, &events), recordingInterceptor("third", &mu, &events))
+
+	if _, err := faas.InvokeFunction(context.Background(), "echo", intf.Payload{}); err != nil {
+		t.Fatalf("InvokeFunction() error = %v", err)
+	}
+
+	want := []string{"first:before", "second:before", "third:before", "third:after", "second:after", "first:after"}
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("events = %v, want %v", events, want)
+	}
+}
+
+func TestFaas_Use_SeesRequestOutputAndError(t *testing.T) {
+	var (
+		seenRequest InvocationRequest
+		seenOutput  intf.FunctionOutput
+		seenErr     error
+	)
+	faas := newEchoFaas(t)
+	if err := faas.RegisterFunctions(mockFactories(&MockFunction{name: "failing", executeErr: true})); err != nil {
+		t.Fatalf("RegisterFunctions() error = %v", err)
+	}
+	faas.Use(func(next Handler) Handler {
+		return func(ctx context.Context, request InvocationRequest) (intf.FunctionOutput, error) {
+			seenRequest = request
+			seenOutput, seenErr = next(ctx, request)
+			return seenOutput, seenErr
+		}
+	})
+
+	payload := intf.Payload{"message": "hello"}
+	if _, err := faas.InvokeFunction(context.Background(), "echo", payload); err != nil {
+		t.Fatalf("InvokeFunction() error = %v", err)
+	}
+	if seenRequest.FunctionName != "echo" || seenRequest.Config.Name != "echo" {
+		t.Errorf("request = %+v, want the echo function", seenRequest)
+	}
+	if !reflect.DeepEqual(seenRequest.Payload, payload) {
+		t.Errorf("request payload = %v, want %v", seenRequest.Payload, payload)
+	}
+	if echo, ok := seenOutput.(EchoOutput); !ok || !reflect.DeepEqual(echo.Payload, payload) {
+		t.Errorf("output = %#v, want the echoed payload", seenOutput)
+	}
+
+	_, err := faas.InvokeFunction(context.Background(), "failing", intf.Payload{})
+	if err == nil || !errors.Is(seenErr, err) {
+		t.Errorf("interceptor error = %v, want %v", seenErr, err)
+	}
+}
+
+func TestFaas_Use_ModifiesAndShortCircuits(t *testing.T) {
+	errDenied := errors.New("denied")
+	faas := newEchoFaas(t)
+	faas.Use(
+		// Rejects payloads without a token
+		func(next Handler) Handler {
+			return func(ctx context.Context, request InvocationRequest) (intf.FunctionOutput, error) {
+				if request.Payload["token"] != "secret" {
+					return nil, errDenied
+				}
+				return next(ctx, request)
+			}
+		},
+		// Redacts the token before the function sees it
+		func(next Handler) Handler {
+			return func(ctx context.Context, request InvocationRequest) (intf.FunctionOutput, error) {
+				redacted := intf.Payload{}
+				for key, value := range request.Payload {
+					redacted[key] = value
+				}
+				redacted["token"] = "[REDACTED]"
+				request.Payload = redacted
+				return next(ctx, request)
+			}
+		},
+	)
+
+	if _, err := faas.InvokeFunction(context.Background(), "echo", intf.Payload{}); !errors.Is(err, errDenied) {
+		t.Errorf("InvokeFunction() without token error = %v, want %v", err, errDenied)
+	}
+
+	output, err := faas.InvokeFunction(context.Background(), "echo", intf.Payload{"token": "secret"})
+	if err != nil {
+		t.Fatalf("InvokeFunction() error = %v", err)
+	}
+	if got := output.(EchoOutput).Payload["token"]; got != "[REDACTED]" {
+		t.Errorf("function saw token %v, want it redacted", got)
+	}
+}
+
+func TestFaas_Use_RecordsModifiedPayload(t *testing.T) {
+	faas, _ := newFlakyFaas(t, 1, errors.New("send failed"), WithDefaultRetryPolicy(NoRetryPolicy))
+	// Adds a tenant and a credential the function runs with
+	faas.Use(func(next Handler) Handler {
+		return func(ctx context.Context, request InvocationRequest) (intf.FunctionOutput, error) {
+			request.Payload = intf.Payload{"tenant": "acme", "api_key": "SG.injected"}
+			return next(ctx, request)
+		}
+	})
+
+	faas.InvokeFunction(context.Background(), "flaky", intf.Payload{"tenant": "original"})
+
+	want := intf.Payload{"tenant": "acme", "api_key": helpers.RedactedValue}
+	records, err := faas.QueryHistory(HistoryQuery{})
+	if err != nil || len(records) != 1 || !reflect.DeepEqual(records[0].Payload, want) {
+		t.Errorf("history = %+v, %v; want the payload %v", records, err, want)
+	}
+	letters, err := faas.ListDeadLetters("")
+	if err != nil || len(letters) != 1 || !reflect.DeepEqual(letters[0].Payload, want) {
+		t.Errorf("dead letters = %+v, %v; want the payload %v", letters, err, want)
+	}
+}
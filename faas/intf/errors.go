@@ -0,0 +1,112 @@
+package intf
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+type (
+	// ProviderError is returned by a function when a call to an external
+	// provider fails. StatusCode is zero when no response was received.
+	ProviderError struct {
+		Provider   string
+		StatusCode int
+		RetryAfter time.Duration
+		Retryable  bool
+		Err        error
+	}
+
+	// RetryableError marks an error as transient
+	RetryableError struct {
+		Err error
+	}
+
+	// PermanentError marks an error that must not be retried
+	PermanentError struct {
+		Err error
+	}
+)
+
+// NewProviderError creates a ProviderError that is retryable when no
+// response was received, the provider rate-limited the call or failed with
+// a 5xx status
+func NewProviderError(provider string, statusCode int, err error) *ProviderError {
+	return &ProviderError{
+		Provider:   provider,
+		StatusCode: statusCode,
+		Retryable:  statusCode == 0 || statusCode == http.StatusTooManyRequests || statusCode >= http.StatusInternalServerError,
+		Err:        err,
+	}
+}
+
+func (providerErr *ProviderError) Error() string {
+	if providerErr.StatusCode == 0 {
+		return fmt.Sprintf("%s error: %v", providerErr.Provider, providerErr.Err)
+	}
+	return fmt.Sprintf("%s error (status %d): %v", providerErr.Provider, providerErr.StatusCode, providerErr.Err)
+}
+
+func (providerErr *ProviderError) Unwrap() error {
+	return providerErr.Err
+}
+
+// Retryable marks err as transient so the invocation is retried
+func Retryable(err error) error {
+	return &RetryableError{Err: err}
+}
+
+func (retryableErr *RetryableError) Error() string {
+	return retryableErr.Err.Error()
+}
+
+func (retryableErr *RetryableError) Unwrap() error {
+	return retryableErr.Err
+}
+
+// Permanent marks err as final so the invocation is not retried
+func Permanent(err error) error {
+	return &PermanentError{Err: err}
+}
+
+func (permanentErr *PermanentError) Error() string {
+	return permanentErr.Err.Error()
+}
+
+func (permanentErr *PermanentError) Unwrap() error {
+	return permanentErr.Err
+}
+
+// IsRetryable reports whether err is worth retrying. Cancellation, expired
+// deadlines and unclassified errors are never retried.
+func IsRetryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var (
+		permanentErr *PermanentError
+		retryableErr *RetryableError
+		providerErr  *ProviderError
+	)
+	switch {
+	case errors.As(err, &permanentErr):
+		return false
+	case errors.As(err, &retryableErr):
+		return true
+	case errors.As(err, &providerErr):
+		return providerErr.Retryable
+	}
+	return false
+}
+
+// RetryAfter returns the delay requested by the provider, if any
+func RetryAfter(err error) time.Duration {
+	var providerErr *ProviderError
+	if errors.As(err, &providerErr) {
+		return providerErr.RetryAfter
+	}
+	return 0
+}
@@ -0,0 +1,65 @@
+package intf
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestIsRetryable(t *testing.T) {
+	base := errors.New("boom")
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "nil", err: nil, want: false},
+		{name: "unclassified", err: base, want: false},
+		{name: "canceled", err: context.Canceled, want: false},
+		{name: "deadline exceeded", err: fmt.Errorf("wrapped: %w", context.DeadlineExceeded), want: false},
+		{name: "retryable", err: Retryable(base), want: true},
+		{name: "wrapped retryable", err: fmt.Errorf("wrapped: %w", Retryable(base)), want: true},
+		{name: "permanent", err: Permanent(base), want: false},
+		{name: "permanent provider error", err: Permanent(NewProviderError("test", 503, base)), want: false},
+		{name: "no response", err: NewProviderError("test", 0, base), want: true},
+		{name: "rate limited", err: NewProviderError("test", 429, base), want: true},
+		{name: "server error", err: NewProviderError("test", 502, base), want: true},
+		{name: "client error", err: NewProviderError("test", 400, base), want: false},
+		{name: "unauthorized", err: NewProviderError("test", 401, base), want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsRetryable(tt.err); got != tt.want {
+				t.Errorf("IsRetryable(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	providerErr := NewProviderError("test", 429, errors.New("slow down"))
+	providerErr.RetryAfter = 2 * time.Second
+
+	if got := RetryAfter(fmt.Errorf("wrapped: %w", providerErr)); got != 2*time.Second {
+		t.Errorf("RetryAfter() = %v, want 2s", got)
+	}
+	if got := RetryAfter(errors.New("boom")); got != 0 {
+		t.Errorf("RetryAfter() = %v, want 0", got)
+	}
+}
+
+func TestProviderError_Error(t *testing.T) {
+	base := errors.New("boom")
+	if got, want := NewProviderError("slack", 0, base).Error(), "slack error: boom"; got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+	if got, want := NewProviderError("slack", 500, base).Error(), "slack error (status 500): boom"; got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+	if !errors.Is(NewProviderError("slack", 500, base), base) {
+		t.Error("ProviderError does not unwrap to its cause")
+	}
+}
@@ -1,19 +1,73 @@
 package intf
 
+import "context"
+
 type (
 	Payload map[string]interface{}
 
 	FunctionConfig struct {
-		Name string `json:"name"`
+		Name         string  `json:"name"`
+		Description  string  `json:"description,omitempty"`
+		Version      string  `json:"version,omitempty"`
+		InputSchema  *Schema `json:"input_schema,omitempty"`
+		OutputSchema *Schema `json:"output_schema,omitempty"`
+		// Credentials are the credential keys the function resolves through
+		// its CredentialResolver; Faas denies every other key
+		Credentials []string `json:"credentials,omitempty"`
 	}
 
 	Function interface {
 		GetConfig() FunctionConfig
 		ParsePayload(Payload) error
 		Validate() error
-		Execute() (FunctionOutput, error)
+		// Execute must honor cancellation and deadlines of ctx in every
+		// call it makes to an external provider
+		Execute(ctx context.Context) (FunctionOutput, error)
 	}
 	FunctionOutput interface {
 		GetPayload() (Payload, error)
 	}
+
+	// RateLimitKeyer is implemented by functions whose provider enforces
+	// rate limits per credential. RateLimitKey is called after ParsePayload
+	// and returns the credential the limit applies to, such as an API token
+	// or account ID; Faas only keeps a hash of it.
+	RateLimitKeyer interface {
+		RateLimitKey() string
+	}
+
+	// Endpointer is implemented by functions that call an external
+	// endpoint. Endpoint is called after ParsePayload; invocations sharing
+	// an endpoint share a circuit breaker.
+	Endpointer interface {
+		Endpoint() string
+	}
+
+	// CredentialResolver resolves credential keys such as SLACK_API_TOKEN.
+	// It returns an empty string without an error for unknown keys.
+	CredentialResolver interface {
+		ResolveCredential(key string) (string, error)
+	}
+
+	// CredentialConsumer is implemented by functions that resolve their
+	// credentials through a CredentialResolver. Faas calls
+	// SetCredentialResolver before ParsePayload with a resolver bound to
+	// the invocation that only resolves the keys of
+	// FunctionConfig.Credentials.
+	CredentialConsumer interface {
+		SetCredentialResolver(resolver CredentialResolver)
+	}
+
+	// FunctionFactory creates a fresh Function instance. Faas calls the
+	// factory once per invocation so that concurrent invocations never
+	// share parsed input.
+	FunctionFactory func() Function
 )
+
+// FactoryOf adapts a typed constructor such as functions.NewSlack into a
+// FunctionFactory
+func FactoryOf[T Function](constructor func() T) FunctionFactory {
+	return func() Function {
+		return constructor()
+	}
+}
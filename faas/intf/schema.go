@@ -0,0 +1,53 @@
+package intf
+
+const (
+	// JSON Schema types
+	StringSchemaType  = "string"
+	BooleanSchemaType = "boolean"
+	IntegerSchemaType = "integer"
+	NumberSchemaType  = "number"
+	ArraySchemaType   = "array"
+	ObjectSchemaType  = "object"
+)
+
+type (
+	// Schema is the subset of JSON Schema used to describe function inputs
+	// and outputs. An empty Type accepts any value.
+	Schema struct {
+		Type                 string             `json:"type,omitempty"`
+		Description          string             `json:"description,omitempty"`
+		Format               string             `json:"format,omitempty"`
+		Enum                 []interface{}      `json:"enum,omitempty"`
+		Properties           map[string]*Schema `json:"properties,omitempty"`
+		Required             []string           `json:"required,omitempty"`
+		Items                *Schema            `json:"items,omitempty"`
+		AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+		// WriteOnly marks credential fields, which may be omitted from
+		// the payload when they are resolved from the environment
+		WriteOnly bool `json:"writeOnly,omitempty"`
+	}
+)
+
+// Copy returns a deep copy of schema, so that shared schemas can be handed
+// out without callers modifying them
+func (schema *Schema) Copy() *Schema {
+	if schema == nil {
+		return nil
+	}
+	copied := *schema
+	if schema.Enum != nil {
+		copied.Enum = append([]interface{}(nil), schema.Enum...)
+	}
+	if schema.Required != nil {
+		copied.Required = append([]string(nil), schema.Required...)
+	}
+	if schema.Properties != nil {
+		copied.Properties = make(map[string]*Schema, len(schema.Properties))
+		for name, property := range schema.Properties {
+			copied.Properties[name] = property.Copy()
+		}
+	}
+	copied.Items = schema.Items.Copy()
+	copied.AdditionalProperties = schema.AdditionalProperties.Copy()
+	return &copied
+}
@@ -0,0 +1,53 @@
+package faas
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+
+	"github.com/gsarmaonline/faas/faas/intf"
+)
+
+const (
+	// Invocation statuses
+	QueuedInvocationStatus    = InvocationStatusT("queued")
+	RunningInvocationStatus   = InvocationStatusT("running")
+	SucceededInvocationStatus = InvocationStatusT("succeeded")
+	FailedInvocationStatus    = InvocationStatusT("failed")
+)
+
+type (
+	InvocationStatusT string
+
+	// Invocation is the state of an asynchronous invocation
+	Invocation struct {
+		ID           string            `json:"id"`
+		FunctionName string            `json:"function_name"`
+		Status       InvocationStatusT `json:"status"`
+		Output       intf.Payload      `json:"output,omitempty"`
+		Error        string            `json:"error,omitempty"`
+		QueuedAt     time.Time         `json:"queued_at"`
+		StartedAt    time.Time         `json:"started_at,omitempty"`
+		FinishedAt   time.Time         `json:"finished_at,omitempty"`
+	}
+)
+
+// IsTerminal reports whether the invocation has finished
+func (status InvocationStatusT) IsTerminal() bool {
+	return status == SucceededInvocationStatus || status == FailedInvocationStatus
+}
+
+// Duration returns how long the invocation ran, or zero if it has not
+// finished
+func (invocation Invocation) Duration() time.Duration {
+	if invocation.FinishedAt.IsZero() || invocation.StartedAt.IsZero() {
+		return 0
+	}
+	return invocation.FinishedAt.Sub(invocation.StartedAt)
+}
+
+func newInvocationID() string {
+	id := make([]byte, 16)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
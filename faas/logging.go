@@ -0,0 +1,135 @@
+package faas
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/gsarmaonline/faas/faas/helpers"
+	"github.com/gsarmaonline/faas/faas/intf"
+)
+
+const (
+	// Attributes of invocation logs
+	InvocationIDLogKey = "invocation_id"
+	FunctionLogKey     = "function"
+	AttemptLogKey      = "attempt"
+)
+
+type (
+	invocationIDKeyT struct{}
+
+	// functionLogHandler applies the log level configured for a function
+	// and redacts its credentials: attributes named after credential fields
+	// and known secret values in messages, strings and errors
+	functionLogHandler struct {
+		handler  slog.Handler
+		level    slog.Leveler
+		schema   *intf.Schema
+		redactor *helpers.Redactor
+	}
+)
+
+// invocationLogger returns the logger of an invocation, carrying its ID and
+// function name
+func (faas *Faas) invocationLogger(id, name string, config intf.FunctionConfig, redactor *helpers.Redactor) *slog.Logger {
+	handler := &functionLogHandler{
+		handler:  faas.logger.Handler(),
+		schema:   config.InputSchema,
+		redactor: redactor,
+	}
+	if level, exists := faas.logLevels[name]; exists {
+		handler.level = level
+	}
+	return slog.New(handler).With(InvocationIDLogKey, id, FunctionLogKey, name)
+}
+
+func (handler *functionLogHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	if handler.level != nil {
+		return level >= handler.level.Level()
+	}
+	return handler.handler.Enabled(ctx, level)
+}
+
+func (handler *functionLogHandler) Handle(ctx context.Context, record slog.Record) error {
+	redacted := slog.NewRecord(record.Time, record.Level, handler.redactor.String(record.Message), record.PC)
+	record.Attrs(func(attr slog.Attr) bool {
+		redacted.AddAttrs(handler.redact(attr))
+		return true
+	})
+	return handler.handler.Handle(ctx, redacted)
+}
+
+func (handler *functionLogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	redacted := make([]slog.Attr, len(attrs))
+	for idx, attr := range attrs {
+		redacted[idx] = handler.redact(attr)
+	}
+	return &functionLogHandler{
+		handler:  handler.handler.WithAttrs(redacted),
+		level:    handler.level,
+		schema:   handler.schema,
+		redactor: handler.redactor,
+	}
+}
+
+func (handler *functionLogHandler) WithGroup(name string) slog.Handler {
+	return &functionLogHandler{
+		handler:  handler.handler.WithGroup(name),
+		level:    handler.level,
+		schema:   handler.schema,
+		redactor: handler.redactor,
+	}
+}
+
+func (handler *functionLogHandler) redact(attr slog.Attr) slog.Attr {
+	var property *intf.Schema
+	if handler.schema != nil {
+		property = handler.schema.Properties[attr.Key]
+	}
+	if handler.redactor.IsCredential(attr.Key, property) {
+		return slog.String(attr.Key, helpers.RedactedValue)
+	}
+
+	value := attr.Value.Resolve()
+	switch value.Kind() {
+	case slog.KindGroup:
+		group := value.Group()
+		redacted := make([]any, len(group))
+		for idx, member := range group {
+			redacted[idx] = handler.redact(member)
+		}
+		return slog.Group(attr.Key, redacted...)
+	case slog.KindString:
+		return slog.String(attr.Key, handler.redactor.String(value.String()))
+	case slog.KindAny:
+		switch typed := value.Any().(type) {
+		case nil:
+		case error:
+			return slog.String(attr.Key, handler.redactor.String(typed.Error()))
+		case intf.Payload:
+			return slog.Any(attr.Key, handler.redactor.Payload(property, typed))
+		case map[string]interface{}:
+			return slog.Any(attr.Key, map[string]interface{}(handler.redactor.Payload(property, typed)))
+		default:
+			// Other values, such as structs and Stringers, are logged as
+			// their masked string
+			return slog.String(attr.Key, handler.redactor.String(fmt.Sprint(typed)))
+		}
+	}
+	return attr
+}
+
+// withInvocationID returns a copy of ctx that makes the next invocation use
+// id, so that asynchronous invocations log and record their own ID. An empty
+// id makes the next invocation use a fresh one.
+func withInvocationID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, invocationIDKeyT{}, id)
+}
+
+func invocationIDFromContext(ctx context.Context) string {
+	if id, _ := ctx.Value(invocationIDKeyT{}).(string); id != "" {
+		return id
+	}
+	return newInvocationID()
+}
@@ -0,0 +1,90 @@
+package faas
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/gsarmaonline/faas/faas/helpers"
+	"github.com/gsarmaonline/faas/faas/intf"
+)
+
+// LoggingFunction logs its payload, including its credential
+type LoggingFunction struct {
+	CredentialFunction
+}
+
+func (l *LoggingFunction) Execute(ctx context.Context) (intf.FunctionOutput, error) {
+	logger := helpers.LoggerFromContext(ctx)
+	logger.Debug("Sending", "message", l.Input["message"])
+	logger.Info("Sent", "api_key", l.Input["api_key"], slog.Group("auth", "api_key", l.Input["api_key"]))
+	return nil, nil
+}
+
+func newLoggingFaas(t *testing.T, opts ...Option) (*Faas, *bytes.Buffer) {
+	out := &bytes.Buffer{}
+	logger := slog.New(slog.NewJSONHandler(out, &slog.HandlerOptions{Level: slog.LevelInfo}))
+	faas := newFaas(context.Background(), append([]Option{WithLogger(logger)}, opts...)...)
+	if err := faas.RegisterFunctions([]intf.FunctionFactory{func() intf.Function { return &LoggingFunction{} }}); err != nil {
+		t.Fatalf("RegisterFunctions() error = %v", err)
+	}
+	return faas, out
+}
+
+func logLines(t *testing.T, out *bytes.Buffer) (lines []map[string]interface{}) {
+	t.Helper()
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		entry := make(map[string]interface{})
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("log line %q is not JSON: %v", line, err)
+		}
+		lines = append(lines, entry)
+	}
+	return
+}
+
+func TestFaas_InvocationLogger(t *testing.T) {
+	faas, out := newLoggingFaas(t)
+	payload := intf.Payload{"message": "hi", "api_key": "SG.secret"}
+	if _, err := faas.InvokeFunction(context.Background(), "credential", payload); err != nil {
+		t.Fatalf("InvokeFunction() error = %v", err)
+	}
+
+	if strings.Contains(out.String(), "SG.secret") {
+		t.Errorf("log contains the credential:\n%s", out.String())
+	}
+	lines := logLines(t, out)
+	if len(lines) != 1 {
+		t.Fatalf("got %d log lines, want the info line only:\n%s", len(lines), out.String())
+	}
+	records, err := faas.QueryHistory(HistoryQuery{})
+	if err != nil || len(records) != 1 {
+		t.Fatalf("QueryHistory() = %v, %v, want one record", records, err)
+	}
+	entry := lines[0]
+	if entry[InvocationIDLogKey] != records[0].ID || entry[FunctionLogKey] != "credential" || entry[AttemptLogKey] != 1.0 {
+		t.Errorf("log fields = %v, want invocation ID %s, function credential and attempt 1", entry, records[0].ID)
+	}
+	if entry["api_key"] != helpers.RedactedValue {
+		t.Errorf("api_key = %v, want %s", entry["api_key"], helpers.RedactedValue)
+	}
+}
+
+func TestFaas_FunctionLogLevel(t *testing.T) {
+	faas, out := newLoggingFaas(t, WithFunctionLogLevel("credential", slog.LevelDebug))
+	if _, err := faas.InvokeFunction(context.Background(), "credential", intf.Payload{"message": "hi"}); err != nil {
+		t.Fatalf("InvokeFunction() error = %v", err)
+	}
+	if lines := logLines(t, out); len(lines) != 2 || lines[0]["msg"] != "Sending" {
+		t.Errorf("log = %s, want the debug and info lines", out.String())
+	}
+
+	faas, out = newLoggingFaas(t, WithFunctionLogLevel("credential", slog.LevelError))
+	faas.InvokeFunction(context.Background(), "credential", intf.Payload{"message": "hi"})
+	if out.Len() != 0 {
+		t.Errorf("log = %s, want nothing below error", out.String())
+	}
+}
@@ -0,0 +1,105 @@
+package faas
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gsarmaonline/faas/faas/helpers"
+	"github.com/gsarmaonline/faas/faas/intf"
+	"github.com/gsarmaonline/faas/faas/metrics"
+)
+
+const (
+	// DefaultMetricsInstance is the instance label of the pool gauges
+	DefaultMetricsInstance = "default"
+)
+
+// Reasons of the faas_invocations_rejected_total counter
+const (
+	queueFullRejectionReason   = "queue_full"
+	rateLimitedRejectionReason = "rate_limited"
+)
+
+type (
+	// invocationMetrics are the metrics Faas records for every invocation
+	invocationMetrics struct {
+		registry       *metrics.Registry
+		invocations    *metrics.CounterVec
+		duration       *metrics.HistogramVec
+		retries        *metrics.CounterVec
+		rejections     *metrics.CounterVec
+		providerErrors *metrics.CounterVec
+	}
+)
+
+// newInvocationMetrics registers the metrics of a Faas. The pool gauges are
+// labelled with instance so that several Faas can share registry; the
+// counters and histograms are shared. It returns metrics.ErrDuplicateMetric
+// if instance already has pool gauges in registry, the metrics are usable
+// regardless.
+func newInvocationMetrics(registry *metrics.Registry, instance string, pool *WorkerPool) (invMetrics *invocationMetrics, err error) {
+	err = errors.Join(
+		registry.GaugeFuncs("faas_queue_depth", "Invocations waiting for a worker.", "instance").Register(func() float64 {
+			return float64(pool.Stats().QueueDepth)
+		}, instance),
+		registry.GaugeFuncs("faas_invocations_in_flight", "Invocations currently running.", "instance").Register(func() float64 {
+			return float64(pool.Stats().Running)
+		}, instance),
+	)
+	// Recorded by the Docker executor through the invocation context
+	registry.Histogram(helpers.DockerContainerStartMetric, helpers.DockerContainerStartMetricHelp, metrics.DefaultBuckets)
+
+	invMetrics = &invocationMetrics{
+		registry: registry,
+		invocations: registry.Counter("faas_invocations_total",
+			"Finished invocations by function and status.", "function", "status"),
+		duration: registry.Histogram("faas_invocation_duration_seconds",
+			"Duration of finished invocations, including retries.", metrics.DefaultBuckets, "function"),
+		retries: registry.Counter("faas_retries_total",
+			"Retried executions by function.", "function"),
+		rejections: registry.Counter("faas_invocations_rejected_total",
+			"Invocations rejected by function and reason.", "function", "reason"),
+		providerErrors: registry.Counter("faas_provider_errors_total",
+			"Errors returned by external providers by status code; 0 means no response.", "provider", "status_code"),
+	}
+	return
+}
+
+// MetricsHandler serves the invocation metrics in the Prometheus text
+// exposition format
+func (faas *Faas) MetricsHandler() http.Handler {
+	return faas.metrics.registry
+}
+
+func (invMetrics *invocationMetrics) recordInvocation(name string, err error, startedAt time.Time) {
+	status := SucceededInvocationStatus
+	if err != nil {
+		status = FailedInvocationStatus
+	}
+	invMetrics.invocations.With(name, string(status)).Inc()
+	invMetrics.duration.With(name).Observe(time.Since(startedAt).Seconds())
+}
+
+func (invMetrics *invocationMetrics) recordRetry(name string) {
+	invMetrics.retries.With(name).Inc()
+}
+
+// recordRejection counts err if it rejected an invocation of name because
+// the queue was full or the rate limit was exceeded
+func (invMetrics *invocationMetrics) recordRejection(name string, err error) {
+	switch {
+	case errors.Is(err, ErrQueueFull):
+		invMetrics.rejections.With(name, queueFullRejectionReason).Inc()
+	case errors.Is(err, ErrRateLimited):
+		invMetrics.rejections.With(name, rateLimitedRejectionReason).Inc()
+	}
+}
+
+func (invMetrics *invocationMetrics) recordExecuteError(err error) {
+	var providerErr *intf.ProviderError
+	if errors.As(err, &providerErr) {
+		invMetrics.providerErrors.With(providerErr.Provider, strconv.Itoa(providerErr.StatusCode)).Inc()
+	}
+}
@@ -0,0 +1,28 @@
+package metrics
+
+import (
+	"context"
+)
+
+type (
+	registryKeyT struct{}
+)
+
+// discard collects metrics recorded without a registry in the context. It
+// is never exposed.
+var discard = NewRegistry()
+
+// WithRegistry returns a context that carries registry, so that code deep in
+// an invocation, such as the Docker executor, can record metrics
+func WithRegistry(ctx context.Context, registry *Registry) context.Context {
+	return context.WithValue(ctx, registryKeyT{}, registry)
+}
+
+// FromContext returns the registry set by WithRegistry. Without one it
+// returns a registry that is never exposed, so callers need no nil checks.
+func FromContext(ctx context.Context) *Registry {
+	if registry, ok := ctx.Value(registryKeyT{}).(*Registry); ok && registry != nil {
+		return registry
+	}
+	return discard
+}
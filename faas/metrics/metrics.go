@@ -0,0 +1,330 @@
+// Package metrics collects counters, gauges and histograms and exposes them
+// in the Prometheus text exposition format.
+package metrics
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	// Metric kinds
+	CounterKind   = KindT("counter")
+	GaugeKind     = KindT("gauge")
+	HistogramKind = KindT("histogram")
+
+	// ContentType is the content type of the text exposition format
+	ContentType = "text/plain; version=0.0.4; charset=utf-8"
+)
+
+// DefaultBuckets are histogram buckets in seconds suited to calls to
+// external providers
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+// ErrDuplicateMetric is returned when a gauge function is registered again
+// for the same name and label values
+var ErrDuplicateMetric = errors.New("metric already registered")
+
+type (
+	KindT string
+
+	// Registry holds metric families. Its methods return the existing
+	// family when a name is registered again with the same kind and labels.
+	Registry struct {
+		mu       sync.Mutex
+		families map[string]*family
+	}
+
+	// CounterVec is a family of counters partitioned by label values
+	CounterVec struct {
+		family *family
+	}
+
+	// GaugeFuncVec is a family of gauges partitioned by label values whose
+	// values are read from a function on every scrape
+	GaugeFuncVec struct {
+		family *family
+	}
+
+	// HistogramVec is a family of histograms partitioned by label values
+	HistogramVec struct {
+		family *family
+	}
+
+	// Counter only goes up
+	Counter struct {
+		series *series
+	}
+
+	// Histogram counts observations in buckets
+	Histogram struct {
+		buckets []float64
+		series  *series
+	}
+
+	family struct {
+		name       string
+		help       string
+		kind       KindT
+		labelNames []string
+		buckets    []float64
+
+		mu     sync.Mutex
+		series map[string]*series
+	}
+
+	series struct {
+		mu          sync.Mutex
+		labelValues []string
+		// value is the counter value or the histogram sum
+		value float64
+		// bucketCounts are cumulative per upper bound of the family
+		bucketCounts []uint64
+		count        uint64
+		// read is the function of a gauge function series
+		read func() float64
+	}
+)
+
+func NewRegistry() *Registry {
+	return &Registry{families: make(map[string]*family)}
+}
+
+// Counter registers a counter family with the given label names
+func (registry *Registry) Counter(name, help string, labelNames ...string) *CounterVec {
+	return &CounterVec{family: registry.register(&family{
+		name:       name,
+		help:       help,
+		kind:       CounterKind,
+		labelNames: labelNames,
+	})}
+}
+
+// Histogram registers a histogram family with the given upper bounds, which
+// must be sorted, and label names
+func (registry *Registry) Histogram(name, help string, buckets []float64, labelNames ...string) *HistogramVec {
+	return &HistogramVec{family: registry.register(&family{
+		name:       name,
+		help:       help,
+		kind:       HistogramKind,
+		labelNames: labelNames,
+		buckets:    buckets,
+	})}
+}
+
+// GaugeFunc registers a gauge without labels whose value is read from value
+// on every scrape. It returns ErrDuplicateMetric if the name already has a
+// function.
+func (registry *Registry) GaugeFunc(name, help string, value func() float64) error {
+	return registry.GaugeFuncs(name, help).Register(value)
+}
+
+// GaugeFuncs registers a gauge function family with the given label names
+func (registry *Registry) GaugeFuncs(name, help string, labelNames ...string) *GaugeFuncVec {
+	return &GaugeFuncVec{family: registry.register(&family{
+		name:       name,
+		help:       help,
+		kind:       GaugeKind,
+		labelNames: labelNames,
+	})}
+}
+
+// register adds newFamily, or returns the family already registered under
+// its name. Registering a name twice with a different kind or different
+// labels is a programming error and panics.
+func (registry *Registry) register(newFamily *family) *family {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+
+	if existing, exists := registry.families[newFamily.name]; exists {
+		if existing.kind != newFamily.kind || strings.Join(existing.labelNames, ",") != strings.Join(newFamily.labelNames, ",") {
+			panic(fmt.Sprintf("metrics: %s registered again with a different kind or labels", newFamily.name))
+		}
+		return existing
+	}
+	newFamily.series = make(map[string]*series)
+	registry.families[newFamily.name] = newFamily
+	return newFamily
+}
+
+// With returns the counter for the given label values, in the order of the
+// label names
+func (vec *CounterVec) With(labelValues ...string) *Counter {
+	return &Counter{series: vec.family.with(labelValues)}
+}
+
+// Inc adds one to the counter
+func (counter *Counter) Inc() {
+	counter.Add(1)
+}
+
+// Add adds delta, which must not be negative, to the counter
+func (counter *Counter) Add(delta float64) {
+	counter.series.mu.Lock()
+	defer counter.series.mu.Unlock()
+
+	counter.series.value += delta
+}
+
+// Register reads the gauge for the given label values, in the order of the
+// label names, from value on every scrape. It returns ErrDuplicateMetric if
+// the label values already have a function.
+func (vec *GaugeFuncVec) Register(value func() float64, labelValues ...string) error {
+	found := vec.family.with(labelValues)
+	found.mu.Lock()
+	defer found.mu.Unlock()
+
+	if found.read != nil {
+		return fmt.Errorf("%w: %s%s", ErrDuplicateMetric, vec.family.name, formatLabels(vec.family.labelNames, labelValues))
+	}
+	found.read = value
+	return nil
+}
+
+// With returns the histogram for the given label values, in the order of the
+// label names
+func (vec *HistogramVec) With(labelValues ...string) *Histogram {
+	return &Histogram{buckets: vec.family.buckets, series: vec.family.with(labelValues)}
+}
+
+// Observe records a single observation
+func (histogram *Histogram) Observe(value float64) {
+	histogram.series.mu.Lock()
+	defer histogram.series.mu.Unlock()
+
+	for idx, bound := range histogram.buckets {
+		if value <= bound {
+			histogram.series.bucketCounts[idx]++
+		}
+	}
+	histogram.series.value += value
+	histogram.series.count++
+}
+
+func (family *family) with(labelValues []string) *series {
+	if len(labelValues) != len(family.labelNames) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", family.name, len(family.labelNames), len(labelValues)))
+	}
+
+	key := strings.Join(labelValues, "\xff")
+	family.mu.Lock()
+	defer family.mu.Unlock()
+
+	found, exists := family.series[key]
+	if !exists {
+		found = &series{
+			labelValues:  append([]string(nil), labelValues...),
+			bucketCounts: make([]uint64, len(family.buckets)),
+		}
+		family.series[key] = found
+	}
+	return found
+}
+
+// WriteText writes all metrics in the Prometheus text exposition format,
+// sorted by name and label values
+func (registry *Registry) WriteText(writer io.Writer) error {
+	registry.mu.Lock()
+	families := make([]*family, 0, len(registry.families))
+	for _, family := range registry.families {
+		families = append(families, family)
+	}
+	registry.mu.Unlock()
+	sort.Slice(families, func(i, j int) bool {
+		return families[i].name < families[j].name
+	})
+
+	buffered := bufio.NewWriter(writer)
+	for _, family := range families {
+		family.writeText(buffered)
+	}
+	return buffered.Flush()
+}
+
+// ServeHTTP serves the metrics in the Prometheus text exposition format
+func (registry *Registry) ServeHTTP(writer http.ResponseWriter, req *http.Request) {
+	writer.Header().Set("Content-Type", ContentType)
+	registry.WriteText(writer)
+}
+
+func (family *family) writeText(writer *bufio.Writer) {
+	fmt.Fprintf(writer, "# HELP %s %s\n", family.name, escapeHelp(family.help))
+	fmt.Fprintf(writer, "# TYPE %s %s\n", family.name, family.kind)
+
+	family.mu.Lock()
+	all := make([]*series, 0, len(family.series))
+	for _, series := range family.series {
+		all = append(all, series)
+	}
+	family.mu.Unlock()
+	sort.Slice(all, func(i, j int) bool {
+		return strings.Join(all[i].labelValues, "\xff") < strings.Join(all[j].labelValues, "\xff")
+	})
+
+	for _, series := range all {
+		series.mu.Lock()
+		read := series.read
+		series.mu.Unlock()
+		if read != nil {
+			// Read outside the lock, value may take locks of its own
+			fmt.Fprintf(writer, "%s%s %s\n", family.name, formatLabels(family.labelNames, series.labelValues), formatValue(read()))
+			continue
+		}
+
+		series.mu.Lock()
+		labels := formatLabels(family.labelNames, series.labelValues)
+		switch family.kind {
+		case HistogramKind:
+			bucketNames := append(append([]string(nil), family.labelNames...), "le")
+			bucketValues := append(append([]string(nil), series.labelValues...), "")
+			for idx, bound := range family.buckets {
+				bucketValues[len(bucketValues)-1] = formatValue(bound)
+				fmt.Fprintf(writer, "%s_bucket%s %d\n", family.name, formatLabels(bucketNames, bucketValues), series.bucketCounts[idx])
+			}
+			bucketValues[len(bucketValues)-1] = "+Inf"
+			fmt.Fprintf(writer, "%s_bucket%s %d\n", family.name, formatLabels(bucketNames, bucketValues), series.count)
+			fmt.Fprintf(writer, "%s_sum%s %s\n", family.name, labels, formatValue(series.value))
+			fmt.Fprintf(writer, "%s_count%s %d\n", family.name, labels, series.count)
+		default:
+			fmt.Fprintf(writer, "%s%s %s\n", family.name, labels, formatValue(series.value))
+		}
+		series.mu.Unlock()
+	}
+}
+
+func formatLabels(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	pairs := make([]string, len(names))
+	for idx, name := range names {
+		pairs[idx] = name + `="` + escapeLabelValue(values[idx]) + `"`
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatValue(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+func escapeLabelValue(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+func escapeHelp(help string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(help)
+}
@@ -0,0 +1,118 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRegistry_WriteText(t *testing.T) {
+	registry := NewRegistry()
+	calls := registry.Counter("calls_total", "Calls by function.", "function")
+	calls.With("slack").Inc()
+	calls.With("email").Add(2)
+	calls.With(`quo"te`).Inc()
+	registry.GaugeFunc("queue_depth", "Queued calls.", func() float64 { return 3 })
+	latency := registry.Histogram("latency_seconds", "Call latency.", []float64{0.1, 1}, "function")
+	latency.With("slack").Observe(0.05)
+	latency.With("slack").Observe(0.5)
+	latency.With("slack").Observe(5)
+
+	var out strings.Builder
+	if err := registry.WriteText(&out); err != nil {
+		t.Fatalf("WriteText() error = %v", err)
+	}
+	want := `# HELP calls_total Calls by function.
+# TYPE calls_total counter
+calls_total{function="email"} 2
+calls_total{function="quo\"te"} 1
+calls_total{function="slack"} 1
+# HELP latency_seconds Call latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{function="slack",le="0.1"} 1
+latency_seconds_bucket{function="slack",le="1"} 2
+latency_seconds_bucket{function="slack",le="+Inf"} 3
+latency_seconds_sum{function="slack"} 5.55
+latency_seconds_count{function="slack"} 3
+# HELP queue_depth Queued calls.
+# TYPE queue_depth gauge
+queue_depth 3
+`
+	if out.String() != want {
+		t.Errorf("WriteText() =\n%s\nwant\n%s", out.String(), want)
+	}
+}
+
+func TestRegistry_RegisterAgain(t *testing.T) {
+	registry := NewRegistry()
+	registry.Counter("calls_total", "Calls.", "function").With("slack").Inc()
+	registry.Counter("calls_total", "Calls.", "function").With("slack").Inc()
+
+	var out strings.Builder
+	registry.WriteText(&out)
+	if !strings.Contains(out.String(), `calls_total{function="slack"} 2`) {
+		t.Errorf("counter registered twice did not share its value:\n%s", out.String())
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("registering calls_total with other labels did not panic")
+		}
+	}()
+	registry.Counter("calls_total", "Calls.", "provider")
+}
+
+func TestRegistry_GaugeFuncDuplicate(t *testing.T) {
+	registry := NewRegistry()
+	if err := registry.GaugeFunc("queue_depth", "Queued calls.", func() float64 { return 1 }); err != nil {
+		t.Fatalf("GaugeFunc() error = %v", err)
+	}
+	if err := registry.GaugeFunc("queue_depth", "Queued calls.", func() float64 { return 2 }); !errors.Is(err, ErrDuplicateMetric) {
+		t.Errorf("GaugeFunc() again error = %v, want %v", err, ErrDuplicateMetric)
+	}
+
+	depths := registry.GaugeFuncs("depth", "Queued calls by instance.", "instance")
+	if err := depths.Register(func() float64 { return 1 }, "a"); err != nil {
+		t.Fatalf("Register(a) error = %v", err)
+	}
+	if err := depths.Register(func() float64 { return 5 }, "b"); err != nil {
+		t.Fatalf("Register(b) error = %v", err)
+	}
+	if err := depths.Register(func() float64 { return 0 }, "a"); !errors.Is(err, ErrDuplicateMetric) {
+		t.Errorf("Register(a) again error = %v, want %v", err, ErrDuplicateMetric)
+	}
+
+	var out strings.Builder
+	registry.WriteText(&out)
+	for _, want := range []string{"queue_depth 1\n", `depth{instance="a"} 1`, `depth{instance="b"} 5`} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("WriteText() does not contain %q:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestRegistry_ServeHTTP(t *testing.T) {
+	registry := NewRegistry()
+	registry.Counter("calls_total", "Calls.").With().Inc()
+
+	recorder := httptest.NewRecorder()
+	registry.ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	if got := recorder.Header().Get("Content-Type"); got != ContentType {
+		t.Errorf("Content-Type = %q, want %q", got, ContentType)
+	}
+	if !strings.Contains(recorder.Body.String(), "calls_total 1\n") {
+		t.Errorf("body = %q, want calls_total 1", recorder.Body.String())
+	}
+}
+
+func TestFromContext(t *testing.T) {
+	registry := NewRegistry()
+	if got := FromContext(WithRegistry(context.Background(), registry)); got != registry {
+		t.Errorf("FromContext() = %p, want %p", got, registry)
+	}
+	if FromContext(context.Background()) == nil {
+		t.Error("FromContext() without a registry = nil, want a discarding registry")
+	}
+}
@@ -0,0 +1,115 @@
+package faas
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gsarmaonline/faas/faas/intf"
+	"github.com/gsarmaonline/faas/faas/metrics"
+)
+
+func TestFaas_Metrics(t *testing.T) {
+	registry := metrics.NewRegistry()
+	faas, _ := newFlakyFaas(t, 1, intf.NewProviderError("twilio", 503, errors.New("unavailable")),
+		WithDefaultRetryPolicy(fastRetryPolicy(3)),
+		WithMetricsRegistry(registry),
+	)
+	if _, err := faas.InvokeFunction(context.Background(), "flaky", intf.Payload{}); err != nil {
+		t.Fatalf("InvokeFunction() error = %v", err)
+	}
+	faas.InvokeFunction(context.Background(), "missing", intf.Payload{})
+
+	recorder := httptest.NewRecorder()
+	faas.MetricsHandler().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	body := recorder.Body.String()
+	for _, want := range []string{
+		`faas_invocations_total{function="flaky",status="succeeded"} 1`,
+		`faas_invocation_duration_seconds_count{function="flaky"} 1`,
+		`faas_retries_total{function="flaky"} 1`,
+		`faas_provider_errors_total{provider="twilio",status_code="503"} 1`,
+		`faas_queue_depth{instance="default"} 0`,
+		`faas_invocations_in_flight{instance="default"} 0`,
+		"# TYPE faas_docker_container_start_seconds histogram",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics do not contain %q:\n%s", want, body)
+		}
+	}
+	if strings.Contains(body, `function="missing"`) {
+		t.Errorf("unknown function was recorded:\n%s", body)
+	}
+}
+
+func TestFaas_Metrics_SharedRegistry(t *testing.T) {
+	registry := metrics.NewRegistry()
+	newFaas(context.Background(), WithMetricsRegistry(registry), WithMetricsInstance("first"))
+	second := newFaas(context.Background(), WithMetricsRegistry(registry), WithMetricsInstance("second"))
+
+	recorder := httptest.NewRecorder()
+	second.MetricsHandler().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	for _, want := range []string{
+		`faas_queue_depth{instance="first"} 0`,
+		`faas_queue_depth{instance="second"} 0`,
+		`faas_invocations_in_flight{instance="first"} 0`,
+		`faas_invocations_in_flight{instance="second"} 0`,
+	} {
+		if !strings.Contains(recorder.Body.String(), want) {
+			t.Errorf("metrics do not contain %q:\n%s", want, recorder.Body.String())
+		}
+	}
+
+	if _, err := newInvocationMetrics(registry, "first", NewWorkerPool(1, 1)); !errors.Is(err, metrics.ErrDuplicateMetric) {
+		t.Errorf("newInvocationMetrics() error = %v, want %v", err, metrics.ErrDuplicateMetric)
+	}
+}
+
+func TestFaas_Metrics_Rejections(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	faas := newFaas(ctx,
+		WithMaxQueueSize(1), WithFunctionConcurrency("blocking", 1),
+		WithRateLimit("echo", RateLimit{Rate: 0.001, Burst: 1}),
+	)
+	if err := faas.RegisterFunctions([]intf.FunctionFactory{
+		intf.FactoryOf(newBlockingFunction),
+		intf.FactoryOf(newEchoFunction),
+	}); err != nil {
+		t.Fatalf("RegisterFunctions() error = %v", err)
+	}
+
+	// One blocking invocation runs and one waits, filling the queue
+	for i := 0; i < 2; i++ {
+		if _, err := faas.InvokeAsync("blocking", intf.Payload{}); err != nil {
+			t.Fatalf("InvokeAsync() error = %v", err)
+		}
+	}
+	if _, err := faas.InvokeAsync("blocking", intf.Payload{}); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("InvokeAsync() error = %v, want %v", err, ErrQueueFull)
+	}
+	if _, err := faas.InvokeFunction(context.Background(), "blocking", intf.Payload{}); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("InvokeFunction() error = %v, want %v", err, ErrQueueFull)
+	}
+
+	rejectCtx := WithRateLimitMode(context.Background(), RejectRateLimitMode)
+	if _, err := faas.InvokeFunction(rejectCtx, "echo", intf.Payload{}); err != nil {
+		t.Fatalf("InvokeFunction() within burst error = %v", err)
+	}
+	if _, err := faas.InvokeFunction(rejectCtx, "echo", intf.Payload{}); !errors.Is(err, ErrRateLimited) {
+		t.Errorf("InvokeFunction() error = %v, want %v", err, ErrRateLimited)
+	}
+
+	recorder := httptest.NewRecorder()
+	faas.MetricsHandler().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	for _, want := range []string{
+		`faas_invocations_rejected_total{function="blocking",reason="queue_full"} 2`,
+		`faas_invocations_rejected_total{function="echo",reason="rate_limited"} 1`,
+	} {
+		if !strings.Contains(recorder.Body.String(), want) {
+			t.Errorf("metrics do not contain %q:\n%s", want, recorder.Body.String())
+		}
+	}
+}
@@ -0,0 +1,238 @@
+package faas
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/gsarmaonline/faas/faas/helpers"
+	"github.com/gsarmaonline/faas/faas/metrics"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type (
+	// Option configures a Faas instance in NewFaas
+	Option func(*Faas)
+)
+
+// WithDefaultTimeout sets the deadline applied to every invocation that has
+// no function specific timeout. Zero disables the default deadline.
+func WithDefaultTimeout(timeout time.Duration) Option {
+	return func(faas *Faas) {
+		faas.defaultTimeout = timeout
+	}
+}
+
+// WithFunctionTimeout sets the deadline applied to every invocation of the
+// named function
+func WithFunctionTimeout(name string, timeout time.Duration) Option {
+	return func(faas *Faas) {
+		faas.timeouts[name] = timeout
+	}
+}
+
+// WithResultStore sets the store that keeps the state of asynchronous
+// invocations
+func WithResultStore(store ResultStore) Option {
+	return func(faas *Faas) {
+		faas.resultStore = store
+	}
+}
+
+// WithMaxConcurrency caps how many invocations run at once. Zero means
+// unlimited.
+func WithMaxConcurrency(maxConcurrency int) Option {
+	return func(faas *Faas) {
+		faas.pool.maxConcurrency = maxConcurrency
+	}
+}
+
+// WithMaxQueueSize caps how many invocations wait for a free slot before
+// new ones are rejected with ErrQueueFull. Zero means unbounded.
+func WithMaxQueueSize(maxQueueSize int) Option {
+	return func(faas *Faas) {
+		faas.pool.maxQueueSize = maxQueueSize
+	}
+}
+
+// WithFunctionConcurrency caps how many invocations of the named function
+// run at once
+func WithFunctionConcurrency(name string, maxConcurrency int) Option {
+	return func(faas *Faas) {
+		faas.pool.SetFunctionLimit(name, maxConcurrency)
+	}
+}
+
+// WithDefaultRetryPolicy sets the retry policy of functions without a
+// function specific policy
+func WithDefaultRetryPolicy(policy RetryPolicy) Option {
+	return func(faas *Faas) {
+		faas.defaultRetryPolicy = policy
+	}
+}
+
+// WithRetryPolicy sets the retry policy of the named function
+func WithRetryPolicy(name string, policy RetryPolicy) Option {
+	return func(faas *Faas) {
+		faas.retryPolicies[name] = policy
+	}
+}
+
+// WithDeadLetterStore replaces the in-memory store of invocations that
+// failed after their final attempt
+func WithDeadLetterStore(store DeadLetterStore) Option {
+	return func(faas *Faas) {
+		faas.deadLetters = store
+	}
+}
+
+// WithInterceptors adds interceptors around every invocation, see Faas.Use
+func WithInterceptors(interceptors ...Interceptor) Option {
+	return func(faas *Faas) {
+		faas.interceptors = append(faas.interceptors, interceptors...)
+	}
+}
+
+// WithHistoryStore replaces the in-memory store of the invocation history,
+// e.g. with a FileHistoryStore
+func WithHistoryStore(store HistoryStore) Option {
+	return func(faas *Faas) {
+		faas.history = store
+	}
+}
+
+// WithIdempotencyWindow sets how long the result of an invocation with an
+// idempotency key is returned for duplicates
+func WithIdempotencyWindow(window time.Duration) Option {
+	return func(faas *Faas) {
+		faas.idempotency.window = window
+	}
+}
+
+// WithIdempotencyCapacity sets how many idempotency keys are remembered at
+// most; zero removes the limit
+func WithIdempotencyCapacity(capacity int) Option {
+	return func(faas *Faas) {
+		faas.idempotency.capacity = capacity
+	}
+}
+
+// WithRateLimit limits how often the named function executes, across all
+// credentials
+func WithRateLimit(name string, limit RateLimit) Option {
+	return func(faas *Faas) {
+		faas.rateLimiter.functionLimits[name] = limit
+	}
+}
+
+// WithCredentialRateLimit limits how often the named function executes per
+// credential, e.g. per Slack token or Twilio account. It applies to functions
+// implementing intf.RateLimitKeyer.
+func WithCredentialRateLimit(name string, limit RateLimit) Option {
+	return func(faas *Faas) {
+		faas.rateLimiter.credentialLimits[name] = limit
+	}
+}
+
+// WithDefaultCircuitBreaker sets the circuit breaker of endpoints without an
+// endpoint specific configuration
+func WithDefaultCircuitBreaker(config CircuitBreakerConfig) Option {
+	return func(faas *Faas) {
+		faas.breakers.defaultConfig = config
+	}
+}
+
+// WithCircuitBreaker configures the circuit breaker of an endpoint, such as
+// "sendgrid" or "http:api.example.com"
+func WithCircuitBreaker(endpoint string, config CircuitBreakerConfig) Option {
+	return func(faas *Faas) {
+		faas.breakers.configs[endpoint] = config
+	}
+}
+
+// WithMaxCircuitBreakers bounds how many endpoints keep a circuit breaker,
+// DefaultMaxCircuitBreakers by default. Healthy breakers are dropped first.
+// A maxBreakers of zero or less keeps every breaker.
+func WithMaxCircuitBreakers(maxBreakers int) Option {
+	return func(faas *Faas) {
+		faas.breakers.maxBreakers = maxBreakers
+	}
+}
+
+// WithMetricsRegistry records the invocation metrics in registry, e.g. to
+// expose them together with the metrics of the embedding service
+func WithMetricsRegistry(registry *metrics.Registry) Option {
+	return func(faas *Faas) {
+		faas.metricsRegistry = registry
+	}
+}
+
+// WithMetricsInstance sets the instance label of the queue depth and
+// in-flight gauges, DefaultMetricsInstance by default. Every Faas sharing a
+// registry needs its own instance.
+func WithMetricsInstance(instance string) Option {
+	return func(faas *Faas) {
+		faas.metricsInstance = instance
+	}
+}
+
+// WithTracerProvider creates the invocation spans with provider instead of
+// the global tracer provider. Spans of provider calls are children of the
+// invocation span and use the same provider.
+func WithTracerProvider(provider trace.TracerProvider) Option {
+	return func(faas *Faas) {
+		faas.tracer = provider.Tracer(helpers.TracerName)
+	}
+}
+
+// WithLogger logs with logger instead of slog.Default(). Functions receive
+// it through their context with the invocation ID, function name and attempt
+// attached; see helpers.LoggerFromContext.
+func WithLogger(logger *slog.Logger) Option {
+	return func(faas *Faas) {
+		faas.logger = logger
+	}
+}
+
+// WithFunctionLogLevel sets the minimum level of the logs of the named
+// function, overriding the level of the logger
+func WithFunctionLogLevel(name string, level slog.Level) Option {
+	return func(faas *Faas) {
+		faas.logLevels[name] = level
+	}
+}
+
+// WithRedactor masks credentials with redactor instead of
+// helpers.NewRedactor(), e.g. to add the credential fields or environment
+// variables of custom functions
+func WithRedactor(redactor *helpers.Redactor) Option {
+	return func(faas *Faas) {
+		faas.redactor = redactor
+	}
+}
+
+// WithSecretProvider resolves the credentials of functions through provider
+// instead of
+// helpers.DefaultSecretProvider(), e.g. a helpers.SecretProviderChain that
+// falls back to Vault
+func WithSecretProvider(provider helpers.SecretProvider) Option {
+	return func(faas *Faas) {
+		faas.secrets = provider
+	}
+}
+
+// WithCredentialScope grants the named function exactly keys. Functions
+// other than the built-ins resolve no credential until they are granted
+// one; the keys their configs declare are only informative.
+func WithCredentialScope(name string, keys ...string) Option {
+	return func(faas *Faas) {
+		faas.credentialScopes[name] = keys
+	}
+}
+
+// WithCredentialAuditLog records every credential lookup in auditLog
+// instead of the Faas logger
+func WithCredentialAuditLog(auditLog CredentialAuditLog) Option {
+	return func(faas *Faas) {
+		faas.credentialAudit = auditLog
+	}
+}
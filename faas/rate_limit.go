@@ -0,0 +1,259 @@
+package faas
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gsarmaonline/faas/faas/intf"
+)
+
+const (
+	// rateLimitSweepInterval is how often idle buckets are evicted
+	rateLimitSweepInterval = time.Minute
+)
+
+const (
+	// Rate limit modes
+	WaitRateLimitMode   = RateLimitModeT("wait")
+	RejectRateLimitMode = RateLimitModeT("reject")
+)
+
+var (
+	ErrRateLimited = errors.New("rate limit exceeded")
+)
+
+type (
+	RateLimitModeT string
+
+	rateLimitModeKeyT struct{}
+
+	// RateLimit is a token bucket that allows Rate executions per second
+	// with bursts of up to Burst executions. A Rate of zero disables the
+	// limit.
+	RateLimit struct {
+		Rate  float64
+		Burst int
+		// AdaptToRetryAfter pauses the bucket when the provider answers
+		// with 429 and a Retry-After hint
+		AdaptToRetryAfter bool
+	}
+
+	// rateLimiter holds the token buckets of every function and, for
+	// functions implementing intf.RateLimitKeyer, of every credential
+	rateLimiter struct {
+		mu               sync.Mutex
+		functionLimits   map[string]RateLimit
+		credentialLimits map[string]RateLimit
+		buckets          map[rateLimitBucketKey]*tokenBucket
+		lastSweep        time.Time
+		now              func() time.Time
+	}
+
+	rateLimitBucketKey struct {
+		functionName string
+		// credential is a hash of the rate limit key, empty for the bucket
+		// of the function
+		credential string
+	}
+
+	tokenBucket struct {
+		limit RateLimit
+		// tokens were available at last, which lies in the future while
+		// the bucket is paused. Reservations may drive tokens negative.
+		tokens float64
+		last   time.Time
+	}
+)
+
+// WithRateLimitMode returns a context that makes invocations either wait for
+// a free rate limit token (the default) or fail right away with
+// ErrRateLimited
+func WithRateLimitMode(ctx context.Context, mode RateLimitModeT) context.Context {
+	return context.WithValue(ctx, rateLimitModeKeyT{}, mode)
+}
+
+// RateLimitModeFromContext returns the mode set by WithRateLimitMode
+func RateLimitModeFromContext(ctx context.Context) RateLimitModeT {
+	if mode, ok := ctx.Value(rateLimitModeKeyT{}).(RateLimitModeT); ok {
+		return mode
+	}
+	return WaitRateLimitMode
+}
+
+func newRateLimiter() *rateLimiter {
+	return &rateLimiter{
+		functionLimits:   make(map[string]RateLimit),
+		credentialLimits: make(map[string]RateLimit),
+		buckets:          make(map[rateLimitBucketKey]*tokenBucket),
+		now:              time.Now,
+	}
+}
+
+// acquire takes a token from every bucket that applies to the execution of
+// function. It waits for the tokens while ctx allows, unless reject is set.
+func (limiter *rateLimiter) acquire(ctx context.Context, name string, function intf.Function, reject bool) (err error) {
+	limiter.mu.Lock()
+	buckets := limiter.bucketsFor(name, function)
+	if len(buckets) == 0 {
+		limiter.mu.Unlock()
+		return
+	}
+
+	now := limiter.now()
+	var wait time.Duration
+	for _, bucket := range buckets {
+		if bucketWait := bucket.reserve(now); bucketWait > wait {
+			wait = bucketWait
+		}
+	}
+	if wait > 0 && reject {
+		for _, bucket := range buckets {
+			bucket.cancel()
+		}
+		limiter.mu.Unlock()
+		return ErrRateLimited
+	}
+	limiter.mu.Unlock()
+
+	if wait <= 0 {
+		return
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		limiter.mu.Lock()
+		for _, bucket := range buckets {
+			bucket.cancel()
+		}
+		limiter.mu.Unlock()
+		err = ctx.Err()
+	case <-timer.C:
+	}
+	return
+}
+
+// adapt pauses the buckets of function that adapt to Retry-After hints when
+// err is a rate limit response of the provider
+func (limiter *rateLimiter) adapt(name string, function intf.Function, err error) {
+	var providerErr *intf.ProviderError
+	if !errors.As(err, &providerErr) || providerErr.StatusCode != http.StatusTooManyRequests || providerErr.RetryAfter <= 0 {
+		return
+	}
+
+	limiter.mu.Lock()
+	defer limiter.mu.Unlock()
+
+	until := limiter.now().Add(providerErr.RetryAfter)
+	for _, bucket := range limiter.bucketsFor(name, function) {
+		if bucket.limit.AdaptToRetryAfter {
+			bucket.pause(until)
+		}
+	}
+}
+
+// bucketsFor returns the buckets that apply to function, creating them on
+// first use. The caller must hold mu.
+func (limiter *rateLimiter) bucketsFor(name string, function intf.Function) (buckets []*tokenBucket) {
+	limiter.sweep()
+
+	if limit, exists := limiter.functionLimits[name]; exists && limit.Rate > 0 {
+		buckets = append(buckets, limiter.bucket(rateLimitBucketKey{functionName: name}, limit))
+	}
+
+	limit, exists := limiter.credentialLimits[name]
+	keyer, ok := function.(intf.RateLimitKeyer)
+	if !exists || limit.Rate <= 0 || !ok {
+		return
+	}
+	hash := sha256.Sum256([]byte(keyer.RateLimitKey()))
+	key := rateLimitBucketKey{functionName: name, credential: hex.EncodeToString(hash[:])}
+	buckets = append(buckets, limiter.bucket(key, limit))
+	return
+}
+
+func (limiter *rateLimiter) bucket(key rateLimitBucketKey, limit RateLimit) *tokenBucket {
+	bucket, exists := limiter.buckets[key]
+	if !exists {
+		bucket = newTokenBucket(limit, limiter.now())
+		limiter.buckets[key] = bucket
+	}
+	return bucket
+}
+
+// sweep evicts the buckets that refilled completely, at most once per
+// rateLimitSweepInterval. A full bucket behaves like a new one, so the
+// buckets of idle credentials do not accumulate. The caller must hold mu.
+func (limiter *rateLimiter) sweep() {
+	now := limiter.now()
+	if now.Sub(limiter.lastSweep) < rateLimitSweepInterval {
+		return
+	}
+	limiter.lastSweep = now
+	for key, bucket := range limiter.buckets {
+		if bucket.full(now) {
+			delete(limiter.buckets, key)
+		}
+	}
+}
+
+func newTokenBucket(limit RateLimit, now time.Time) *tokenBucket {
+	if limit.Burst < 1 {
+		limit.Burst = 1
+	}
+	return &tokenBucket{
+		limit:  limit,
+		tokens: float64(limit.Burst),
+		last:   now,
+	}
+}
+
+// reserve takes a token and returns how long to wait until it is available
+func (bucket *tokenBucket) reserve(now time.Time) time.Duration {
+	if now.After(bucket.last) {
+		bucket.tokens += now.Sub(bucket.last).Seconds() * bucket.limit.Rate
+		if burst := float64(bucket.limit.Burst); bucket.tokens > burst {
+			bucket.tokens = burst
+		}
+		bucket.last = now
+	}
+
+	bucket.tokens--
+	wait := bucket.last.Sub(now)
+	if bucket.tokens < 0 {
+		wait += time.Duration(-bucket.tokens / bucket.limit.Rate * float64(time.Second))
+	}
+	return wait
+}
+
+// full tells whether the bucket holds a burst of tokens at now
+func (bucket *tokenBucket) full(now time.Time) bool {
+	if now.Before(bucket.last) {
+		return false
+	}
+	tokens := bucket.tokens + now.Sub(bucket.last).Seconds()*bucket.limit.Rate
+	return tokens >= float64(bucket.limit.Burst)
+}
+
+// cancel returns a reserved token
+func (bucket *tokenBucket) cancel() {
+	bucket.tokens++
+	if burst := float64(bucket.limit.Burst); bucket.tokens > burst {
+		bucket.tokens = burst
+	}
+}
+
+// pause empties the bucket until the given time
+func (bucket *tokenBucket) pause(until time.Time) {
+	if until.After(bucket.last) {
+		bucket.last = until
+	}
+	if bucket.tokens > 0 {
+		bucket.tokens = 0
+	}
+}
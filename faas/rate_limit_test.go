@@ -0,0 +1,173 @@
+package faas
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gsarmaonline/faas/faas/intf"
+)
+
+// KeyedFunction echoes its payload and is rate limited per "token"
+type KeyedFunction struct {
+	EchoFunction
+}
+
+func (k *KeyedFunction) GetConfig() intf.FunctionConfig {
+	return intf.FunctionConfig{Name: "keyed"}
+}
+
+func (k *KeyedFunction) RateLimitKey() string {
+	token, _ := k.Input["token"].(string)
+	return token
+}
+
+func newKeyedFunction() *KeyedFunction {
+	return &KeyedFunction{}
+}
+
+func TestTokenBucket(t *testing.T) {
+	now := time.Now()
+	bucket := newTokenBucket(RateLimit{Rate: 2, Burst: 2}, now)
+
+	waits := []time.Duration{bucket.reserve(now), bucket.reserve(now), bucket.reserve(now)}
+	want := []time.Duration{0, 0, 500 * time.Millisecond}
+	for idx := range waits {
+		if waits[idx] != want[idx] {
+			t.Errorf("reserve() #%d = %v, want %v", idx+1, waits[idx], want[idx])
+		}
+	}
+
+	bucket.cancel()
+	if got := bucket.reserve(now.Add(time.Second)); got != 0 {
+		t.Errorf("reserve() after refill = %v, want 0", got)
+	}
+
+	bucket.pause(now.Add(time.Minute))
+	if got := bucket.reserve(now.Add(30 * time.Second)); got != 30*time.Second+500*time.Millisecond {
+		t.Errorf("reserve() while paused = %v, want 30.5s", got)
+	}
+}
+
+func TestFaas_RateLimit_Reject(t *testing.T) {
+	faas, calls := newCountingFaas(t, CountingFunction{}, WithRateLimit("counting", RateLimit{Rate: 0.001, Burst: 2}))
+	ctx := WithRateLimitMode(context.Background(), RejectRateLimitMode)
+
+	for i := 0; i < 2; i++ {
+		if _, err := faas.InvokeFunction(ctx, "counting", intf.Payload{}); err != nil {
+			t.Fatalf("InvokeFunction() within burst error = %v", err)
+		}
+	}
+
+	_, err := faas.InvokeFunction(ctx, "counting", intf.Payload{})
+	var invErr *InvocationError
+	if !errors.Is(err, ErrRateLimited) || !errors.As(err, &invErr) || invErr.Stage != RateLimitStage {
+		t.Errorf("InvokeFunction() over the limit error = %v, want %v at %s stage", err, ErrRateLimited, RateLimitStage)
+	}
+	if got := calls.Load(); got != 2 {
+		t.Errorf("Execute called %d times, want 2", got)
+	}
+	if letters, _ := faas.ListDeadLetters(""); len(letters) != 0 {
+		t.Errorf("rejected invocation was dead lettered: %+v", letters)
+	}
+}
+
+func TestFaas_RateLimit_Wait(t *testing.T) {
+	faas, calls := newCountingFaas(t, CountingFunction{}, WithRateLimit("counting", RateLimit{Rate: 20, Burst: 1}))
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if _, err := faas.InvokeFunction(context.Background(), "counting", intf.Payload{}); err != nil {
+			t.Fatalf("InvokeFunction() error = %v", err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 90*time.Millisecond {
+		t.Errorf("3 invocations at 20/s took %v, want at least 100ms", elapsed)
+	}
+	if got := calls.Load(); got != 3 {
+		t.Errorf("Execute called %d times, want 3", got)
+	}
+
+	// A caller that gives up returns its token
+	faas, _ = newCountingFaas(t, CountingFunction{}, WithRateLimit("counting", RateLimit{Rate: 0.001, Burst: 1}))
+	faas.InvokeFunction(context.Background(), "counting", intf.Payload{})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := faas.InvokeFunction(ctx, "counting", intf.Payload{}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("InvokeFunction() waiting for a token error = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestFaas_CredentialRateLimit(t *testing.T) {
+	faas := newFaas(context.Background(), WithCredentialRateLimit("keyed", RateLimit{Rate: 0.001, Burst: 1}))
+	if err := faas.RegisterFunctions([]intf.FunctionFactory{intf.FactoryOf(newKeyedFunction)}); err != nil {
+		t.Fatalf("RegisterFunctions() error = %v", err)
+	}
+	ctx := WithRateLimitMode(context.Background(), RejectRateLimitMode)
+
+	for _, token := range []string{"team-a", "team-b"} {
+		if _, err := faas.InvokeFunction(ctx, "keyed", intf.Payload{"token": token}); err != nil {
+			t.Errorf("InvokeFunction(%s) error = %v", token, err)
+		}
+	}
+	if _, err := faas.InvokeFunction(ctx, "keyed", intf.Payload{"token": "team-a"}); !errors.Is(err, ErrRateLimited) {
+		t.Errorf("InvokeFunction(team-a) again error = %v, want %v", err, ErrRateLimited)
+	}
+
+	for key := range faas.rateLimiter.buckets {
+		if key.credential == "team-a" || key.credential == "team-b" {
+			t.Errorf("bucket key %+v holds the raw credential", key)
+		}
+	}
+}
+
+func TestRateLimiter_EvictsIdleBuckets(t *testing.T) {
+	now := time.Now()
+	limiter := newRateLimiter()
+	limiter.now = func() time.Time { return now }
+	limiter.credentialLimits["keyed"] = RateLimit{Rate: 1, Burst: 2}
+
+	for _, token := range []string{"team-a", "team-b", "team-c"} {
+		function := &KeyedFunction{EchoFunction{Input: intf.Payload{"token": token}}}
+		limiter.bucketsFor("keyed", function)[0].reserve(now)
+	}
+	if len(limiter.buckets) != 3 {
+		t.Fatalf("buckets = %d, want 3", len(limiter.buckets))
+	}
+
+	// team-c is still refilling when the buckets are swept
+	now = now.Add(rateLimitSweepInterval)
+	limiter.buckets[rateLimitBucketKeyOf("keyed", "team-c")].tokens = -float64(rateLimitSweepInterval / time.Second)
+	limiter.bucketsFor("other", &KeyedFunction{})
+	if _, exists := limiter.buckets[rateLimitBucketKeyOf("keyed", "team-c")]; len(limiter.buckets) != 1 || !exists {
+		t.Errorf("buckets after sweep = %v, want only the refilling bucket", limiter.buckets)
+	}
+}
+
+func rateLimitBucketKeyOf(name, token string) rateLimitBucketKey {
+	hash := sha256.Sum256([]byte(token))
+	return rateLimitBucketKey{functionName: name, credential: hex.EncodeToString(hash[:])}
+}
+
+func TestFaas_RateLimit_AdaptsToRetryAfter(t *testing.T) {
+	rateLimited := intf.NewProviderError("test", 429, errors.New("slow down"))
+	rateLimited.RetryAfter = time.Hour
+	faas, calls := newFlakyFaas(t, 1, rateLimited,
+		WithDefaultRetryPolicy(NoRetryPolicy),
+		WithRateLimit("flaky", RateLimit{Rate: 100, Burst: 10, AdaptToRetryAfter: true}),
+	)
+	ctx := WithRateLimitMode(context.Background(), RejectRateLimitMode)
+
+	if _, err := faas.InvokeFunction(ctx, "flaky", intf.Payload{}); !errors.Is(err, rateLimited) {
+		t.Fatalf("InvokeFunction() error = %v, want %v", err, rateLimited)
+	}
+	if _, err := faas.InvokeFunction(ctx, "flaky", intf.Payload{}); !errors.Is(err, ErrRateLimited) {
+		t.Errorf("InvokeFunction() after a 429 error = %v, want %v", err, ErrRateLimited)
+	}
+	if got := calls.Load(); got != 1 {
+		t.Errorf("Execute called %d times, want 1", got)
+	}
+}
@@ -0,0 +1,62 @@
+package faas
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"strings"
+
+	"github.com/gsarmaonline/faas/faas/helpers"
+	"github.com/gsarmaonline/faas/faas/intf"
+)
+
+var (
+	// ErrRedactedCredentials is returned when a recorded payload is sent
+	// again without the credentials that were redacted from it
+	ErrRedactedCredentials = errors.New("recorded payload has redacted credentials")
+)
+
+// invocationRedactor returns the Redactor of an invocation: the Redactor of
+// Faas extended with the credentials passed in payload
+func (faas *Faas) invocationRedactor(config intf.FunctionConfig, payload intf.Payload) *helpers.Redactor {
+	return faas.redactor.WithPayloadCredentials(config.InputSchema, payload)
+}
+
+// redactInvocationError masks secrets in the message of err. The cause of
+// an *InvocationError is masked in place, so that callers can still match
+// the invocation error and its stage.
+func redactInvocationError(redactor *helpers.Redactor, err error) error {
+	var invErr *InvocationError
+	if errors.As(err, &invErr) {
+		invErr.Err = redactor.Error(invErr.Err)
+		return err
+	}
+	return redactor.Error(err)
+}
+
+// resendPayload returns the payload to send a recorded payload again with:
+// the redacted fields are left out and overrides replace top-level fields
+func resendPayload(recorded, overrides intf.Payload) intf.Payload {
+	payload := helpers.StripRedacted(recorded)
+	if payload == nil {
+		payload = intf.Payload{}
+	}
+	maps.Copy(payload, overrides)
+	return payload
+}
+
+// missingCredentials returns the redacted fields of a recorded payload that
+// overrides do not replace
+func missingCredentials(recorded, overrides intf.Payload) (fields []string) {
+	for _, field := range helpers.RedactedFields(recorded) {
+		topLevel, _, _ := strings.Cut(field, ".")
+		if _, exists := overrides[topLevel]; !exists {
+			fields = append(fields, field)
+		}
+	}
+	return
+}
+
+func redactedCredentialsError(fields []string) error {
+	return fmt.Errorf("%w: %s", ErrRedactedCredentials, strings.Join(fields, ", "))
+}
@@ -0,0 +1,116 @@
+package faas
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gsarmaonline/faas/faas/helpers"
+	"github.com/gsarmaonline/faas/faas/intf"
+)
+
+var errRejected = errors.New("rejected")
+
+// LeakingFunction fails with an error and a log line that contain its
+// credential and the SendGrid key of the environment
+type LeakingFunction struct {
+	CredentialFunction
+}
+
+func (l *LeakingFunction) Execute(ctx context.Context) (intf.FunctionOutput, error) {
+	err := fmt.Errorf("SendGrid API error: key %v, fallback key SG.env-secret: %w", l.Input["api_key"], errRejected)
+	helpers.LoggerFromContext(ctx).Error("Request failed", "error", err)
+	return nil, err
+}
+
+func TestFaas_Redaction(t *testing.T) {
+	t.Setenv(helpers.EnvSendGridAPIKey, "SG.env-secret")
+	out := &bytes.Buffer{}
+	store := newWatchedResultStore()
+	faas := newFaas(context.Background(),
+		WithResultStore(store),
+		WithDefaultRetryPolicy(NoRetryPolicy),
+		WithLogger(slog.New(slog.NewTextHandler(out, nil))),
+	)
+	if err := faas.RegisterFunctions([]intf.FunctionFactory{func() intf.Function { return &LeakingFunction{} }}); err != nil {
+		t.Fatalf("RegisterFunctions() error = %v", err)
+	}
+	secrets := []string{"SG.payload-secret", "SG.env-secret"}
+	leaks := func(what, text string) {
+		t.Helper()
+		for _, secret := range secrets {
+			if strings.Contains(text, secret) {
+				t.Errorf("%s contains %s: %s", what, secret, text)
+			}
+		}
+	}
+	payload := intf.Payload{"api_key": "SG.payload-secret", "message": "hi"}
+
+	_, err := faas.InvokeFunction(context.Background(), "credential", payload)
+	var invErr *InvocationError
+	if !errors.As(err, &invErr) || invErr.Stage != ExecuteStage || !errors.Is(err, errRejected) {
+		t.Fatalf("InvokeFunction() error = %v, want an execute stage error wrapping %v", err, errRejected)
+	}
+	leaks("error", err.Error())
+	leaks("log", out.String())
+
+	records, _ := faas.QueryHistory(HistoryQuery{})
+	leaks("history", fmt.Sprint(records))
+	letters, _ := faas.ListDeadLetters("")
+	if len(letters) != 1 || letters[0].Payload["api_key"] != helpers.RedactedValue {
+		t.Fatalf("dead letters = %+v, want one with api_key redacted", letters)
+	}
+	leaks("dead letter", fmt.Sprint(letters))
+
+	id, _ := faas.InvokeAsync("credential", payload)
+	leaks("async invocation", fmt.Sprint(store.waitForInvocation(t, id)))
+}
+
+// SecretEchoFunction returns and logs the token it resolved
+type SecretEchoFunction struct {
+	SecretFunction
+}
+
+func (s *SecretEchoFunction) Execute(ctx context.Context) (intf.FunctionOutput, error) {
+	logger := helpers.LoggerFromContext(ctx)
+	logger.Info("Request", "payload", intf.Payload{"api_key": s.token, "note": "with " + s.token})
+	logger.Info("Headers", "headers", map[string]interface{}{"authorization": "Bearer " + s.token})
+	logger.Info("Client", "client", struct{ Token string }{s.token})
+	return EchoOutput{Payload: intf.Payload{"message": "sent with " + s.token}}, nil
+}
+
+func TestFaas_Redaction_ResolvedSecrets(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "TEST_SECRET_TOKEN"), []byte("mounted-token"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	out := &bytes.Buffer{}
+	store := newWatchedResultStore()
+	faas := newFaas(context.Background(),
+		WithResultStore(store),
+		WithLogger(slog.New(slog.NewJSONHandler(out, nil))),
+		WithSecretProvider(helpers.FileSecretProvider{Dir: dir}),
+		WithCredentialScope("secret", "TEST_SECRET_TOKEN"),
+	)
+	if err := faas.RegisterFunctions([]intf.FunctionFactory{func() intf.Function { return &SecretEchoFunction{} }}); err != nil {
+		t.Fatalf("RegisterFunctions() error = %v", err)
+	}
+
+	id, err := faas.InvokeAsync("secret", intf.Payload{})
+	if err != nil {
+		t.Fatalf("InvokeAsync() error = %v", err)
+	}
+	invocation := store.waitForInvocation(t, id)
+	if invocation.Output["message"] != "sent with "+helpers.RedactedValue {
+		t.Errorf("Output = %v (%s), want the resolved token redacted", invocation.Output, invocation.Error)
+	}
+	if strings.Contains(out.String(), "mounted-token") {
+		t.Errorf("log contains the resolved token:\n%s", out.String())
+	}
+}
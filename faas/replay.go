@@ -0,0 +1,132 @@
+package faas
+
+import (
+	"context"
+	"time"
+
+	"github.com/gsarmaonline/faas/faas/helpers"
+	"github.com/gsarmaonline/faas/faas/intf"
+)
+
+type (
+	replayOfKeyT struct{}
+
+	// ReplayOptions control how recorded invocations are replayed
+	ReplayOptions struct {
+		// Overrides are merged into the recorded payload, replacing
+		// top-level fields
+		Overrides intf.Payload
+		// DryRun checks the payload against the input schema instead of
+		// invoking the function
+		DryRun bool
+		// DefaultCredentials replays records whose credentials were
+		// redacted and not overridden with the default credentials of the
+		// function, such as its environment variables
+		DefaultCredentials bool
+	}
+
+	// ReplayResult is the outcome of replaying a single history record
+	ReplayResult struct {
+		Record HistoryRecord
+		// Payload is the payload that was, or in a dry run would be, sent
+		Payload intf.Payload
+		// MissingCredentials are the redacted credential fields of the
+		// record that are not overridden, e.g. auth.token
+		MissingCredentials []string
+		Output             intf.FunctionOutput
+		Err                error
+	}
+)
+
+// Replay invokes the function of a recorded invocation again with its
+// original payload. Credential fields that were redacted from the record are
+// not sent again: the replay fails with ErrRedactedCredentials unless opts
+// overrides them or allows the default credentials of the function. The new
+// invocation is recorded with ReplayOf set to id.
+func (faas *Faas) Replay(ctx context.Context, id string, opts ReplayOptions) (result ReplayResult, err error) {
+	var record HistoryRecord
+	if record, err = faas.history.Get(id); err != nil {
+		return
+	}
+	result = faas.replay(ctx, record, opts)
+	return
+}
+
+// ReplayFailed replays every failed invocation of the named function that
+// started in [since, until), oldest first. A zero since or until leaves the
+// window open. Invocations that were already replayed successfully are
+// skipped, and so are failed replays of invocations in the window, which are
+// replayed from the original instead. Failed replays are reported in the
+// results and do not stop the remaining ones.
+func (faas *Faas) ReplayFailed(ctx context.Context, name string, since, until time.Time, opts ReplayOptions) (results []ReplayResult, err error) {
+	var records, succeeded []HistoryRecord
+	if records, err = faas.history.Query(HistoryQuery{
+		FunctionName: name,
+		Status:       FailedInvocationStatus,
+		Since:        since,
+		Until:        until,
+	}); err != nil {
+		return
+	}
+	// Replays start after the invocation they replay, so the window only
+	// needs a lower bound
+	if succeeded, err = faas.history.Query(HistoryQuery{
+		FunctionName: name,
+		Status:       SucceededInvocationStatus,
+		Since:        since,
+	}); err != nil {
+		return
+	}
+
+	skipped := make(map[string]bool)
+	for _, record := range succeeded {
+		if record.ReplayOf != "" {
+			skipped[record.ReplayOf] = true
+		}
+	}
+	inWindow := make(map[string]bool, len(records))
+	for _, record := range records {
+		inWindow[record.ID] = true
+	}
+
+	for _, record := range records {
+		if skipped[record.ID] || inWindow[record.ReplayOf] {
+			continue
+		}
+		if err = ctx.Err(); err != nil {
+			return
+		}
+		results = append(results, faas.replay(ctx, record, opts))
+	}
+	return
+}
+
+func (faas *Faas) replay(ctx context.Context, record HistoryRecord, opts ReplayOptions) (result ReplayResult) {
+	result.Record = record
+	result.Payload = resendPayload(record.Payload, opts.Overrides)
+	result.MissingCredentials = missingCredentials(record.Payload, opts.Overrides)
+	if len(result.MissingCredentials) > 0 && !opts.DefaultCredentials {
+		result.Err = redactedCredentialsError(result.MissingCredentials)
+		return
+	}
+
+	if opts.DryRun {
+		var config intf.FunctionConfig
+		if config, result.Err = faas.DescribeFunction(record.FunctionName); result.Err != nil {
+			return
+		}
+		if result.Err = helpers.ValidateSchema(config.InputSchema, result.Payload); result.Err != nil {
+			result.Err = newInvocationError(record.FunctionName, SchemaStage, result.Err)
+		}
+		return
+	}
+
+	ctx = context.WithValue(ctx, replayOfKeyT{}, record.ID)
+	result.Output, result.Err = faas.InvokeFunction(ctx, record.FunctionName, result.Payload)
+	return
+}
+
+func replayOfFromContext(ctx context.Context) string {
+	replayOf, _ := ctx.Value(replayOfKeyT{}).(string)
+	return replayOf
+}
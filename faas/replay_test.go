@@ -0,0 +1,183 @@
+package faas
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gsarmaonline/faas/faas/intf"
+)
+
+func newCredentialFaas(t *testing.T) *Faas {
+	faas := newFaas(context.Background())
+	if err := faas.RegisterFunctions([]intf.FunctionFactory{intf.FactoryOf(newCredentialFunction)}); err != nil {
+		t.Fatalf("RegisterFunctions() error = %v", err)
+	}
+	return faas
+}
+
+func lastRecord(t *testing.T, faas *Faas, name string) HistoryRecord {
+	records, err := faas.QueryHistory(HistoryQuery{FunctionName: name, Limit: 1})
+	if err != nil || len(records) != 1 {
+		t.Fatalf("QueryHistory() = %+v, %v; want one record", records, err)
+	}
+	return records[0]
+}
+
+func TestFaas_Replay(t *testing.T) {
+	faas := newCredentialFaas(t)
+	if _, err := faas.InvokeFunction(context.Background(), "credential", intf.Payload{
+		"api_key": "secret",
+		"message": "hello",
+		"channel": "general",
+	}); err != nil {
+		t.Fatalf("InvokeFunction() error = %v", err)
+	}
+	original := lastRecord(t, faas, "credential")
+
+	// The credential was redacted from the record, so the replay needs an
+	// override or the explicit use of the default credentials
+	result, err := faas.Replay(context.Background(), original.ID, ReplayOptions{
+		Overrides: intf.Payload{"message": "hello again"},
+	})
+	if err != nil || !errors.Is(result.Err, ErrRedactedCredentials) || !reflect.DeepEqual(result.MissingCredentials, []string{"api_key"}) {
+		t.Fatalf("Replay() = %+v, %v; want %v for api_key", result, err, ErrRedactedCredentials)
+	}
+	if records, _ := faas.QueryHistory(HistoryQuery{}); len(records) != 1 {
+		t.Errorf("history has %d records after a refused replay, want 1", len(records))
+	}
+
+	result, err = faas.Replay(context.Background(), original.ID, ReplayOptions{
+		Overrides: intf.Payload{"message": "hello again", "api_key": "new-secret"},
+	})
+	if err != nil || result.Err != nil || len(result.MissingCredentials) != 0 {
+		t.Fatalf("Replay() with the credential overridden = %+v, %v", result, err)
+	}
+	if got := result.Output.(EchoOutput).Payload["api_key"]; got != "new-secret" {
+		t.Errorf("function saw api_key %v, want the override", got)
+	}
+
+	result, err = faas.Replay(context.Background(), original.ID, ReplayOptions{
+		Overrides:          intf.Payload{"message": "hello again"},
+		DefaultCredentials: true,
+	})
+	if err != nil || result.Err != nil {
+		t.Fatalf("Replay() error = %v, %v", err, result.Err)
+	}
+
+	// The redacted credential is left out rather than sent as a placeholder
+	want := intf.Payload{"message": "hello again", "channel": "general"}
+	if !reflect.DeepEqual(result.Payload, want) {
+		t.Errorf("replayed payload = %v, want %v", result.Payload, want)
+	}
+	if got := result.Output.(EchoOutput).Payload; !reflect.DeepEqual(got, want) {
+		t.Errorf("function saw payload %v, want %v", got, want)
+	}
+	if replayed := lastRecord(t, faas, "credential"); replayed.ReplayOf != original.ID {
+		t.Errorf("replayed record ReplayOf = %q, want %q", replayed.ReplayOf, original.ID)
+	}
+
+	if _, err := faas.Replay(context.Background(), "missing", ReplayOptions{}); !errors.Is(err, ErrHistoryRecordNotFound) {
+		t.Errorf("Replay() of unknown record error = %v, want %v", err, ErrHistoryRecordNotFound)
+	}
+}
+
+func TestFaas_Replay_DryRun(t *testing.T) {
+	faas := newCredentialFaas(t)
+	if _, err := faas.InvokeFunction(context.Background(), "credential", intf.Payload{"message": "hello"}); err != nil {
+		t.Fatalf("InvokeFunction() error = %v", err)
+	}
+	original := lastRecord(t, faas, "credential")
+
+	result, err := faas.Replay(context.Background(), original.ID, ReplayOptions{DryRun: true})
+	if err != nil || result.Err != nil || result.Output != nil {
+		t.Fatalf("Replay() = %+v, %v; want a clean preview", result, err)
+	}
+	if !reflect.DeepEqual(result.Payload, intf.Payload{"message": "hello"}) {
+		t.Errorf("preview payload = %v", result.Payload)
+	}
+
+	result, _ = faas.Replay(context.Background(), original.ID, ReplayOptions{
+		Overrides: intf.Payload{"message": 42},
+		DryRun:    true,
+	})
+	var invErr *InvocationError
+	if !errors.As(result.Err, &invErr) || invErr.Stage != SchemaStage {
+		t.Errorf("preview error = %v, want a schema stage error", result.Err)
+	}
+
+	if _, err := faas.InvokeFunction(context.Background(), "credential", intf.Payload{"message": "hello", "api_key": "secret"}); err != nil {
+		t.Fatalf("InvokeFunction() error = %v", err)
+	}
+	result, _ = faas.Replay(context.Background(), lastRecord(t, faas, "credential").ID, ReplayOptions{DryRun: true})
+	if !errors.Is(result.Err, ErrRedactedCredentials) || !reflect.DeepEqual(result.MissingCredentials, []string{"api_key"}) {
+		t.Errorf("preview = %+v, want the redacted api_key reported", result)
+	}
+
+	if records, _ := faas.QueryHistory(HistoryQuery{}); len(records) != 2 {
+		t.Errorf("history has %d records after dry runs, want 2", len(records))
+	}
+}
+
+func TestFaas_ReplayFailed(t *testing.T) {
+	outage := intf.NewProviderError("test", 503, errors.New("outage"))
+	faas, calls := newFlakyFaas(t, 3, outage, WithDefaultRetryPolicy(NoRetryPolicy))
+
+	for i := 0; i < 3; i++ {
+		faas.InvokeFunction(context.Background(), "flaky", intf.Payload{"attempt": i})
+	}
+	failed, _ := faas.QueryHistory(HistoryQuery{Status: FailedInvocationStatus})
+	if len(failed) != 3 {
+		t.Fatalf("history has %d failed records, want 3", len(failed))
+	}
+
+	// The window leaves out the first failure
+	results, err := faas.ReplayFailed(context.Background(), "flaky", failed[1].StartedAt, time.Time{}, ReplayOptions{})
+	if err != nil {
+		t.Fatalf("ReplayFailed() error = %v", err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("ReplayFailed() = %d results, want 2", len(results))
+	}
+	for idx, result := range results {
+		if result.Err != nil {
+			t.Errorf("result %d error = %v", idx, result.Err)
+		}
+		if result.Record.ID != failed[idx+1].ID {
+			t.Errorf("result %d replayed %s, want %s", idx, result.Record.ID, failed[idx+1].ID)
+		}
+	}
+	if got := calls.Load(); got != 5 {
+		t.Errorf("Execute called %d times, want 5", got)
+	}
+
+	// Invocations that were replayed successfully are not sent again
+	if results, err = faas.ReplayFailed(context.Background(), "flaky", failed[1].StartedAt, time.Time{}, ReplayOptions{}); err != nil || len(results) != 0 {
+		t.Errorf("ReplayFailed() again = %+v, %v; want nothing replayed", results, err)
+	}
+	if got := calls.Load(); got != 5 {
+		t.Errorf("Execute called %d times after replaying again, want 5", got)
+	}
+}
+
+func TestFaas_ReplayFailed_FailedReplays(t *testing.T) {
+	outage := intf.NewProviderError("test", 503, errors.New("outage"))
+	faas, calls := newFlakyFaas(t, 10, outage, WithDefaultRetryPolicy(NoRetryPolicy))
+	faas.InvokeFunction(context.Background(), "flaky", intf.Payload{})
+	original := lastRecord(t, faas, "flaky")
+
+	for i := 0; i < 2; i++ {
+		results, err := faas.ReplayFailed(context.Background(), "flaky", time.Time{}, time.Time{}, ReplayOptions{})
+		if err != nil {
+			t.Fatalf("ReplayFailed() error = %v", err)
+		}
+		if len(results) != 1 || results[0].Record.ID != original.ID || results[0].Err == nil {
+			t.Errorf("ReplayFailed() = %+v, want a single failed replay of %s", results, original.ID)
+		}
+	}
+	if got := calls.Load(); got != 3 {
+		t.Errorf("Execute called %d times, want 3", got)
+	}
+}
@@ -0,0 +1,92 @@
+package faas
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultResultTTL is how long the default result store keeps finished
+	// invocations
+	DefaultResultTTL = time.Hour
+)
+
+var (
+	ErrInvocationNotFound = errors.New("invocation not found")
+)
+
+type (
+	// ResultStore keeps the state of asynchronous invocations. Save is
+	// called whenever the status of an invocation changes.
+	ResultStore interface {
+		Save(invocation Invocation) error
+		Get(id string) (Invocation, error)
+	}
+
+	// MemoryResultStore is a ResultStore that keeps finished invocations in
+	// memory until their TTL expires. Queued and running invocations never
+	// expire.
+	MemoryResultStore struct {
+		mu        sync.Mutex
+		ttl       time.Duration
+		results   map[string]storedResult
+		lastSweep time.Time
+		now       func() time.Time
+	}
+
+	storedResult struct {
+		invocation Invocation
+		expiresAt  time.Time
+	}
+)
+
+func NewMemoryResultStore(ttl time.Duration) *MemoryResultStore {
+	return &MemoryResultStore{
+		ttl:     ttl,
+		results: make(map[string]storedResult),
+		now:     time.Now,
+	}
+}
+
+func (store *MemoryResultStore) Save(invocation Invocation) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	now := store.now()
+	result := storedResult{invocation: invocation}
+	if invocation.Status.IsTerminal() {
+		result.expiresAt = now.Add(store.ttl)
+	}
+	store.results[invocation.ID] = result
+
+	// Expired results are swept at most twice per TTL
+	if now.Sub(store.lastSweep) >= store.ttl/2 {
+		store.sweep(now)
+	}
+	return nil
+}
+
+func (store *MemoryResultStore) Get(id string) (Invocation, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	result, exists := store.results[id]
+	if !exists || result.expired(store.now()) {
+		return Invocation{}, ErrInvocationNotFound
+	}
+	return result.invocation, nil
+}
+
+func (store *MemoryResultStore) sweep(now time.Time) {
+	for id, result := range store.results {
+		if result.expired(now) {
+			delete(store.results, id)
+		}
+	}
+	store.lastSweep = now
+}
+
+func (result storedResult) expired(now time.Time) bool {
+	return !result.expiresAt.IsZero() && !now.Before(result.expiresAt)
+}
@@ -0,0 +1,42 @@
+package faas
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestMemoryResultStore(t *testing.T) {
+	now := time.Now()
+	store := NewMemoryResultStore(time.Minute)
+	store.now = func() time.Time { return now }
+
+	running := Invocation{ID: "running", Status: RunningInvocationStatus}
+	finished := Invocation{ID: "finished", Status: SucceededInvocationStatus}
+	for _, invocation := range []Invocation{running, finished} {
+		if err := store.Save(invocation); err != nil {
+			t.Fatalf("Save() error = %v", err)
+		}
+	}
+
+	if invocation, err := store.Get("finished"); err != nil || invocation.Status != SucceededInvocationStatus {
+		t.Errorf("Get() = %+v, %v, want finished invocation", invocation, err)
+	}
+
+	// Finished invocations expire after the TTL, running ones do not
+	now = now.Add(2 * time.Minute)
+	if _, err := store.Get("finished"); !errors.Is(err, ErrInvocationNotFound) {
+		t.Errorf("Get() error = %v, want %v after TTL", err, ErrInvocationNotFound)
+	}
+	if _, err := store.Get("running"); err != nil {
+		t.Errorf("Get() error = %v, running invocations should not expire", err)
+	}
+
+	// Saving sweeps expired results from memory
+	if err := store.Save(Invocation{ID: "other", Status: QueuedInvocationStatus}); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	if _, exists := store.results["finished"]; exists {
+		t.Error("expired results should be swept")
+	}
+}
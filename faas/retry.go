@@ -0,0 +1,82 @@
+package faas
+
+import (
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/gsarmaonline/faas/faas/intf"
+)
+
+type (
+	// RetryPolicy controls how often and how fast the execute stage of an
+	// invocation is retried. Only errors classified as retryable by
+	// intf.IsRetryable are retried.
+	RetryPolicy struct {
+		// MaxAttempts includes the first attempt; one disables retries
+		MaxAttempts    int
+		InitialBackoff time.Duration
+		MaxBackoff     time.Duration
+		Multiplier     float64
+		// Jitter randomizes each backoff by up to this fraction
+		Jitter float64
+		// MaxElapsedTime stops retrying once another attempt would start
+		// this long after the first one. Zero means no limit.
+		MaxElapsedTime time.Duration
+	}
+)
+
+// NoRetryPolicy runs the execute stage exactly once
+var NoRetryPolicy = RetryPolicy{MaxAttempts: 1}
+
+// DefaultRetryPolicy is used for functions without a configured policy
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:    3,
+		InitialBackoff: 500 * time.Millisecond,
+		MaxBackoff:     30 * time.Second,
+		Multiplier:     2,
+		Jitter:         0.2,
+		MaxElapsedTime: 2 * time.Minute,
+	}
+}
+
+// Backoff returns the delay before the attempt that follows attempt. A
+// Retry-After hint carried by err takes precedence when it is longer.
+func (policy RetryPolicy) Backoff(attempt int, err error) time.Duration {
+	multiplier := policy.Multiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+
+	backoff := float64(policy.InitialBackoff) * math.Pow(multiplier, float64(attempt-1))
+	if policy.Jitter > 0 {
+		backoff += backoff * policy.Jitter * (2*rand.Float64() - 1)
+	}
+	if policy.MaxBackoff > 0 && backoff > float64(policy.MaxBackoff) {
+		backoff = float64(policy.MaxBackoff)
+	}
+
+	// Without MaxBackoff, late attempts overflow a Duration
+	delay := time.Duration(math.MaxInt64)
+	if backoff < float64(math.MaxInt64) {
+		delay = time.Duration(backoff)
+	}
+	if retryAfter := intf.RetryAfter(err); retryAfter > delay {
+		delay = retryAfter
+	}
+	return delay
+}
+
+// shouldRetry reports whether another attempt may start after attempt
+// failed with err, given when the first attempt started
+func (policy RetryPolicy) shouldRetry(attempt int, err error, delay time.Duration, firstAttemptAt time.Time) bool {
+	if attempt >= policy.MaxAttempts || !intf.IsRetryable(err) {
+		return false
+	}
+	// Compared without adding to delay, which may be the longest Duration
+	if policy.MaxElapsedTime > 0 && delay > policy.MaxElapsedTime-time.Since(firstAttemptAt) {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,245 @@
+package faas
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gsarmaonline/faas/faas/intf"
+)
+
+// FlakyFunction fails with err until it has been executed failures times
+type FlakyFunction struct {
+	failures int32
+	err      error
+	calls    *atomic.Int32
+}
+
+func (f *FlakyFunction) GetConfig() intf.FunctionConfig {
+	return intf.FunctionConfig{Name: "flaky"}
+}
+
+func (f *FlakyFunction) ParsePayload(payload intf.Payload) error {
+	return nil
+}
+
+func (f *FlakyFunction) Validate() error {
+	return nil
+}
+
+func (f *FlakyFunction) Execute(ctx context.Context) (intf.FunctionOutput, error) {
+	if f.calls.Add(1) <= f.failures {
+		return nil, f.err
+	}
+	return EchoOutput{Payload: intf.Payload{"ok": true}}, nil
+}
+
+func newFlakyFaas(t *testing.T, failures int32, err error, opts ...Option) (*Faas, *atomic.Int32) {
+	calls := &atomic.Int32{}
+	faas := newFaas(context.Background(), opts...)
+	factory := func() intf.Function {
+		return &FlakyFunction{failures: failures, err: err, calls: calls}
+	}
+	if err := faas.RegisterFunctions([]intf.FunctionFactory{factory}); err != nil {
+		t.Fatalf("RegisterFunctions() error = %v", err)
+	}
+	return faas, calls
+}
+
+func fastRetryPolicy(maxAttempts int) RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:    maxAttempts,
+		InitialBackoff: time.Millisecond,
+		MaxBackoff:     5 * time.Millisecond,
+		Multiplier:     2,
+	}
+}
+
+func TestRetryPolicy_Backoff(t *testing.T) {
+	policy := RetryPolicy{
+		InitialBackoff: 100 * time.Millisecond,
+		MaxBackoff:     time.Second,
+		Multiplier:     2,
+	}
+	tests := []struct {
+		name    string
+		attempt int
+		err     error
+		want    time.Duration
+	}{
+		{name: "first attempt", attempt: 1, want: 100 * time.Millisecond},
+		{name: "exponential growth", attempt: 3, want: 400 * time.Millisecond},
+		{name: "capped at max backoff", attempt: 10, want: time.Second},
+		{
+			name:    "longer retry after wins",
+			attempt: 1,
+			err:     &intf.ProviderError{Provider: "test", StatusCode: 429, RetryAfter: 3 * time.Second},
+			want:    3 * time.Second,
+		},
+		{
+			name:    "shorter retry after ignored",
+			attempt: 2,
+			err:     &intf.ProviderError{Provider: "test", StatusCode: 429, RetryAfter: time.Millisecond},
+			want:    200 * time.Millisecond,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := policy.Backoff(tt.attempt, tt.err); got != tt.want {
+				t.Errorf("Backoff() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryPolicy_BackoffJitter(t *testing.T) {
+	policy := RetryPolicy{InitialBackoff: 100 * time.Millisecond, Multiplier: 2, Jitter: 0.5}
+	for i := 0; i < 100; i++ {
+		got := policy.Backoff(1, nil)
+		if got < 50*time.Millisecond || got > 150*time.Millisecond {
+			t.Fatalf("Backoff() = %v, want within 50ms..150ms", got)
+		}
+	}
+}
+
+func TestRetryPolicy_BackoffOverflow(t *testing.T) {
+	policy := RetryPolicy{InitialBackoff: time.Second, Multiplier: 2}
+	for _, attempt := range []int{64, 100, 2000} {
+		if got := policy.Backoff(attempt, nil); got != time.Duration(math.MaxInt64) {
+			t.Errorf("Backoff(%d) = %v, want the longest Duration", attempt, got)
+		}
+	}
+}
+
+func TestFaas_InvokeFunction_Retries(t *testing.T) {
+	unavailable := intf.NewProviderError("test", 503, errors.New("unavailable"))
+	tests := []struct {
+		name         string
+		failures     int32
+		err          error
+		policy       RetryPolicy
+		wantErr      bool
+		wantCalls    int32
+		wantAttempts int
+	}{
+		{
+			name:      "retryable error recovers",
+			failures:  2,
+			err:       unavailable,
+			policy:    fastRetryPolicy(3),
+			wantCalls: 3,
+		},
+		{
+			name:         "attempts exhausted",
+			failures:     5,
+			err:          unavailable,
+			policy:       fastRetryPolicy(3),
+			wantErr:      true,
+			wantCalls:    3,
+			wantAttempts: 3,
+		},
+		{
+			name:         "client error not retried",
+			failures:     1,
+			err:          intf.NewProviderError("test", 400, errors.New("bad request")),
+			policy:       fastRetryPolicy(3),
+			wantErr:      true,
+			wantCalls:    1,
+			wantAttempts: 1,
+		},
+		{
+			name:         "permanent error not retried",
+			failures:     1,
+			err:          intf.Permanent(unavailable),
+			policy:       fastRetryPolicy(3),
+			wantErr:      true,
+			wantCalls:    1,
+			wantAttempts: 1,
+		},
+		{
+			name:         "unclassified error not retried",
+			failures:     1,
+			err:          errors.New("boom"),
+			policy:       fastRetryPolicy(3),
+			wantErr:      true,
+			wantCalls:    1,
+			wantAttempts: 1,
+		},
+		{
+			name:         "retries disabled",
+			failures:     1,
+			err:          unavailable,
+			policy:       NoRetryPolicy,
+			wantErr:      true,
+			wantCalls:    1,
+			wantAttempts: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			faas, calls := newFlakyFaas(t, tt.failures, tt.err, WithRetryPolicy("flaky", tt.policy))
+
+			_, err := faas.InvokeFunction(context.Background(), "flaky", intf.Payload{})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("InvokeFunction() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := calls.Load(); got != tt.wantCalls {
+				t.Errorf("Execute called %d times, want %d", got, tt.wantCalls)
+			}
+			if !tt.wantErr {
+				return
+			}
+
+			var invErr *InvocationError
+			if !errors.As(err, &invErr) {
+				t.Fatalf("InvokeFunction() error = %T, want *InvocationError", err)
+			}
+			if invErr.Attempts != tt.wantAttempts {
+				t.Errorf("Attempts = %d, want %d", invErr.Attempts, tt.wantAttempts)
+			}
+			if !errors.Is(err, tt.err) {
+				t.Errorf("InvokeFunction() error = %v, want wrapping %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestFaas_InvokeFunction_RetryMaxElapsedTime(t *testing.T) {
+	policy := RetryPolicy{
+		MaxAttempts:    10,
+		InitialBackoff: time.Hour,
+		MaxElapsedTime: time.Second,
+	}
+	faas, calls := newFlakyFaas(t, 5, intf.Retryable(errors.New("flaky")), WithDefaultRetryPolicy(policy))
+
+	start := time.Now()
+	if _, err := faas.InvokeFunction(context.Background(), "flaky", intf.Payload{}); err == nil {
+		t.Fatal("InvokeFunction() error = nil, want error")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("InvokeFunction() took %v, want the backoff to be skipped", elapsed)
+	}
+	if got := calls.Load(); got != 1 {
+		t.Errorf("Execute called %d times, want 1", got)
+	}
+}
+
+func TestFaas_InvokeFunction_RetryStopsOnCancel(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 10, InitialBackoff: time.Hour}
+	faas, calls := newFlakyFaas(t, 5, intf.Retryable(errors.New("flaky")), WithDefaultRetryPolicy(policy))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if _, err := faas.InvokeFunction(ctx, "flaky", intf.Payload{}); err == nil {
+		t.Fatal("InvokeFunction() error = nil, want error")
+	}
+	if got := calls.Load(); got != 1 {
+		t.Errorf("Execute called %d times, want 1", got)
+	}
+}
@@ -0,0 +1,220 @@
+package faas
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+const (
+	// DefaultMaxConcurrency caps how many invocations run at once
+	DefaultMaxConcurrency = 64
+	// DefaultMaxQueueSize caps how many invocations wait for a free slot
+	DefaultMaxQueueSize = 1024
+)
+
+var (
+	ErrQueueFull = errors.New("invocation queue is full")
+)
+
+type (
+	// WorkerPool runs invocations with a global concurrency cap and
+	// optional per-function caps. Invocations that cannot start right away
+	// wait in a bounded FIFO queue; a queued invocation never blocks one of
+	// another function that has a free slot. A cap of zero means unlimited.
+	WorkerPool struct {
+		mu                sync.Mutex
+		maxConcurrency    int
+		maxQueueSize      int
+		functionLimits    map[string]int
+		running           int
+		runningByFunction map[string]int
+		queue             []*poolJob
+	}
+
+	WorkerPoolStats struct {
+		QueueDepth        int            `json:"queue_depth"`
+		Running           int            `json:"running"`
+		QueuedByFunction  map[string]int `json:"queued_by_function"`
+		RunningByFunction map[string]int `json:"running_by_function"`
+	}
+
+	poolJob struct {
+		name string
+		run  func()
+		// nested jobs are run by a job that already holds a slot; they
+		// count against the global cap but are not held back by it
+		nested bool
+	}
+)
+
+func NewWorkerPool(maxConcurrency, maxQueueSize int) *WorkerPool {
+	return &WorkerPool{
+		maxConcurrency:    maxConcurrency,
+		maxQueueSize:      maxQueueSize,
+		functionLimits:    make(map[string]int),
+		runningByFunction: make(map[string]int),
+	}
+}
+
+// SetFunctionLimit caps how many invocations of the named function run at
+// once. Zero removes the cap.
+func (pool *WorkerPool) SetFunctionLimit(name string, limit int) {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	if limit <= 0 {
+		delete(pool.functionLimits, name)
+	} else {
+		pool.functionLimits[name] = limit
+	}
+	pool.dispatch()
+}
+
+// Submit schedules run in the background. It returns ErrQueueFull if run
+// cannot start right away and the queue is full.
+func (pool *WorkerPool) Submit(name string, run func()) error {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	return pool.enqueue(&poolJob{name: name, run: run})
+}
+
+// Run schedules run and waits for it to finish. If ctx is done while run is
+// still queued, it is dropped from the queue and ctx.Err() is returned.
+func (pool *WorkerPool) Run(ctx context.Context, name string, run func()) error {
+	return pool.wait(ctx, &poolJob{name: name, run: run})
+}
+
+// runNested is Run for a job started by a job that holds a slot. It only
+// waits for the cap of its function: waiting for a global slot could
+// deadlock once every slot is held by a caller.
+func (pool *WorkerPool) runNested(ctx context.Context, name string, run func()) error {
+	return pool.wait(ctx, &poolJob{name: name, run: run, nested: true})
+}
+
+func (pool *WorkerPool) wait(ctx context.Context, job *poolJob) (err error) {
+	done := make(chan struct{})
+	run := job.run
+	job.run = func() {
+		defer close(done)
+		run()
+	}
+
+	pool.mu.Lock()
+	err = pool.enqueue(job)
+	pool.mu.Unlock()
+	if err != nil {
+		return
+	}
+
+	select {
+	case <-done:
+		return
+	case <-ctx.Done():
+	}
+
+	pool.mu.Lock()
+	dequeued := pool.remove(job)
+	pool.mu.Unlock()
+	if dequeued {
+		return ctx.Err()
+	}
+	// The job already started and observes ctx itself
+	<-done
+	return
+}
+
+// Stats returns the current queue depth and running counts
+func (pool *WorkerPool) Stats() (stats WorkerPoolStats) {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	stats = WorkerPoolStats{
+		QueueDepth:        len(pool.queue),
+		Running:           pool.running,
+		QueuedByFunction:  make(map[string]int),
+		RunningByFunction: make(map[string]int),
+	}
+	for _, job := range pool.queue {
+		stats.QueuedByFunction[job.name]++
+	}
+	for name, running := range pool.runningByFunction {
+		stats.RunningByFunction[name] = running
+	}
+	return
+}
+
+// enqueue must be called with mu held
+func (pool *WorkerPool) enqueue(job *poolJob) error {
+	if pool.canStart(job) {
+		pool.start(job)
+		return nil
+	}
+	if pool.maxQueueSize > 0 && len(pool.queue) >= pool.maxQueueSize {
+		return ErrQueueFull
+	}
+	pool.queue = append(pool.queue, job)
+	return nil
+}
+
+// remove drops a queued job and reports whether it was still queued. It must
+// be called with mu held.
+func (pool *WorkerPool) remove(job *poolJob) bool {
+	for i, queued := range pool.queue {
+		if queued == job {
+			pool.queue = append(pool.queue[:i], pool.queue[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func (pool *WorkerPool) canStart(job *poolJob) bool {
+	if !job.nested && pool.maxConcurrency > 0 && pool.running >= pool.maxConcurrency {
+		return false
+	}
+	if limit, exists := pool.functionLimits[job.name]; exists && pool.runningByFunction[job.name] >= limit {
+		return false
+	}
+	return true
+}
+
+func (pool *WorkerPool) start(job *poolJob) {
+	pool.running++
+	pool.runningByFunction[job.name]++
+
+	go func() {
+		defer pool.finish(job)
+		job.run()
+	}()
+}
+
+func (pool *WorkerPool) finish(job *poolJob) {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	pool.running--
+	if pool.runningByFunction[job.name]--; pool.runningByFunction[job.name] == 0 {
+		delete(pool.runningByFunction, job.name)
+	}
+	pool.dispatch()
+}
+
+// dispatch starts queued jobs in FIFO order as long as their caps allow. It
+// must be called with mu held.
+func (pool *WorkerPool) dispatch() {
+	remaining := pool.queue[:0]
+	for _, job := range pool.queue {
+		if pool.canStart(job) {
+			pool.start(job)
+		} else {
+			remaining = append(remaining, job)
+		}
+	}
+	// Clear the tail so dropped jobs can be garbage collected
+	for i := len(remaining); i < len(pool.queue); i++ {
+		pool.queue[i] = nil
+	}
+	pool.queue = remaining
+}
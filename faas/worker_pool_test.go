@@ -0,0 +1,327 @@
+package faas
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gsarmaonline/faas/faas/intf"
+)
+
+func TestWorkerPool_GlobalLimit(t *testing.T) {
+	pool := NewWorkerPool(2, 10)
+	release := make(chan struct{})
+
+	var (
+		current, peak int32
+		wg            sync.WaitGroup
+	)
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		if err := pool.Submit("fn", func() {
+			defer wg.Done()
+			running := atomic.AddInt32(&current, 1)
+			for {
+				observed := atomic.LoadInt32(&peak)
+				if running <= observed || atomic.CompareAndSwapInt32(&peak, observed, running) {
+					break
+				}
+			}
+			<-release
+			atomic.AddInt32(&current, -1)
+		}); err != nil {
+			t.Fatalf("Submit() error = %v", err)
+		}
+	}
+
+	// Jobs that can start do so within Submit
+	stats := pool.Stats()
+	if stats.Running != 2 || stats.QueueDepth != 4 || stats.QueuedByFunction["fn"] != 4 || stats.RunningByFunction["fn"] != 2 {
+		t.Errorf("Stats() = %+v, want 2 running and 4 queued", stats)
+	}
+
+	close(release)
+	wg.Wait()
+	if peak > 2 {
+		t.Errorf("peak concurrency = %d, want at most 2", peak)
+	}
+
+	// Both slots are freed once the jobs finish
+	started, hold := make(chan struct{}), make(chan struct{})
+	defer close(hold)
+	for i := 0; i < 2; i++ {
+		if err := pool.Submit("fn", func() {
+			started <- struct{}{}
+			<-hold
+		}); err != nil {
+			t.Fatalf("Submit() error = %v", err)
+		}
+	}
+	<-started
+	<-started
+	if stats := pool.Stats(); stats.Running != 2 || stats.QueueDepth != 0 {
+		t.Errorf("Stats() = %+v, want 2 running and none queued", stats)
+	}
+}
+
+func TestWorkerPool_FunctionLimit(t *testing.T) {
+	pool := NewWorkerPool(10, 10)
+	pool.SetFunctionLimit("docker_registry", 1)
+	release := make(chan struct{})
+	defer close(release)
+
+	for i := 0; i < 3; i++ {
+		if err := pool.Submit("docker_registry", func() { <-release }); err != nil {
+			t.Fatalf("Submit() error = %v", err)
+		}
+	}
+
+	// Queued docker_registry invocations do not block other functions
+	done := make(chan struct{})
+	if err := pool.Submit("logger", func() { close(done) }); err != nil {
+		t.Fatalf("Submit() error = %v", err)
+	}
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("logger invocation was blocked by queued docker_registry invocations")
+	}
+
+	if stats := pool.Stats(); stats.RunningByFunction["docker_registry"] != 1 || stats.QueuedByFunction["docker_registry"] != 2 {
+		t.Errorf("Stats() = %+v, want 1 running and 2 queued docker_registry invocations", stats)
+	}
+}
+
+func TestWorkerPool_QueueFull(t *testing.T) {
+	pool := NewWorkerPool(1, 1)
+	release := make(chan struct{})
+	defer close(release)
+
+	if err := pool.Submit("fn", func() { <-release }); err != nil {
+		t.Fatalf("Submit() error = %v", err)
+	}
+	if err := pool.Submit("fn", func() { <-release }); err != nil {
+		t.Fatalf("Submit() error = %v", err)
+	}
+	if err := pool.Submit("fn", func() { <-release }); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("Submit() error = %v, want %v", err, ErrQueueFull)
+	}
+	if err := pool.Run(context.Background(), "fn", func() {}); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("Run() error = %v, want %v", err, ErrQueueFull)
+	}
+}
+
+func TestWorkerPool_RunCancelledWhileQueued(t *testing.T) {
+	pool := NewWorkerPool(1, 10)
+	release := make(chan struct{})
+	defer close(release)
+
+	if err := pool.Submit("fn", func() { <-release }); err != nil {
+		t.Fatalf("Submit() error = %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	ran := false
+	if err := pool.Run(ctx, "fn", func() { ran = true }); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Run() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if ran {
+		t.Error("Run() should not run a job that was cancelled while queued")
+	}
+	if stats := pool.Stats(); stats.QueueDepth != 0 {
+		t.Errorf("QueueDepth = %d, want cancelled job to be removed", stats.QueueDepth)
+	}
+}
+
+func TestFaas_WorkerPoolBackpressure(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	faas := newFaas(ctx, WithMaxConcurrency(1), WithMaxQueueSize(1), WithFunctionConcurrency("blocking", 1))
+	if err := faas.RegisterFunctions([]intf.FunctionFactory{intf.FactoryOf(newBlockingFunction)}); err != nil {
+		t.Fatalf("RegisterFunctions() error = %v", err)
+	}
+
+	if _, err := faas.InvokeAsync("blocking", intf.Payload{}); err != nil {
+		t.Fatalf("InvokeAsync() error = %v", err)
+	}
+	if _, err := faas.InvokeAsync("blocking", intf.Payload{}); err != nil {
+		t.Fatalf("InvokeAsync() error = %v", err)
+	}
+	if _, err := faas.InvokeAsync("blocking", intf.Payload{}); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("InvokeAsync() error = %v, want %v", err, ErrQueueFull)
+	}
+	if _, err := faas.InvokeFunction(context.Background(), "blocking", intf.Payload{}); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("InvokeFunction() error = %v, want %v", err, ErrQueueFull)
+	}
+
+	stats := faas.WorkerPoolStats()
+	if stats.Running != 1 || stats.QueueDepth != 1 {
+		t.Errorf("WorkerPoolStats() = %+v, want 1 running and 1 queued", stats)
+	}
+}
+
+// NestedFunction invokes another function of its Faas from Execute
+type NestedFunction struct {
+	faas   *Faas
+	target string
+}
+
+func (n *NestedFunction) GetConfig() intf.FunctionConfig {
+	return intf.FunctionConfig{Name: "nested"}
+}
+
+func (n *NestedFunction) ParsePayload(payload intf.Payload) error {
+	return nil
+}
+
+func (n *NestedFunction) Validate() error {
+	return nil
+}
+
+func (n *NestedFunction) Execute(ctx context.Context) (intf.FunctionOutput, error) {
+	return n.faas.InvokeFunction(ctx, n.target, intf.Payload{"nested": true})
+}
+
+func TestFaas_InvokeFunction_Reentrant(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	faas := newFaas(context.Background(), WithMaxConcurrency(1), WithFunctionConcurrency("nested", 1))
+	if err := faas.RegisterFunctions([]intf.FunctionFactory{
+		intf.FactoryOf(newEchoFunction),
+		func() intf.Function { return &NestedFunction{faas: faas, target: "echo"} },
+	}); err != nil {
+		t.Fatalf("RegisterFunctions() error = %v", err)
+	}
+
+	output, err := faas.InvokeFunction(ctx, "nested", intf.Payload{})
+	if err != nil {
+		t.Fatalf("InvokeFunction() error = %v", err)
+	}
+	if echoOutput, ok := output.(EchoOutput); !ok || echoOutput.Payload["nested"] != true {
+		t.Errorf("InvokeFunction() output = %+v, want the nested echo", output)
+	}
+}
+
+// FanOutFunction invokes another function of its Faas concurrently from
+// Execute
+type FanOutFunction struct {
+	faas   *Faas
+	target string
+	count  int
+}
+
+func (f *FanOutFunction) GetConfig() intf.FunctionConfig {
+	return intf.FunctionConfig{Name: "fan_out"}
+}
+
+func (f *FanOutFunction) ParsePayload(payload intf.Payload) error {
+	return nil
+}
+
+func (f *FanOutFunction) Validate() error {
+	return nil
+}
+
+func (f *FanOutFunction) Execute(ctx context.Context) (intf.FunctionOutput, error) {
+	var (
+		wg   sync.WaitGroup
+		errs = make([]error, f.count)
+	)
+	for idx := range errs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, errs[idx] = f.faas.InvokeFunction(ctx, f.target, intf.Payload{})
+		}()
+	}
+	wg.Wait()
+	return nil, errors.Join(errs...)
+}
+
+// PeakFunction records how many of its executions overlap; each execution
+// signals started and waits for release
+type PeakFunction struct {
+	current, peak *atomic.Int32
+	started       chan struct{}
+	release       chan struct{}
+}
+
+func (p *PeakFunction) GetConfig() intf.FunctionConfig {
+	return intf.FunctionConfig{Name: "capped"}
+}
+
+func (p *PeakFunction) ParsePayload(payload intf.Payload) error {
+	return nil
+}
+
+func (p *PeakFunction) Validate() error {
+	return nil
+}
+
+func (p *PeakFunction) Execute(ctx context.Context) (intf.FunctionOutput, error) {
+	running := p.current.Add(1)
+	defer p.current.Add(-1)
+	for {
+		observed := p.peak.Load()
+		if running <= observed || p.peak.CompareAndSwap(observed, running) {
+			break
+		}
+	}
+	p.started <- struct{}{}
+	<-p.release
+	return nil, nil
+}
+
+func TestFaas_InvokeFunction_NestedFanOutKeepsCap(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	capped := PeakFunction{
+		current: &atomic.Int32{},
+		peak:    &atomic.Int32{},
+		started: make(chan struct{}),
+		release: make(chan struct{}),
+	}
+	faas := newFaas(context.Background(), WithMaxConcurrency(1), WithFunctionConcurrency("capped", 2))
+	if err := faas.RegisterFunctions([]intf.FunctionFactory{
+		func() intf.Function { return &FanOutFunction{faas: faas, target: "capped", count: 5} },
+		func() intf.Function { instance := capped; return &instance },
+	}); err != nil {
+		t.Fatalf("RegisterFunctions() error = %v", err)
+	}
+
+	result := make(chan error, 1)
+	go func() {
+		_, err := faas.InvokeFunction(ctx, "fan_out", intf.Payload{})
+		result <- err
+	}()
+
+	// Let the nested invocations through one at a time once two run
+	<-capped.started
+	<-capped.started
+	select {
+	case <-capped.started:
+		t.Fatal("a third invocation of capped started")
+	case <-time.After(20 * time.Millisecond):
+	}
+	capped.release <- struct{}{}
+	for i := 2; i < 5; i++ {
+		<-capped.started
+		capped.release <- struct{}{}
+	}
+	capped.release <- struct{}{}
+
+	if err := <-result; err != nil {
+		t.Fatalf("InvokeFunction() error = %v", err)
+	}
+	if peak := capped.peak.Load(); peak != 2 {
+		t.Errorf("peak concurrency of capped = %d, want 2", peak)
+	}
+}
@@ -8,19 +8,17 @@ import (
 )
 
 func main() {
-	_, err := faas.NewFaas(context.Background())
+	faasFramework, err := faas.NewFaas(context.Background())
 	if err != nil {
 		fmt.Printf("Error creating FAAS: %v\n", err)
 		return
 	}
 
+	configs := faasFramework.ListFunctions()
+
 	fmt.Println("✅ FAAS framework initialized successfully with all functions:")
-	fmt.Println("- slack")
-	fmt.Println("- email")
-	fmt.Println("- sms")
-	fmt.Println("- docker_registry")
-	fmt.Println("- http")
-	fmt.Println("- logger")
-	fmt.Println("- github")
-	fmt.Println("Total: 7 functions registered")
+	for _, config := range configs {
+		fmt.Printf("- %s (v%s): %s\n", config.Name, config.Version, config.Description)
+	}
+	fmt.Printf("Total: %d functions registered\n", len(configs))
 }